@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"dideban-agent/internal/config"
+	"dideban-agent/internal/diagnose"
+	"dideban-agent/internal/enroll"
+	"dideban-agent/internal/redact"
+	"dideban-agent/internal/sender"
+	"dideban-agent/internal/status"
+
+	"github.com/rs/zerolog"
+)
+
+// runCommand runs a subcommand and returns the process exit code.
+func runCommand(name string, args []string) int {
+	switch name {
+	case "diagnose":
+		return runDiagnose(args)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\nUsage:\n  dideban-agent             run the agent\n  dideban-agent diagnose    write a diagnostics bundle\n", name)
+		return 2
+	}
+}
+
+// runDiagnose implements `dideban-agent diagnose`: it writes a tar.gz
+// bundle for support tickets and prints a short summary. It works with
+// or without a running agent; a running agent is reached through its
+// status API.
+func runDiagnose(args []string) int {
+	flags := flag.NewFlagSet("diagnose", flag.ContinueOnError)
+	output := flags.String("o", "", "archive path (default: dideban-diagnose-<host>-<time>.tar.gz)")
+	snapshots := flags.Int("snapshots", 10, fmt.Sprintf("number of recent snapshots to include (at most %d)", status.HistorySize))
+	timeout := flags.Duration("timeout", 10*time.Second, "timeout of every request and connectivity step")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	// Keep the summary readable; problems are recorded in the bundle
+	zerolog.SetGlobalLevel(zerolog.WarnLevel)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	opts := diagnose.Options{
+		Snapshots: *snapshots,
+		Timeout:   *timeout,
+	}
+
+	opts.Config, opts.ConfigError = loadAgentConfig()
+	if opts.Config != nil {
+		// Validated with the configuration
+		_ = redact.SetPatterns(opts.Config.Redact.Patterns)
+		opts.Transport, opts.Tokens, opts.CoreError = diagnoseCore(opts.Config)
+	}
+
+	path := *output
+	if path == "" {
+		host, _ := os.Hostname()
+		path = fmt.Sprintf("dideban-diagnose-%s-%s.tar.gz", host, time.Now().Format("20060102T150405"))
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create %s: %v\n", path, err)
+		return 1
+	}
+
+	summary, err := diagnose.Run(ctx, opts, file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write %s: %v\n", path, err)
+		return 1
+	}
+
+	printSummary(path, summary)
+	return 0
+}
+
+// diagnoseCore prepares the connectivity test with the sender's transport
+// settings and credential. Unlike the agent, it never enrolls: with
+// enrollment enabled, the stored credential is used.
+func diagnoseCore(cfg *config.Config) (*http.Transport, sender.TokenSource, error) {
+	if cfg.Mode == config.ModeDevelopment {
+		return nil, nil, fmt.Errorf("development mode does not connect to Core")
+	}
+
+	httpConfig := newHTTPConfig(cfg)
+
+	var tokens sender.TokenSource
+	if cfg.Enroll.Enabled {
+		enroller := enroll.New(enrollConfig(cfg), nil)
+		creds, err := enroller.Stored()
+		if err != nil {
+			return nil, nil, fmt.Errorf("no stored enrollment credential: %w", err)
+		}
+
+		if creds.HasCertificate {
+			httpConfig.TLS.CertFile = enroller.CertFile()
+			httpConfig.TLS.KeyFile = enroller.KeyFile()
+		}
+		tokens = enroller
+	} else {
+		var err error
+		if tokens, err = newTokenSource(cfg); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	transport, err := sender.NewTransport(cfg.Core.Endpoint, httpConfig.TLS, httpConfig.Proxy)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return transport, tokens, nil
+}
+
+// printSummary prints where the bundle was written and the results of
+// the connectivity test.
+func printSummary(path string, summary *diagnose.Summary) {
+	fmt.Printf("Diagnostics written to %s\n", path)
+
+	fmt.Printf("Source: %s\n", summary.Source)
+	if summary.AgentError != "" {
+		fmt.Printf("  (%s)\n", summary.AgentError)
+	}
+
+	if len(summary.Connectivity) > 0 {
+		fmt.Println("Connectivity:")
+	}
+	for _, check := range summary.Connectivity {
+		switch {
+		case check.Skipped:
+			fmt.Printf("  %-5s skipped\n", check.Name)
+		case check.OK:
+			fmt.Printf("  %-5s ok    %s (%dms)\n", check.Name, check.Detail, check.Duration)
+		default:
+			fmt.Printf("  %-5s FAIL  %s\n", check.Name, check.Error)
+		}
+	}
+
+	for _, problem := range summary.Errors {
+		fmt.Printf("Problem: %s\n", problem)
+	}
+}
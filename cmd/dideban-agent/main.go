@@ -2,19 +2,36 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
+	"dideban-agent/internal/agentkey"
+	"dideban-agent/internal/alert"
 	"dideban-agent/internal/collector"
 	"dideban-agent/internal/config"
+	"dideban-agent/internal/enroll"
 	"dideban-agent/internal/logger"
+	"dideban-agent/internal/notify"
+	"dideban-agent/internal/queue"
+	"dideban-agent/internal/redact"
+	"dideban-agent/internal/remoteconfig"
+	"dideban-agent/internal/schedule"
 	"dideban-agent/internal/sender"
-
-	"github.com/rs/zerolog/log"
+	"dideban-agent/internal/state"
+	"dideban-agent/internal/status"
+	"dideban-agent/internal/version"
+	"dideban-agent/pkg/sealedbox"
+	"dideban-agent/pkg/signature"
 )
 
+// log is the logger of the agent component.
+var log = logger.New("agent")
+
 // main is the entry point of the Dideban Agent.
 //
 // The startup sequence is as follows:
@@ -23,56 +40,116 @@ import (
 //  3. Setup graceful shutdown handling
 //  4. Initialize core components
 //  5. Start the main agent loop
+//  6. On shutdown, flush pending snapshots within shutdown.timeout
 func main() {
+	// Subcommands (e.g. `dideban-agent diagnose`) run instead of the
+	// agent; flags such as --config are left to the agent
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		os.Exit(runCommand(os.Args[1], os.Args[2:]))
+	}
+
 	// Load application configuration (fails fast on error)
 	cfg := loadConfig()
 
 	// Initialize structured logger based on configuration
 	initLogger(cfg)
 
-	// Log basic startup information for observability
-	logStartup(cfg)
+	// Limit the agent's own memory and parallelism
+	applyResources(cfg)
 
 	// Create root context used across the entire application lifecycle.
 	// This context is cancelled on shutdown signals (SIGINT, SIGTERM, SIGQUIT).
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	// Register OS signal handlers for graceful shutdown
-	setupSignalHandlers(cancel)
+	// Register OS signal handlers for graceful shutdown. SIGHUP is
+	// registered now as well, so that a reload requested during startup
+	// is not taken as the default action (terminating the agent)
+	hangups := setupSignalHandlers(cancel)
+
+	// New configurations (e.g. delivered by Core) are applied by the agent loop
+	updates := newConfigUpdates()
+
+	// Start with the last good remote configuration, if any
+	remote := initRemoteConfig(cfg, updates)
+	if remote != nil {
+		if persisted := remote.LoadPersisted(); persisted != nil {
+			cfg = persisted
+			initLogger(cfg)
+			applyResources(cfg)
+		}
+	}
+
+	// Log basic startup information for observability
+	logStartup(cfg)
+
+	rt := &agentRuntime{
+		cfg:         cfg,
+		configHash:  cfg.Hash(),
+		remote:      remote,
+		started:     time.Now(),
+		senderStats: &sender.Stats{},
+		service:     newServiceManager(),
+	}
 
 	// Initialize metrics collector subsystem
-	metricsCollector := collector.New()
+	rt.setCollector(ctx, initCollector(cfg))
+
+	// Compile local alert rules and start notification channels
+	rt.alerts = initAlerts(cfg)
+	rt.notifier = initNotifier(cfg)
 
 	// Initialize sender based on application mode
-	metricsSender := initSender(cfg)
-	defer func() {
-		if err := metricsSender.Close(); err != nil {
-			log.Warn().Err(err).Msg("Failed to close sender")
-		}
-	}()
+	senders := initSender(ctx, cfg, rt)
+	rt.sender = senders.sender
+	defer rt.close()
+
+	// Snapshots are sent by a worker draining the queue, so a slow or
+	// unreachable Core never delays collection
+	rt.queue = initQueue(cfg, senders)
+	rt.queue.Start()
+
+	// Serve the local status API, if enabled
+	rt.status = initStatus(cfg, rt.queue)
+
+	// Everything that needs the initial privileges is open; drop them
+	rt.sandbox = initSandbox(cfg)
+
+	// Reload configuration on SIGHUP and, optionally, on file changes
+	setupReloadHandlers(ctx, cfg, hangups, &configReloader{remote: remote, updates: updates})
 
 	// Start the main agent execution loop (blocking call)
-	runAgent(ctx, cfg, metricsCollector, metricsSender)
+	runAgent(ctx, rt, updates)
+
+	// Collection has stopped; deliver what is still pending
+	rt.service.stopping()
+	flushPending(rt)
 
 	log.Info().Msg("Agent shutdown complete")
 }
 
 // runAgent runs the main agent loop.
-// It periodically triggers metric collection based on the configured interval
+// It periodically triggers metric collection based on the configured schedule
 // and continues running until the provided context is cancelled.
-func runAgent(
-	ctx context.Context,
-	cfg *config.Config,
-	collector *collector.Collector,
-	sender sender.Sender,
-) {
-	// Ticker controls the metric collection interval
-	ticker := time.NewTicker(cfg.Agent.Interval)
-	defer ticker.Stop()
+//
+// New configurations (reloaded locally or delivered by Core) received on
+// updates are applied between cycles.
+func runAgent(ctx context.Context, rt *agentRuntime, updates configUpdates) {
+	// Schedule controls the metric collection times
+	rt.schedule = schedule.New(scheduleConfig(rt.cfg))
+	defer func() { rt.schedule.Stop() }()
+
+	// Under systemd, the watchdog is pinged by this loop and only while
+	// collections keep completing, so a stuck loop gets the agent restarted
+	var watchdog <-chan time.Time
+	if rt.service.watchdog > 0 {
+		ticker := time.NewTicker(rt.service.watchdog)
+		defer ticker.Stop()
+		watchdog = ticker.C
+	}
 
 	// Perform an initial metric collection immediately on startup
-	collectOnce(ctx, collector, sender)
+	collectOnce(ctx, rt, time.Now())
 
 	for {
 		select {
@@ -81,34 +158,108 @@ func runAgent(
 			log.Info().Msg("Stopping agent loop")
 			return
 
-		// Trigger metric collection on each tick
-		case <-ticker.C:
-			collectOnce(ctx, collector, sender)
+		// Apply a new configuration
+		case cfg := <-updates:
+			scheduleChanged, err := rt.apply(ctx, cfg)
+			if rt.remote != nil {
+				rt.remote.Result(cfg, err)
+			}
+
+			if scheduleChanged {
+				rt.schedule.Stop()
+				rt.schedule = schedule.New(scheduleConfig(cfg))
+			}
+
+		// Trigger metric collection when a scheduled time is due
+		case <-rt.schedule.C():
+			tick, ok := rt.schedule.Tick()
+			if !ok {
+				continue
+			}
+
+			if tick.Missed > 0 {
+				log.Warn().
+					Int("missed", tick.Missed).
+					Time("scheduled", tick.Scheduled).
+					Msg("Missed scheduled collections (suspended or stalled), collecting now")
+			}
+
+			collectOnce(ctx, rt, tick.Scheduled)
+
+		// Report progress to the systemd watchdog
+		case <-watchdog:
+			if time.Since(rt.lastCollect) <= 2*rt.cfg.Agent.Interval+rt.cfg.Agent.Splay {
+				rt.service.pingWatchdog()
+			}
 		}
 	}
 }
 
 // collectOnce performs a single cycle of metric collection and processing.
-// Metrics are sent using the configured sender implementation.
-func collectOnce(
-	ctx context.Context,
-	collector *collector.Collector,
-	sender sender.Sender,
-) {
+// The snapshot is stamped with the time it was scheduled for and queued
+// for the sender worker; collectOnce never waits for the network.
+func collectOnce(ctx context.Context, rt *agentRuntime, scheduled time.Time) {
 	// Collect system metrics using all registered collectors
-	metrics, err := collector.CollectAll(ctx)
+	metrics, err := rt.collector.CollectAll(ctx)
 	if err != nil {
 		// Partial metrics may still be available even if an error occurred
 		log.Warn().Err(err).Msg("Metrics collected with errors")
 	}
+	failed := collector.FailedCollectors(err)
+	rt.lastCollect = time.Now()
+
+	// Snapshots of all agents share the same timestamps when aligned
+	metrics.Timestamp = scheduled.UnixMilli()
+
+	// Evaluate local alert rules; rules on failed or backed-off collectors
+	// keep their state
+	metrics.Alerts = rt.alerts.Evaluate(metrics, append(failed, metrics.Stale...))
+	rt.postAlerts(ctx, metrics.Alerts)
+	rt.notifier.Dispatch(metrics.Alerts)
+
+	// Report remote configuration state to Core
+	if rt.remote != nil {
+		metrics.Config = rt.remote.Status()
+	}
+
+	// Report agent self-metrics
+	metrics.Agent = rt.agentStats()
+
+	rt.queue.Push(metrics)
+
+	if rt.status != nil {
+		rt.status.Publish(metrics, rt.cfg)
+	}
 
-	// Send metrics using the configured sender
-	if err := sender.Send(ctx, metrics); err != nil {
-		log.Error().Err(err).Msg("Failed to send metrics")
-		return
+	rt.service.collected(len(failed) < len(rt.collector.Names()), rt.queue.Stats())
+
+	log.Debug().Msg("📊 Metrics collected and queued")
+}
+
+// flushPending delivers queued snapshots (and, if configured, a final
+// one) after the agent loop stopped. The root context is already
+// cancelled, so this runs on its own context bounded by shutdown.timeout.
+func flushPending(rt *agentRuntime) {
+	cfg := rt.cfg
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Shutdown.Timeout)
+	defer cancel()
+
+	log.Info().
+		Dur("timeout", cfg.Shutdown.Timeout).
+		Msg("Flushing pending metrics (signal again to exit immediately)")
+
+	if cfg.Shutdown.FinalSnapshot {
+		collectOnce(ctx, rt, time.Now())
+	}
+
+	if lost := rt.queue.Shutdown(ctx); lost > 0 {
+		log.Warn().Int("snapshots", lost).Msg("Shutdown timeout reached, undelivered snapshots dropped")
 	}
 
-	log.Debug().Msg("📊 Metrics collection and transmission completed")
+	if spilled := rt.queue.Stats().Spilled; spilled > 0 {
+		log.Info().Int("snapshots", spilled).Msg("📦 Undelivered snapshots kept on disk for the next start")
+	}
 }
 
 // setupSignalHandlers configures OS signal handling
@@ -116,7 +267,14 @@ func collectOnce(
 //
 // Upon receiving a shutdown signal, the provided cancel function is invoked,
 // which propagates cancellation through the entire application via context.
-func setupSignalHandlers(cancel context.CancelFunc) {
+// A second signal exits immediately, without waiting for pending data.
+//
+// SIGHUP is delivered on the returned channel until the reload handlers
+// take over (setupReloadHandlers); one pending SIGHUP is kept meanwhile.
+func setupSignalHandlers(cancel context.CancelFunc) <-chan os.Signal {
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+
 	sigChan := make(chan os.Signal, 1)
 
 	signal.Notify(
@@ -135,13 +293,23 @@ func setupSignalHandlers(cancel context.CancelFunc) {
 
 		// Trigger graceful shutdown
 		cancel()
+
+		sig = <-sigChan
+
+		log.Warn().
+			Str("signal", sig.String()).
+			Msg("Received second shutdown signal, exiting immediately")
+
+		os.Exit(1)
 	}()
+
+	return hangups
 }
 
 // loadConfig loads application configuration and terminates the program
 // immediately if configuration cannot be loaded.
 func loadConfig() *config.Config {
-	cfg, err := config.Load()
+	cfg, err := loadAgentConfig()
 	if err != nil {
 		log.Fatal().
 			Err(err).
@@ -150,45 +318,458 @@ func loadConfig() *config.Config {
 	return cfg
 }
 
-// initLogger initializes the global structured logger.
+// loadAgentConfig loads the configuration and checks the alert rules
+// against the collector snapshot, which the config package cannot do.
+func loadAgentConfig() (*config.Config, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := alert.Validate(cfg.Alerts.Rules); err != nil {
+		return nil, fmt.Errorf("config: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// initLogger initializes the global structured logger and the
+// configured redaction patterns it applies to every entry, including
+// those shipped to Core.
 func initLogger(cfg *config.Config) {
 	logger.Init(cfg)
+
+	// Patterns are validated with the configuration
+	if err := redact.SetPatterns(cfg.Redact.Patterns); err != nil {
+		log.Error().Err(err).Msg("Failed to set redaction patterns")
+	}
+}
+
+// initCollector creates the metrics collector or terminates the program
+// if the configured collector set is invalid.
+func initCollector(cfg *config.Config) collector.Source {
+	metricsCollector, err := newCollector(cfg)
+	if err != nil {
+		log.Fatal().
+			Err(err).
+			Msg("Failed to initialize collectors")
+	}
+	return metricsCollector
+}
+
+// newCollector creates a metrics collector with the enabled collectors.
+// With sampling enabled, the sampled collectors run in the background
+// and each snapshot carries the aggregates of the samples.
+func newCollector(cfg *config.Config) (collector.Source, error) {
+	if !cfg.Collectors.Sampling.Enabled {
+		metricsCollector, err := collector.New(cfg.EnabledCollectors()...)
+		if err != nil {
+			return nil, err
+		}
+		metricsCollector.SetBudget(collectorBudget(cfg))
+		return metricsCollector, nil
+	}
+
+	return collector.NewSampler(cfg.EnabledCollectors(), collector.SamplerConfig{
+		Collectors: cfg.Collectors.Sampling.Collectors,
+		Interval:   cfg.Collectors.Sampling.Interval,
+		Window:     cfg.Agent.Interval,
+		Budget:     collectorBudget(cfg),
+	})
+}
+
+// collectorBudget splits resources.cpu_budget equally among the enabled
+// collectors.
+func collectorBudget(cfg *config.Config) collector.Budget {
+	budget := collector.Budget{
+		After:     cfg.Resources.Backoff.After,
+		MaxFactor: cfg.Resources.Backoff.MaxFactor,
+	}
+	if enabled := len(cfg.EnabledCollectors()); enabled > 0 {
+		budget.Share = cfg.Resources.CPUBudget / time.Duration(enabled)
+	}
+	return budget
+}
+
+// initAlerts compiles the alert rules or terminates the program if they are invalid.
+func initAlerts(cfg *config.Config) *alert.Evaluator {
+	evaluator, err := alert.NewEvaluator(cfg.Alerts.Rules, nil)
+	if err != nil {
+		log.Fatal().
+			Err(err).
+			Msg("Failed to initialize alert rules")
+	}
+	return evaluator
+}
+
+// initNotifier starts the notification channels or terminates the program
+// if they cannot be created.
+func initNotifier(cfg *config.Config) *notify.Dispatcher {
+	notifier, err := newNotifier(cfg)
+	if err != nil {
+		log.Fatal().
+			Err(err).
+			Msg("Failed to initialize notification channels")
+	}
+	return notifier
+}
+
+// newNotifier creates the notification channels for alert events.
+// HTTP-based channels use the proxy settings but not the Core TLS settings.
+func newNotifier(cfg *config.Config) (*notify.Dispatcher, error) {
+	transport, err := sender.NewTransport("", sender.TLSConfig{}, proxyConfig(cfg))
+	if err != nil {
+		return nil, err
+	}
+
+	return notify.New(cfg.Notify.Channels, cfg.Agent.Name, transport)
+}
+
+// initSender creates the sender or terminates the program on failure.
+func initSender(ctx context.Context, cfg *config.Config, rt *agentRuntime) *senderSet {
+	set, err := newSender(ctx, cfg, rt)
+	if err != nil {
+		if ctx.Err() != nil {
+			log.Info().Msg("Shutdown requested during startup")
+			os.Exit(0)
+		}
+		log.Fatal().
+			Err(err).
+			Msg("Failed to initialize sender")
+	}
+
+	rt.useSenders(ctx, cfg, set)
+	return set
+}
+
+// scheduleConfig builds the collection schedule configuration.
+func scheduleConfig(cfg *config.Config) schedule.Config {
+	return schedule.Config{
+		Interval: cfg.Agent.Interval,
+		Align:    cfg.Agent.Align,
+		Splay:    cfg.Agent.Splay,
+	}
+}
+
+// initQueue creates the outgoing snapshot queue or terminates the program
+// if the spool directory cannot be used.
+func initQueue(cfg *config.Config, senders *senderSet) *queue.Queue {
+	q, err := queue.New(queue.Config{
+		Size:              cfg.Queue.Size,
+		Overflow:          cfg.Queue.Overflow,
+		SpillMaxFiles:     cfg.Queue.SpillMaxFiles,
+		StateDir:          state.Dir(cfg.Agent.StateDir),
+		InitialRetryDelay: cfg.Sender.InitialRetryDelay,
+		MaxRetryDelay:     cfg.Sender.MaxRetryDelay,
+	}, senders.sender, senders.tokens)
+	if err != nil {
+		log.Fatal().
+			Err(err).
+			Msg("Failed to initialize queue")
+	}
+	return q
+}
+
+// initStatus starts the local status API, or returns nil if it is
+// disabled. The program terminates if the API cannot listen.
+func initStatus(cfg *config.Config, q *queue.Queue) *status.Server {
+	if !cfg.Status.Enabled {
+		return nil
+	}
+
+	server := status.New(status.Config{
+		Listen:          cfg.Status.Listen,
+		Socket:          cfg.Status.Socket,
+		ReadyCollectAge: cfg.Status.ReadyCollectAge,
+		ReadySendAge:    cfg.Status.ReadySendAge,
+	}, q.Stats)
+
+	if err := server.Start(); err != nil {
+		log.Fatal().Err(err).Msg("Failed to start status API")
+	}
+	return server
+}
+
+// initRemoteConfig creates the remote configuration manager, or returns nil
+// if remote configuration is disabled. Accepted configurations are pushed
+// to updates.
+func initRemoteConfig(cfg *config.Config, updates configUpdates) *remoteconfig.Manager {
+	if !cfg.RemoteConfig.Enabled {
+		return nil
+	}
+
+	return remoteconfig.New(remoteconfig.Config{
+		Endpoint:       cfg.RemoteConfig.Endpoint,
+		PollInterval:   cfg.RemoteConfig.PollInterval,
+		RequestTimeout: cfg.Sender.RequestTimeout,
+		StateDir:       state.Dir(cfg.Agent.StateDir),
+	}, updates.push)
+}
+
+// senderSet is a sender together with the components that share its
+// transport settings and credentials: the remote configuration poller,
+// the alert poster and the log shipper. It is built completely before
+// any of it is used, so a failure leaves the running agent untouched.
+type senderSet struct {
+	sender sender.Sender
+
+	// Production mode only
+	tokens        sender.TokenSource
+	pollTransport http.RoundTripper // nil if there is no remote configuration endpoint
+	shipTransport http.RoundTripper // nil if log shipping is disabled
+	alertPoster   *alert.Poster     // nil if alerts.endpoint is not set
+	enrollment    *enrollment       // nil if enroll.enabled is not set
+	httpConfig    sender.HTTPConfig
 }
 
-// initSender creates and configures the appropriate sender based on application mode.
-func initSender(cfg *config.Config) sender.Sender {
+// newSender creates and configures the appropriate sender based on
+// application mode. It has no side effects on the runtime; the result is
+// put to use with agentRuntime.useSenders.
+//
+// In production mode, the remote configuration poller, the alert poster
+// and the log shipper (if enabled) use the same transport settings and
+// credentials as the sender.
+func newSender(ctx context.Context, cfg *config.Config, rt *agentRuntime) (*senderSet, error) {
 	if cfg.Mode == config.ModeDevelopment {
 		// Use mock sender in development mode
 		mockConfig := sender.DefaultMockConfig()
 		log.Info().Msg("🧪 Initializing mock sender for development")
-		return sender.NewMockSender(mockConfig)
+		return &senderSet{sender: sender.NewMockSender(mockConfig)}, nil
 	}
 
 	// Use HTTP sender in production mode
-	httpConfig := sender.HTTPConfig{
-		MaxRetries:        cfg.Sender.MaxRetries,
-		InitialRetryDelay: cfg.Sender.InitialRetryDelay,
-		MaxRetryDelay:     cfg.Sender.MaxRetryDelay,
-		RequestTimeout:    cfg.Sender.RequestTimeout,
-		ClientTimeout:     cfg.Sender.ClientTimeout,
+	httpConfig := newHTTPConfig(cfg)
+	httpConfig.Stats = rt.senderStats
+
+	if cfg.Core.Signing.Enabled {
+		key, err := agentkey.Load(state.Dir(cfg.Agent.StateDir))
+		if err != nil {
+			return nil, err
+		}
+		httpConfig.Signer = signature.NewSigner(key)
+		log.Info().Str("key_id", httpConfig.Signer.KeyID()).Msg("🔏 Signing payloads")
+	}
+
+	if cfg.Core.Encryption.Enabled {
+		key, err := sealedbox.ParsePublicKey(cfg.Core.Encryption.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		sealer := sealedbox.NewSealer(key, cfg.Core.Encryption.KeyID)
+		httpConfig.Encoder = sender.EncoderFunc(sealer.Seal)
+		log.Info().Str("key_id", sealer.KeyID()).Msg("🔐 Encrypting payloads")
+	}
+
+	var tokens sender.TokenSource
+	enrolled := rt.enrollment
+	if cfg.Enroll.Enabled {
+		if enrolled == nil {
+			var err error
+			if enrolled, err = newEnrollment(ctx, cfg, &httpConfig); err != nil {
+				return nil, err
+			}
+		} else if enrolled.changed(enrollSettings(cfg, &httpConfig)) {
+			log.Warn().Msg("Enrollment settings changed, restart the agent to enroll again")
+		}
+		enrolled.use(&httpConfig)
+		tokens = enrolled.enroller
+	} else {
+		var err error
+		if tokens, err = newTokenSource(cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	if rt.remote != nil {
+		// Pick up configuration documents embedded in Core responses
+		httpConfig.ResponseHandler = rt.remote.HandleResponse
 	}
 
 	log.Info().
 		Str("endpoint", cfg.Core.Endpoint).
 		Int("max_retries", httpConfig.MaxRetries).
 		Dur("request_timeout", httpConfig.RequestTimeout).
+		Bool("mtls", httpConfig.TLS.CertFile != "").
+		Bool("proxy", httpConfig.Proxy.URL != "").
+		Bool("signing", httpConfig.Signer != nil).
+		Bool("encryption", httpConfig.Encoder != nil).
 		Msg("📤 Initializing HTTP sender")
 
-	return sender.NewHTTPSender(cfg.Core.Endpoint, cfg.Core.Token, httpConfig)
+	httpSender, err := sender.NewHTTPSender(cfg.Core.Endpoint, tokens, httpConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	set := &senderSet{
+		sender:     httpSender,
+		tokens:     tokens,
+		enrollment: enrolled,
+		httpConfig: httpConfig,
+	}
+
+	// Each endpoint gets its own transport, as the server certificate is
+	// verified against the endpoint host
+	if rt.remote != nil && rt.remote.Endpoint() != "" {
+		if set.pollTransport, err = sender.NewTransport(rt.remote.Endpoint(), httpConfig.TLS, httpConfig.Proxy); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.Log.Ship.Enabled {
+		if set.shipTransport, err = sender.NewTransport(cfg.Log.Ship.Endpoint, httpConfig.TLS, httpConfig.Proxy); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.Alerts.Endpoint != "" {
+		transport, err := sender.NewTransport(cfg.Alerts.Endpoint, httpConfig.TLS, httpConfig.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		set.alertPoster = alert.NewPoster(cfg.Alerts.Endpoint, transport, tokens, httpConfig.Encoder, httpConfig.RequestTimeout)
+	}
+
+	if cfg.Sender.Breaker.Enabled {
+		// Wrap HTTP sender with a circuit breaker to fail fast while Core is down
+		set.sender = sender.NewCircuitBreaker(httpSender, sender.BreakerConfig{
+			FailureThreshold: cfg.Sender.Breaker.FailureThreshold,
+			CoolDown:         cfg.Sender.Breaker.CoolDown,
+			Stats:            rt.senderStats,
+		})
+	}
+
+	return set, nil
+}
+
+// newHTTPConfig converts configuration into HTTP sender settings.
+func newHTTPConfig(cfg *config.Config) sender.HTTPConfig {
+	return sender.HTTPConfig{
+		MaxRetries:        cfg.Sender.MaxRetries,
+		InitialRetryDelay: cfg.Sender.InitialRetryDelay,
+		MaxRetryDelay:     cfg.Sender.MaxRetryDelay,
+		RequestTimeout:    cfg.Sender.RequestTimeout,
+		ClientTimeout:     cfg.Sender.ClientTimeout,
+		TLS: sender.TLSConfig{
+			CAFile:     cfg.Core.TLS.CAFile,
+			CertFile:   cfg.Core.TLS.CertFile,
+			KeyFile:    cfg.Core.TLS.KeyFile,
+			MinVersion: cfg.Core.TLS.MinVersion,
+			ServerName: cfg.Core.TLS.ServerName,
+			PinnedSPKI: cfg.Core.TLS.PinnedSPKI,
+		},
+		Proxy: proxyConfig(cfg),
+	}
+}
+
+// newTokenSource creates the token source for authenticating against Core
+// without enrollment: a token file is re-read whenever it changes,
+// otherwise the static token is used.
+func newTokenSource(cfg *config.Config) (sender.TokenSource, error) {
+	if cfg.Core.TokenFile == "" {
+		return sender.StaticToken(cfg.Core.Token), nil
+	}
+
+	tokens, err := sender.NewFileTokenSource(cfg.Core.TokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load token file %s: %w", cfg.Core.TokenFile, err)
+	}
+
+	return tokens, nil
+}
+
+// enrollment is the agent's enrollment with Core. It is done once at
+// startup and reused whenever the sender is rebuilt; the enroller renews
+// the credential itself, so enroll.* changes take effect on restart.
+type enrollment struct {
+	enroller       *enroll.Enroller
+	settings       enroll.Config
+	hasCertificate bool
+}
+
+// newEnrollment enrolls the agent (blocking until enrolled or shut down)
+// or loads its stored credential.
+func newEnrollment(ctx context.Context, cfg *config.Config, httpConfig *sender.HTTPConfig) (*enrollment, error) {
+	transport, err := sender.NewTransport(cfg.Enroll.Endpoint, httpConfig.TLS, httpConfig.Proxy)
+	if err != nil {
+		return nil, err
+	}
+
+	settings := enrollSettings(cfg, httpConfig)
+	enroller := enroll.New(settings, transport)
+
+	creds, err := enroller.Ensure(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to enroll agent via %s: %w", cfg.Enroll.Endpoint, err)
+	}
+
+	return &enrollment{
+		enroller:       enroller,
+		settings:       settings,
+		hasCertificate: creds.HasCertificate,
+	}, nil
+}
+
+// use points the TLS settings at the issued client certificate, if any,
+// which is preferred over a configured one.
+func (e *enrollment) use(httpConfig *sender.HTTPConfig) {
+	if e.hasCertificate {
+		httpConfig.TLS.CertFile = e.enroller.CertFile()
+		httpConfig.TLS.KeyFile = e.enroller.KeyFile()
+	}
+}
+
+// changed reports whether settings would enroll the agent differently
+// (timing settings aside).
+func (e *enrollment) changed(settings enroll.Config) bool {
+	return e.settings.Endpoint != settings.Endpoint ||
+		e.settings.BootstrapToken != settings.BootstrapToken ||
+		e.settings.AgentName != settings.AgentName ||
+		e.settings.StateDir != settings.StateDir ||
+		!e.settings.PublicKey.Equal(settings.PublicKey)
+}
+
+// enrollSettings returns the enrollment settings, publishing the payload
+// signing key if signing is enabled.
+func enrollSettings(cfg *config.Config, httpConfig *sender.HTTPConfig) enroll.Config {
+	settings := enrollConfig(cfg)
+	if httpConfig.Signer != nil {
+		settings.PublicKey = httpConfig.Signer.PublicKey()
+	}
+	return settings
+}
+
+// enrollConfig converts configuration into enrollment settings.
+func enrollConfig(cfg *config.Config) enroll.Config {
+	return enroll.Config{
+		Endpoint:          cfg.Enroll.Endpoint,
+		BootstrapToken:    cfg.Enroll.BootstrapToken,
+		AgentName:         cfg.Agent.Name,
+		StateDir:          state.Dir(cfg.Agent.StateDir),
+		RequestTimeout:    cfg.Sender.RequestTimeout,
+		InitialRetryDelay: cfg.Sender.InitialRetryDelay,
+		MaxRetryDelay:     cfg.Sender.MaxRetryDelay,
+		MinInterval:       cfg.Enroll.MinInterval,
+	}
+}
+
+// proxyConfig converts proxy configuration into sender settings.
+// It is shared by every HTTP-based sender.
+func proxyConfig(cfg *config.Config) sender.ProxyConfig {
+	return sender.ProxyConfig{
+		URL:             cfg.Proxy.URL,
+		FromEnvironment: cfg.Proxy.FromEnvironment,
+		NoProxy:         cfg.Proxy.NoProxy,
+	}
 }
 
 // logStartup logs essential startup metadata such as agent Name,
 // version and collection interval.
 func logStartup(cfg *config.Config) {
 	log.Info().
-		Str("version", "0.1.1").
+		Str("version", version.Version).
 		Str("agent_name", cfg.Agent.Name).
 		Dur("interval", cfg.Agent.Interval).
+		Bool("align", cfg.Agent.Align).
 		Str("mode", cfg.Mode).
 		Msg("🚀 Starting Dideban Agent")
 }
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"dideban-agent/internal/config"
+	"dideban-agent/internal/remoteconfig"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// reloadDebounce groups bursts of file events (editors often write a
+// file in several steps) into a single reload.
+const reloadDebounce = 500 * time.Millisecond
+
+// configReloader re-runs the configuration pipeline on request and hands
+// valid configurations to the agent loop. An invalid configuration is
+// rejected and the agent keeps running on the current one.
+type configReloader struct {
+	mu      sync.Mutex
+	remote  *remoteconfig.Manager
+	updates configUpdates
+}
+
+// reload loads and validates the configuration, then queues it for the
+// agent loop. The trigger is only used for logging.
+func (r *configReloader) reload(trigger string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	log.Info().Str("trigger", trigger).Msg("🔄 Reloading configuration")
+
+	var (
+		cfg *config.Config
+		err error
+	)
+
+	// Re-apply the current remote configuration on top of the new local one
+	if r.remote != nil {
+		cfg, err = r.remote.Rebuild()
+	} else {
+		cfg, err = config.Load()
+	}
+
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("Configuration reload rejected, keeping current configuration")
+		return
+	}
+
+	r.updates.push(cfg)
+}
+
+// setupReloadHandlers triggers a configuration reload on every SIGHUP
+// received on hangups (see setupSignalHandlers) and, if
+// agent.watch_config is enabled, whenever the configuration file changes.
+func setupReloadHandlers(ctx context.Context, cfg *config.Config, hangups <-chan os.Signal, reloader *configReloader) {
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hangups:
+				reloader.reload("SIGHUP")
+			}
+		}
+	}()
+
+	if !cfg.Agent.WatchConfig {
+		return
+	}
+
+	if cfg.File == "" {
+		log.Warn().Msg("agent.watch_config is enabled but no configuration file is in use")
+		return
+	}
+
+	if err := watchConfigFile(ctx, cfg.File, reloader.reload); err != nil {
+		log.Warn().Err(err).Str("file", cfg.File).Msg("Failed to watch configuration file")
+	}
+}
+
+// watchConfigFile calls reload whenever the content of the file changes.
+//
+// The parent directory is watched rather than the file itself, so that
+// atomic replacements (editors, Kubernetes ConfigMap symlink swaps) are
+// detected. Events are debounced and only a content change triggers a reload.
+func watchConfigFile(ctx context.Context, path string, reload func(trigger string)) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		_ = watcher.Close()
+		return err
+	}
+
+	lastHash := fileHash(path)
+
+	go func() {
+		defer watcher.Close()
+
+		debounce := time.NewTimer(reloadDebounce)
+		debounce.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+
+			case _, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				debounce.Reset(reloadDebounce)
+
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Warn().Err(err).Msg("Configuration file watcher error")
+
+			case <-debounce.C:
+				hash := fileHash(path)
+				if hash == nil || bytes.Equal(hash, lastHash) {
+					continue
+				}
+				lastHash = hash
+				reload("file change")
+			}
+		}
+	}()
+
+	log.Info().Str("file", path).Msg("👀 Watching configuration file for changes")
+	return nil
+}
+
+// fileHash returns the SHA-256 of the file content, or nil if it cannot be read.
+func fileHash(path string) []byte {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"runtime"
+	"runtime/debug"
+
+	"dideban-agent/internal/config"
+)
+
+// defaultMemoryLimit is the memory limit the agent was started with
+// (GOMEMLIMIT, or none).
+var defaultMemoryLimit = debug.SetMemoryLimit(-1)
+
+// applyResources applies the memory limit and GOMAXPROCS from
+// resources.*. Unset values restore the Go defaults, so both can be
+// changed at runtime.
+func applyResources(cfg *config.Config) {
+	limit := defaultMemoryLimit
+	if cfg.Resources.MemoryLimitMB > 0 {
+		limit = int64(cfg.Resources.MemoryLimitMB) << 20
+	}
+	debug.SetMemoryLimit(limit)
+
+	if cfg.Resources.MaxProcs > 0 {
+		runtime.GOMAXPROCS(cfg.Resources.MaxProcs)
+	} else {
+		runtime.SetDefaultGOMAXPROCS()
+	}
+
+	if cfg.Resources.MemoryLimitMB > 0 || cfg.Resources.MaxProcs > 0 || cfg.Resources.CPUBudget > 0 {
+		log.Info().
+			Int("memory_limit_mb", cfg.Resources.MemoryLimitMB).
+			Int("max_procs", runtime.GOMAXPROCS(0)).
+			Dur("cpu_budget", cfg.Resources.CPUBudget).
+			Msg("⚖️ Resource limits applied")
+	}
+}
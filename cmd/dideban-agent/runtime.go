@@ -0,0 +1,424 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"time"
+
+	"dideban-agent/internal/alert"
+	"dideban-agent/internal/collector"
+	"dideban-agent/internal/config"
+	"dideban-agent/internal/logger"
+	"dideban-agent/internal/logship"
+	"dideban-agent/internal/notify"
+	"dideban-agent/internal/payload"
+	"dideban-agent/internal/queue"
+	"dideban-agent/internal/remoteconfig"
+	"dideban-agent/internal/schedule"
+	"dideban-agent/internal/sender"
+	"dideban-agent/internal/status"
+	"dideban-agent/internal/version"
+)
+
+// agentRuntime holds the components of a running agent that can be
+// replaced when a new configuration is applied.
+//
+// It is owned by the agent loop goroutine; other goroutines hand over
+// new configurations through configUpdates instead of touching it.
+type agentRuntime struct {
+	cfg        *config.Config
+	configHash string
+	started    time.Time
+	collector  collector.Source
+	sender     sender.Sender
+	queue      *queue.Queue
+	schedule   *schedule.Schedule
+	status     *status.Server // nil if the status API is disabled
+	remote     *remoteconfig.Manager
+	alerts     *alert.Evaluator
+	notifier   *notify.Dispatcher
+
+	// Reports readiness and liveness to systemd
+	service     *serviceManager
+	lastCollect time.Time
+
+	// Sender counters, kept across sender rebuilds
+	senderStats *sender.Stats
+
+	// Enrollment done at startup (nil if enroll.enabled was not set)
+	enrollment *enrollment
+
+	// Posts alert events immediately (nil if alerts.endpoint is not set)
+	alertPoster *alert.Poster
+
+	// Ships the agent's own logs to Core (nil if log.ship is disabled)
+	logShipper *logship.Shipper
+
+	// Restrictions applied at startup (nil if sandboxing is disabled)
+	sandbox *payload.SandboxStats
+
+	// Cancels the remote configuration poller
+	stopPolling context.CancelFunc
+}
+
+// apply switches the agent to a new configuration and reports whether
+// the collection schedule changed.
+//
+// Components that can fail to build (collectors, alert rules, notification
+// channels, sender) are created
+// first; if any of them fails, the new configuration is rejected, the
+// error is returned and the agent keeps running on the old one.
+func (rt *agentRuntime) apply(ctx context.Context, cfg *config.Config) (bool, error) {
+	old := rt.cfg
+
+	newCollector, err := rt.rebuildCollector(cfg)
+	if err != nil {
+		log.Error().Err(err).Msg("Configuration rejected, failed to initialize collectors")
+		return false, fmt.Errorf("failed to initialize collectors: %w", err)
+	}
+
+	newAlerts, err := rt.rebuildAlerts(cfg)
+	if err != nil {
+		log.Error().Err(err).Msg("Configuration rejected, invalid alert rules")
+		return false, fmt.Errorf("invalid alert rules: %w", err)
+	}
+
+	newNotifier, err := rt.rebuildNotifier(cfg)
+	if err != nil {
+		log.Error().Err(err).Msg("Configuration rejected, failed to initialize notification channels")
+		return false, fmt.Errorf("failed to initialize notification channels: %w", err)
+	}
+
+	newSenders, err := rt.rebuildSender(ctx, cfg)
+	if err != nil {
+		if newNotifier != nil {
+			newNotifier.Close()
+		}
+		log.Error().Err(err).Msg("Configuration rejected, failed to initialize sender")
+		return false, fmt.Errorf("failed to initialize sender: %w", err)
+	}
+
+	// Everything below cannot fail
+	if newCollector != nil {
+		rt.setCollector(ctx, newCollector)
+		log.Info().Strs("collectors", newCollector.Names()).Msg("Collectors updated")
+	}
+
+	if newAlerts != nil {
+		rt.alerts = newAlerts
+		log.Info().Int("rules", len(cfg.Alerts.Rules)).Msg("Alert rules updated")
+	}
+
+	if newNotifier != nil {
+		// Pending notifications are delivered in the background; Close
+		// waits for them, which can take several channel timeouts
+		go rt.notifier.Close()
+		rt.notifier = newNotifier
+		log.Info().Int("channels", len(cfg.Notify.Channels)).Msg("Notification channels updated")
+	}
+
+	if newSenders != nil {
+		// Queued snapshots are kept and delivered through the new sender
+		old := rt.queue.SetSender(newSenders.sender, newSenders.tokens)
+		if err := old.Close(); err != nil {
+			log.Warn().Err(err).Msg("Failed to close previous sender")
+		}
+		rt.sender = newSenders.sender
+		rt.useSenders(ctx, cfg, newSenders)
+	}
+
+	if !reflect.DeepEqual(old.Log, cfg.Log) || !slices.Equal(old.Redact.Patterns, cfg.Redact.Patterns) {
+		initLogger(cfg)
+	}
+
+	if old.Resources.MemoryLimitMB != cfg.Resources.MemoryLimitMB || old.Resources.MaxProcs != cfg.Resources.MaxProcs {
+		applyResources(cfg)
+	}
+
+	// These settings are only read at startup
+	if old.Agent.StateDir != cfg.Agent.StateDir ||
+		old.Agent.WatchConfig != cfg.Agent.WatchConfig ||
+		!reflect.DeepEqual(old.Queue, cfg.Queue) ||
+		old.Status != cfg.Status ||
+		!reflect.DeepEqual(old.RemoteConfig, cfg.RemoteConfig) ||
+		!reflect.DeepEqual(old.Sandbox, cfg.Sandbox) {
+		log.Warn().Msg("Changes to agent.state_dir, agent.watch_config, queue, status, remote_config and sandbox take effect after a restart")
+	}
+
+	rt.cfg = cfg
+	rt.configHash = cfg.Hash()
+
+	log.Info().
+		Dur("interval", cfg.Agent.Interval).
+		Msg("⚙️ Configuration applied")
+
+	return scheduleConfig(old) != scheduleConfig(cfg), nil
+}
+
+// rebuildCollector creates a new collector if the collector set or the
+// sampling settings changed, or returns nil if the current one can be kept.
+func (rt *agentRuntime) rebuildCollector(cfg *config.Config) (collector.Source, error) {
+	old := rt.cfg
+
+	unchanged := slices.Equal(old.EnabledCollectors(), cfg.EnabledCollectors()) &&
+		reflect.DeepEqual(old.Collectors.Sampling, cfg.Collectors.Sampling) &&
+		old.Resources.CPUBudget == cfg.Resources.CPUBudget &&
+		old.Resources.Backoff == cfg.Resources.Backoff &&
+		// The sample buffer is sized for the collection interval
+		(!cfg.Collectors.Sampling.Enabled || old.Agent.Interval == cfg.Agent.Interval)
+
+	if unchanged {
+		return nil, nil
+	}
+	return newCollector(cfg)
+}
+
+// setCollector replaces the collector, stopping background sampling of
+// the previous one and starting it for the new one.
+func (rt *agentRuntime) setCollector(ctx context.Context, source collector.Source) {
+	if sampler, ok := rt.collector.(*collector.Sampler); ok {
+		sampler.Close()
+	}
+
+	if sampler, ok := source.(*collector.Sampler); ok {
+		sampler.Start(ctx)
+	}
+
+	rt.collector = source
+}
+
+// rebuildAlerts compiles the alert rules if they changed, or returns nil
+// if the current evaluator can be kept.
+func (rt *agentRuntime) rebuildAlerts(cfg *config.Config) (*alert.Evaluator, error) {
+	if reflect.DeepEqual(rt.cfg.Alerts.Rules, cfg.Alerts.Rules) {
+		return nil, nil
+	}
+	return alert.NewEvaluator(cfg.Alerts.Rules, rt.alerts)
+}
+
+// rebuildNotifier creates new notification channels if their settings
+// changed, or returns nil if the current ones can be kept.
+func (rt *agentRuntime) rebuildNotifier(cfg *config.Config) (*notify.Dispatcher, error) {
+	old := rt.cfg
+
+	unchanged := old.Agent.Name == cfg.Agent.Name &&
+		reflect.DeepEqual(old.Notify, cfg.Notify) &&
+		reflect.DeepEqual(old.Proxy, cfg.Proxy)
+
+	if unchanged {
+		return nil, nil
+	}
+	return newNotifier(cfg)
+}
+
+// rebuildSender creates a new sender if any sender-related setting
+// changed, or returns nil if the current one can be kept.
+func (rt *agentRuntime) rebuildSender(ctx context.Context, cfg *config.Config) (*senderSet, error) {
+	old := rt.cfg
+
+	unchanged := old.Mode == cfg.Mode &&
+		reflect.DeepEqual(old.Core, cfg.Core) &&
+		reflect.DeepEqual(old.Enroll, cfg.Enroll) &&
+		reflect.DeepEqual(old.Sender, cfg.Sender) &&
+		reflect.DeepEqual(old.Proxy, cfg.Proxy) &&
+		old.Alerts.Endpoint == cfg.Alerts.Endpoint &&
+		old.Log.Ship == cfg.Log.Ship &&
+		// Shipped log batches carry the agent name
+		(!cfg.Log.Ship.Enabled || old.Agent.Name == cfg.Agent.Name)
+
+	if unchanged {
+		return nil, nil
+	}
+
+	// Enrolling blocks until Core accepts the agent, which must not
+	// happen on the agent loop
+	if cfg.Mode != config.ModeDevelopment && cfg.Enroll.Enabled && rt.enrollment == nil {
+		return nil, errors.New("enabling enroll.enabled requires a restart")
+	}
+
+	return newSender(ctx, cfg, rt)
+}
+
+// useSenders puts the components sharing the sender's settings to use:
+// the alert poster is replaced, the remote configuration poller restarted
+// and log shipping started, updated or stopped. It cannot fail.
+func (rt *agentRuntime) useSenders(ctx context.Context, cfg *config.Config, set *senderSet) {
+	rt.alertPoster = set.alertPoster
+	if set.enrollment != nil {
+		rt.enrollment = set.enrollment
+	}
+
+	if rt.stopPolling != nil {
+		rt.stopPolling()
+		rt.stopPolling = nil
+	}
+
+	// Development mode: nothing is sent to Core
+	if set.tokens == nil {
+		rt.stopLogShipper()
+		return
+	}
+
+	if set.pollTransport != nil {
+		pollCtx, cancel := context.WithCancel(ctx)
+		rt.stopPolling = cancel
+		go rt.remote.Run(pollCtx, set.pollTransport, set.tokens)
+	}
+
+	rt.setLogShipper(cfg, set)
+}
+
+// setLogShipper starts, updates or stops log shipping according to
+// log.ship with the given sender settings. Buffered entries are kept
+// when the settings change.
+func (rt *agentRuntime) setLogShipper(cfg *config.Config, set *senderSet) {
+	if !cfg.Log.Ship.Enabled {
+		rt.stopLogShipper()
+		return
+	}
+
+	httpConfig := set.httpConfig
+	shipConfig := logship.Config{
+		Endpoint:          cfg.Log.Ship.Endpoint,
+		AgentName:         cfg.Agent.Name,
+		Level:             logger.ParseLevel(cfg.Log.Ship.Level),
+		BufferSize:        cfg.Log.Ship.BufferSize,
+		BatchSize:         cfg.Log.Ship.BatchSize,
+		FlushInterval:     cfg.Log.Ship.FlushInterval,
+		MaxRetries:        cfg.Log.Ship.MaxRetries,
+		InitialRetryDelay: cfg.Log.Ship.InitialRetryDelay,
+		MaxRetryDelay:     cfg.Log.Ship.MaxRetryDelay,
+		RequestTimeout:    httpConfig.RequestTimeout,
+		Encoder:           httpConfig.Encoder,
+	}
+
+	if rt.logShipper != nil {
+		rt.logShipper.Update(shipConfig, set.shipTransport, set.tokens)
+		return
+	}
+
+	rt.logShipper = logship.New(shipConfig, set.shipTransport, set.tokens)
+	rt.logShipper.Start()
+	logger.SetRemote(rt.logShipper)
+
+	log.Info().
+		Str("endpoint", shipConfig.Endpoint).
+		Str("min_level", cfg.Log.Ship.Level).
+		Msg("📜 Log shipping enabled")
+}
+
+// stopLogShipper stops log shipping, if enabled, after a final attempt
+// to ship buffered entries.
+func (rt *agentRuntime) stopLogShipper() {
+	if rt.logShipper == nil {
+		return
+	}
+
+	logger.SetRemote(nil)
+	rt.logShipper.Close()
+	rt.logShipper = nil
+}
+
+// postAlerts posts alert events to the alert endpoint, if configured.
+// It does not block the agent loop.
+func (rt *agentRuntime) postAlerts(ctx context.Context, events []payload.AlertEvent) {
+	poster := rt.alertPoster
+	if poster == nil || len(events) == 0 {
+		return
+	}
+
+	go func() {
+		if err := poster.Post(ctx, events); err != nil && ctx.Err() == nil {
+			log.Warn().Err(err).Msg("Failed to post alert events")
+		}
+	}()
+}
+
+// agentStats reports the state of the agent itself.
+func (rt *agentRuntime) agentStats() *collector.AgentStats {
+	stats := &collector.AgentStats{
+		Version:    version.Version,
+		ConfigHash: rt.configHash,
+		Uptime:     int64(time.Since(rt.started).Seconds()),
+		Collectors: rt.collector.Stats(),
+		Queue:      rt.queue.Stats(),
+		Schedule:   rt.schedule.Stats(),
+		Sandbox:    rt.sandbox,
+	}
+
+	if rt.logShipper != nil {
+		stats.Logs = rt.logShipper.Stats()
+	}
+
+	process, err := collector.CollectProcess()
+	if err != nil {
+		log.Debug().Err(err).Msg("Failed to read agent process usage")
+	}
+	stats.Process = process
+
+	// The mock sender does not count anything
+	if rt.cfg.Mode != config.ModeDevelopment {
+		stats.Sender = rt.senderStats.Snapshot()
+		if breaker, ok := rt.sender.(*sender.CircuitBreaker); ok {
+			stats.Sender.Breaker = breaker.Stats()
+		}
+	}
+
+	return stats
+}
+
+// close releases resources held by the runtime.
+func (rt *agentRuntime) close() {
+	if rt.stopPolling != nil {
+		rt.stopPolling()
+	}
+
+	if err := rt.sender.Close(); err != nil {
+		log.Warn().Err(err).Msg("Failed to close sender")
+	}
+
+	rt.notifier.Close()
+
+	// Last, so that shutdown warnings are shipped too
+	defer rt.stopLogShipper()
+
+	if rt.status != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		rt.status.Close(ctx)
+	}
+
+	if sampler, ok := rt.collector.(*collector.Sampler); ok {
+		sampler.Close()
+	}
+}
+
+// configUpdates delivers new configurations to the agent loop.
+// Only the most recent pending configuration is kept.
+type configUpdates chan *config.Config
+
+// newConfigUpdates creates an empty update channel.
+func newConfigUpdates() configUpdates {
+	return make(configUpdates, 1)
+}
+
+// push hands a configuration to the agent loop without blocking,
+// replacing any configuration that has not been applied yet.
+func (u configUpdates) push(cfg *config.Config) {
+	for {
+		select {
+		case u <- cfg:
+			return
+		default:
+		}
+
+		// Drop the stale pending configuration
+		select {
+		case <-u:
+		default:
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"path/filepath"
+
+	"dideban-agent/internal/collector"
+	"dideban-agent/internal/config"
+	"dideban-agent/internal/payload"
+	"dideban-agent/internal/sandbox"
+	"dideban-agent/internal/state"
+)
+
+// initSandbox drops privileges and restricts the process as configured
+// and returns what took effect, or nil if sandboxing is disabled. It runs
+// after everything that needs the initial privileges has been opened
+// (log files, listeners, keys). The state directory, if configured, is
+// handed to the sandbox user. The program terminates if the user switch fails, which
+// includes log and socket directories the user could not write.
+func initSandbox(cfg *config.Config) *payload.SandboxStats {
+	sandboxConfig := newSandboxConfig(cfg)
+	if !sandboxConfig.Enabled() {
+		return nil
+	}
+
+	// Landlock rules need existing paths
+	if cfg.Agent.StateDir != "" {
+		if err := state.Dir(cfg.Agent.StateDir).Ensure(); err != nil {
+			log.Warn().Err(err).Msg("Failed to create state directory")
+		}
+	}
+
+	report, err := sandbox.Apply(sandboxConfig)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to apply sandbox")
+	}
+
+	event := log.Info()
+	if len(report.Errors) > 0 {
+		event = log.Warn().Strs("not_applied", report.Errors)
+	}
+	event.
+		Int("uid", report.UID).
+		Int("gid", report.GID).
+		Strs("capabilities", report.Capabilities).
+		Bool("no_new_privs", report.NoNewPrivs).
+		Int("landlock_abi", report.LandlockABI).
+		Msg("🛡️ Sandbox applied")
+
+	return report
+}
+
+// newSandboxConfig builds the sandbox configuration. Under Landlock, the
+// agent keeps read access to system files, its configuration and the
+// paths the enabled collectors read, write access to its state, log and
+// socket directories, and can execute system binaries and exec
+// notification commands.
+func newSandboxConfig(cfg *config.Config) sandbox.Config {
+	sandboxConfig := sandbox.Config{
+		User:         cfg.Sandbox.User,
+		Group:        cfg.Sandbox.Group,
+		Capabilities: cfg.Sandbox.Capabilities,
+		NoNewPrivs:   cfg.Sandbox.NoNewPrivs,
+		Landlock:     cfg.Sandbox.Landlock.Enabled,
+	}
+
+	if cfg.Agent.StateDir != "" {
+		sandboxConfig.OwnedDirs = []string{cfg.Agent.StateDir}
+	}
+
+	// Log and socket directories may be shared, so they are not handed over
+	if cfg.Log.File.Path != "" {
+		sandboxConfig.WritableDirs = append(sandboxConfig.WritableDirs, filepath.Dir(cfg.Log.File.Path))
+	}
+	if cfg.Status.Enabled && cfg.Status.Socket != "" {
+		sandboxConfig.WritableDirs = append(sandboxConfig.WritableDirs, filepath.Dir(cfg.Status.Socket))
+	}
+
+	if !sandboxConfig.Landlock {
+		return sandboxConfig
+	}
+
+	// System files: name resolution, CA certificates, time zones
+	read := []string{"/etc", "/usr/share", "/proc"}
+	read = append(read, collector.Paths(cfg.EnabledCollectors()...)...)
+	for _, file := range []string{cfg.File, cfg.Core.TokenFile, cfg.Core.TLS.CAFile, cfg.Core.TLS.CertFile, cfg.Core.TLS.KeyFile} {
+		if file != "" {
+			// Directories, as files are replaced when they are updated
+			read = append(read, filepath.Dir(file))
+		}
+	}
+	sandboxConfig.ReadPaths = append(read, cfg.Sandbox.Landlock.ReadPaths...)
+
+	write := append([]string{"/dev/null"}, sandboxConfig.OwnedDirs...)
+	write = append(write, sandboxConfig.WritableDirs...)
+	sandboxConfig.WritePaths = append(write, cfg.Sandbox.Landlock.WritePaths...)
+
+	exec := []string{"/usr/bin", "/usr/sbin", "/usr/lib", "/usr/lib64", "/bin", "/sbin", "/lib", "/lib64"}
+	for _, channel := range cfg.Notify.Channels {
+		if channel.Type == config.ChannelExec && len(channel.Command) > 0 && filepath.IsAbs(channel.Command[0]) {
+			exec = append(exec, filepath.Dir(channel.Command[0]))
+		}
+	}
+	sandboxConfig.ExecPaths = exec
+
+	return sandboxConfig
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"dideban-agent/internal/payload"
+	"dideban-agent/internal/systemd"
+)
+
+// serviceManager reports the agent state to systemd (Type=notify).
+// Notifications are no-ops when the agent was not started by systemd.
+type serviceManager struct {
+	ready  bool
+	status string
+
+	// Watchdog ping interval (half of WatchdogSec=), 0 if disabled
+	watchdog time.Duration
+}
+
+// newServiceManager reads the watchdog settings passed by systemd.
+func newServiceManager() *serviceManager {
+	m := &serviceManager{}
+
+	timeout, err := systemd.WatchdogInterval()
+	if err != nil {
+		log.Warn().Err(err).Msg("Ignoring systemd watchdog settings")
+	}
+
+	if timeout > 0 {
+		m.watchdog = timeout / 2
+		log.Info().Dur("timeout", timeout).Msg("systemd watchdog enabled")
+	}
+
+	return m
+}
+
+// collected reports a finished collection. The agent is ready after its
+// first collection in which at least one collector succeeded; the status
+// line reflects the latest send result.
+func (m *serviceManager) collected(succeeded bool, queue *payload.QueueStats) {
+	var states []string
+
+	if succeeded && !m.ready {
+		states = append(states, systemd.Ready)
+	}
+
+	status := sendStatus(queue)
+	if status != m.status {
+		states = append(states, systemd.Status(status))
+	}
+
+	if len(states) == 0 {
+		return
+	}
+
+	notified, err := systemd.Notify(states...)
+	if err != nil {
+		log.Debug().Err(err).Msg("Failed to notify systemd")
+		return
+	}
+
+	if notified && succeeded {
+		m.ready = true
+	}
+	m.status = status
+}
+
+// stopping reports that the agent is shutting down.
+func (m *serviceManager) stopping() {
+	if _, err := systemd.Notify(systemd.Stopping, systemd.Status("Flushing pending metrics")); err != nil {
+		log.Debug().Err(err).Msg("Failed to notify systemd")
+	}
+}
+
+// pingWatchdog tells systemd the agent loop is alive.
+func (m *serviceManager) pingWatchdog() {
+	if _, err := systemd.Notify(systemd.Watchdog); err != nil {
+		log.Debug().Err(err).Msg("Failed to ping systemd watchdog")
+	}
+}
+
+// sendStatus summarizes the queue state for systemctl status.
+func sendStatus(queue *payload.QueueStats) string {
+	depth := fmt.Sprintf("queue %d/%d", queue.Depth, queue.Capacity)
+	if queue.Spilled > 0 {
+		depth += fmt.Sprintf(", %d spilled", queue.Spilled)
+	}
+
+	switch {
+	case queue.LastError != "":
+		return fmt.Sprintf("Send failing: %s; %s", queue.LastError, depth)
+	case queue.LastSent > 0:
+		return fmt.Sprintf("Last send %s OK; %s", time.UnixMilli(queue.LastSent).Format(time.TimeOnly), depth)
+	default:
+		return "Waiting for first send; " + depth
+	}
+}
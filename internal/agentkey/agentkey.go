@@ -0,0 +1,71 @@
+package agentkey
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"dideban-agent/internal/logger"
+	"dideban-agent/internal/state"
+)
+
+// log is the logger of the agent component.
+var log = logger.New("agent")
+
+// keyFile is the state directory file holding the signing key.
+const keyFile = "signing.key"
+
+// Load returns the agent's Ed25519 signing key, generating and storing it
+// (PKCS #8 PEM, 0600) on first use. The key never leaves the state
+// directory; only its public half is published (during enrollment).
+func Load(dir state.Dir) (ed25519.PrivateKey, error) {
+	data, err := dir.ReadFile(keyFile)
+	if err == nil {
+		return parse(data)
+	}
+
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("agentkey: failed to read %s: %w", keyFile, err)
+	}
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("agentkey: failed to generate key: %w", err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("agentkey: failed to encode key: %w", err)
+	}
+
+	if err := dir.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})); err != nil {
+		return nil, fmt.Errorf("agentkey: %w", err)
+	}
+
+	log.Info().Str("path", dir.Path(keyFile)).Msg("🔏 Generated payload signing key")
+	return key, nil
+}
+
+// parse decodes a PEM-encoded Ed25519 private key.
+func parse(data []byte) (ed25519.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("agentkey: %s is not a PEM private key", keyFile)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("agentkey: failed to parse %s: %w", keyFile, err)
+	}
+
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("agentkey: %s is not an Ed25519 key", keyFile)
+	}
+
+	return edKey, nil
+}
@@ -0,0 +1,262 @@
+package alert
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"dideban-agent/internal/collector"
+	"dideban-agent/internal/config"
+	"dideban-agent/internal/logger"
+	"dideban-agent/internal/payload"
+)
+
+// log is the logger of the alert component.
+var log = logger.New("alert")
+
+// Rule is a compiled alerting rule.
+type Rule struct {
+	Name     string
+	Severity string
+	Labels   map[string]string
+
+	// Dotted metric path, e.g. "disk.usage_percent"
+	Metric string
+
+	// Comparison operator: >, >=, <, <=, ==, !=
+	Operator string
+
+	// Threshold the metric is compared against to fire
+	Threshold float64
+
+	// Threshold the metric is compared against while firing;
+	// the alert resolves once the comparison no longer holds
+	Resolve float64
+
+	// How long the condition must hold before the alert fires
+	For time.Duration
+
+	field collector.NumericField
+}
+
+// ruleState tracks the state of a single rule across evaluations.
+type ruleState struct {
+	rule *Rule
+
+	// Time the condition started to hold (zero if it does not)
+	since time.Time
+
+	firing bool
+}
+
+// Evaluator evaluates alerting rules against metric snapshots and
+// reports state transitions. It is not safe for concurrent use.
+type Evaluator struct {
+	rules []*ruleState
+}
+
+// NewEvaluator compiles the configured rules.
+//
+// The state of rules that are unchanged in prev (same name and
+// definition) is carried over, so reloading the configuration neither
+// re-fires nor silently drops active alerts. prev may be nil.
+func NewEvaluator(rules []config.AlertRule, prev *Evaluator) (*Evaluator, error) {
+	e := &Evaluator{}
+
+	for _, cfg := range rules {
+		rule, err := compile(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("alert rule %s: %w", cfg.Name, err)
+		}
+
+		state := &ruleState{rule: rule}
+		if old := prev.find(rule.Name); old != nil && old.rule.equal(rule) {
+			state.since = old.since
+			state.firing = old.firing
+		}
+
+		e.rules = append(e.rules, state)
+	}
+
+	return e, nil
+}
+
+// Validate compiles the rules and returns the error of the first invalid
+// one. Unlike configuration validation, it checks that every metric path
+// names a numeric field of the collector snapshot.
+func Validate(rules []config.AlertRule) error {
+	_, err := NewEvaluator(rules, nil)
+	return err
+}
+
+// Evaluate checks every rule against the snapshot and returns the
+// firing and resolved transitions. Rules on the collectors in failed
+// (failed or backed off) are skipped, keeping their current state.
+func (e *Evaluator) Evaluate(m *collector.Metrics, failed []string) []payload.AlertEvent {
+	now := time.UnixMilli(m.Timestamp)
+
+	var events []payload.AlertEvent
+
+	for _, state := range e.rules {
+		rule := state.rule
+
+		if slices.Contains(failed, rule.field.Collector()) {
+			continue
+		}
+
+		value := rule.field.Value(m)
+
+		// While firing, the resolve threshold applies (hysteresis)
+		threshold := rule.Threshold
+		if state.firing {
+			threshold = rule.Resolve
+		}
+		holds := compare(value, rule.Operator, threshold)
+
+		switch {
+		case holds && state.since.IsZero():
+			state.since = now
+		case !holds:
+			if state.firing {
+				events = append(events, state.event(payload.AlertResolved, value, threshold, now))
+				state.firing = false
+			}
+			state.since = time.Time{}
+			continue
+		}
+
+		if !state.firing && now.Sub(state.since) >= rule.For {
+			state.firing = true
+			events = append(events, state.event(payload.AlertFiring, value, threshold, now))
+		}
+	}
+
+	for _, event := range events {
+		logEvent(event)
+	}
+
+	return events
+}
+
+// Firing returns the names of the rules that are currently firing.
+func (e *Evaluator) Firing() []string {
+	var names []string
+	for _, state := range e.rules {
+		if state.firing {
+			names = append(names, state.rule.Name)
+		}
+	}
+	return names
+}
+
+// find returns the state of the named rule, or nil.
+func (e *Evaluator) find(name string) *ruleState {
+	if e == nil {
+		return nil
+	}
+	for _, state := range e.rules {
+		if state.rule.Name == name {
+			return state
+		}
+	}
+	return nil
+}
+
+// event creates an event for a transition of the rule.
+func (s *ruleState) event(state string, value, threshold float64, now time.Time) payload.AlertEvent {
+	return payload.AlertEvent{
+		Rule:      s.rule.Name,
+		State:     state,
+		Severity:  s.rule.Severity,
+		Metric:    s.rule.Metric,
+		Value:     value,
+		Threshold: threshold,
+		Labels:    s.rule.Labels,
+		Since:     s.since.UnixMilli(),
+		Timestamp: now.UnixMilli(),
+	}
+}
+
+// compile converts a configured rule into a Rule.
+func compile(cfg config.AlertRule) (*Rule, error) {
+	expr, err := config.ParseAlertExpr(cfg.Expr)
+	if err != nil {
+		return nil, err
+	}
+
+	field, err := collector.LookupField(expr.Metric)
+	if err != nil {
+		return nil, err
+	}
+
+	rule := &Rule{
+		Name:      cfg.Name,
+		Severity:  cfg.Severity,
+		Labels:    cfg.Labels,
+		Metric:    expr.Metric,
+		Operator:  expr.Operator,
+		Threshold: expr.Threshold,
+		Resolve:   expr.Threshold,
+		For:       expr.For,
+		field:     field,
+	}
+
+	if cfg.Resolve != nil {
+		rule.Resolve = *cfg.Resolve
+	}
+
+	return rule, nil
+}
+
+// equal reports whether two rules have the same definition.
+func (r *Rule) equal(other *Rule) bool {
+	return r.Name == other.Name &&
+		r.Severity == other.Severity &&
+		r.Metric == other.Metric &&
+		r.Operator == other.Operator &&
+		r.Threshold == other.Threshold &&
+		r.Resolve == other.Resolve &&
+		r.For == other.For &&
+		maps.Equal(r.Labels, other.Labels)
+}
+
+// compare applies the operator to value and threshold.
+func compare(value float64, operator string, threshold float64) bool {
+	switch operator {
+	case ">":
+		return value > threshold
+	case ">=":
+		return value >= threshold
+	case "<":
+		return value < threshold
+	case "<=":
+		return value <= threshold
+	case "==":
+		return value == threshold
+	case "!=":
+		return value != threshold
+	default:
+		return false
+	}
+}
+
+// logEvent logs an alert state transition.
+func logEvent(event payload.AlertEvent) {
+	if event.State == payload.AlertFiring {
+		log.Warn().
+			Str("rule", event.Rule).
+			Str("severity", event.Severity).
+			Str("metric", event.Metric).
+			Float64("value", event.Value).
+			Float64("threshold", event.Threshold).
+			Msg("🚨 Alert firing")
+		return
+	}
+
+	log.Info().
+		Str("rule", event.Rule).
+		Str("metric", event.Metric).
+		Float64("value", event.Value).
+		Msg("✅ Alert resolved")
+}
@@ -0,0 +1,225 @@
+package alert
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"dideban-agent/internal/collector"
+	"dideban-agent/internal/config"
+	"dideban-agent/internal/payload"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr bool
+	}{
+		{expr: "cpu.usage_percent > 90"},
+		{expr: "disk.usage_percent > 90 for 5m"},
+		{expr: "memory.available_mb < 500"},
+		{expr: "disk.no_such_field > 1", wantErr: true},
+		{expr: "nothing.usage_percent > 1", wantErr: true},
+		{expr: "cpu.usage_percent.more > 1", wantErr: true},
+		{expr: "cpu.usage_percent >> 1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			err := Validate([]config.AlertRule{{Name: "rule", Expr: tt.expr, Severity: "warning"}})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate(%q) error = %v, wantErr %v", tt.expr, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	resolve := func(v float64) *float64 { return &v }
+
+	// step is one evaluation: the snapshot is taken at the given offset
+	// (snapshot timestamps are the evaluator's clock)
+	type step struct {
+		at     time.Duration
+		value  float64
+		failed bool
+
+		// Expected transition ("" for none) and when its condition started
+		want  string
+		since time.Duration
+	}
+
+	tests := []struct {
+		name    string
+		rule    config.AlertRule
+		steps   []step
+		wantEnd bool // firing after the last step
+	}{
+		{
+			name: "fires immediately without for",
+			rule: config.AlertRule{Expr: "cpu.usage_percent > 90"},
+			steps: []step{
+				{at: 0, value: 50},
+				{at: time.Minute, value: 95, want: payload.AlertFiring, since: time.Minute},
+				{at: 2 * time.Minute, value: 95},
+			},
+			wantEnd: true,
+		},
+		{
+			name: "fires once the condition held for the duration",
+			rule: config.AlertRule{Expr: "cpu.usage_percent > 90 for 2m"},
+			steps: []step{
+				{at: 0, value: 95},
+				{at: time.Minute, value: 95},
+				{at: 2 * time.Minute, value: 95, want: payload.AlertFiring, since: 0},
+				{at: 3 * time.Minute, value: 95},
+			},
+			wantEnd: true,
+		},
+		{
+			name: "interruption restarts the duration",
+			rule: config.AlertRule{Expr: "cpu.usage_percent > 90 for 2m"},
+			steps: []step{
+				{at: 0, value: 95},
+				{at: time.Minute, value: 50},
+				{at: 2 * time.Minute, value: 95},
+				{at: 3 * time.Minute, value: 95},
+				{at: 4 * time.Minute, value: 95, want: payload.AlertFiring, since: 2 * time.Minute},
+			},
+			wantEnd: true,
+		},
+		{
+			name: "resolves below the firing threshold",
+			rule: config.AlertRule{Expr: "cpu.usage_percent > 90"},
+			steps: []step{
+				{at: 0, value: 95, want: payload.AlertFiring},
+				{at: time.Minute, value: 85, want: payload.AlertResolved},
+				{at: 2 * time.Minute, value: 85},
+			},
+		},
+		{
+			name: "keeps firing within the resolve band",
+			rule: config.AlertRule{Expr: "cpu.usage_percent > 90", Resolve: resolve(80)},
+			steps: []step{
+				{at: 0, value: 95, want: payload.AlertFiring},
+				{at: time.Minute, value: 85},
+				{at: 2 * time.Minute, value: 81},
+				{at: 3 * time.Minute, value: 80, want: payload.AlertResolved},
+				{at: 4 * time.Minute, value: 85},
+			},
+		},
+		{
+			name: "resolve band below the threshold for <",
+			rule: config.AlertRule{Expr: "memory.available_mb < 500", Resolve: resolve(600)},
+			steps: []step{
+				{at: 0, value: 400, want: payload.AlertFiring},
+				{at: time.Minute, value: 550},
+				{at: 2 * time.Minute, value: 650, want: payload.AlertResolved},
+			},
+		},
+		{
+			name: "failed collector keeps the state",
+			rule: config.AlertRule{Expr: "cpu.usage_percent > 90 for 1m"},
+			steps: []step{
+				{at: 0, value: 95},
+				{at: time.Minute, failed: true},
+				{at: 2 * time.Minute, value: 95, want: payload.AlertFiring, since: 0},
+				{at: 3 * time.Minute, failed: true},
+			},
+			wantEnd: true,
+		},
+	}
+
+	base := time.UnixMilli(1_700_000_000_000)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := tt.rule
+			rule.Name = "rule"
+			rule.Severity = "warning"
+
+			e, err := NewEvaluator([]config.AlertRule{rule}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			compiled := e.rules[0].rule
+
+			for _, step := range tt.steps {
+				m := &collector.Metrics{Timestamp: base.Add(step.at).UnixMilli()}
+				m.CPU.UsagePercent = step.value
+				m.Memory.AvailableMB = uint64(step.value)
+
+				var failed []string
+				if step.failed {
+					failed = []string{"cpu"}
+				}
+
+				events := e.Evaluate(m, failed)
+
+				var got string
+				if len(events) > 0 {
+					got = events[0].State
+				}
+				if len(events) > 1 || got != step.want {
+					t.Fatalf("at %v: Evaluate() = %+v, want %q", step.at, events, step.want)
+				}
+				if got == "" {
+					continue
+				}
+
+				event := events[0]
+				wantThreshold := compiled.Threshold
+				if got == payload.AlertResolved {
+					wantThreshold = compiled.Resolve
+				}
+				if event.Threshold != wantThreshold || event.Value != step.value {
+					t.Errorf("at %v: value %g, threshold %g, want %g and %g", step.at, event.Value, event.Threshold, step.value, wantThreshold)
+				}
+				if event.Timestamp != m.Timestamp {
+					t.Errorf("at %v: timestamp %d, want %d", step.at, event.Timestamp, m.Timestamp)
+				}
+				if got == payload.AlertFiring && event.Since != base.Add(step.since).UnixMilli() {
+					t.Errorf("at %v: since %d, want %d", step.at, event.Since, base.Add(step.since).UnixMilli())
+				}
+			}
+
+			if firing := slices.Contains(e.Firing(), "rule"); firing != tt.wantEnd {
+				t.Errorf("firing = %v after the last step, want %v", firing, tt.wantEnd)
+			}
+		})
+	}
+}
+
+func TestNewEvaluatorKeepsState(t *testing.T) {
+	rules := []config.AlertRule{{Name: "rule", Expr: "cpu.usage_percent > 90", Severity: "warning"}}
+
+	e, err := NewEvaluator(rules, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &collector.Metrics{Timestamp: time.Now().UnixMilli()}
+	m.CPU.UsagePercent = 95
+	e.Evaluate(m, nil)
+
+	// An unchanged rule keeps firing without a new event
+	reloaded, err := NewEvaluator(rules, e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(reloaded.Firing(), []string{"rule"}) {
+		t.Fatalf("Firing() after reload = %q", reloaded.Firing())
+	}
+	if events := reloaded.Evaluate(m, nil); len(events) != 0 {
+		t.Errorf("Evaluate() after reload = %+v, want no events", events)
+	}
+
+	// A changed rule starts over
+	rules[0].Expr = "cpu.usage_percent > 80"
+	changed, err := NewEvaluator(rules, e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changed.Firing()) != 0 {
+		t.Errorf("Firing() after changing the rule = %q, want none", changed.Firing())
+	}
+}
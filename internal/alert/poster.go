@@ -0,0 +1,82 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"dideban-agent/internal/payload"
+	"dideban-agent/internal/sender"
+	"dideban-agent/internal/version"
+)
+
+// Poster posts alert events to a Core endpoint as soon as they occur,
+// independently of the metrics payload.
+type Poster struct {
+	client   *http.Client
+	endpoint string
+	tokens   sender.TokenSource
+	encoder  sender.Encoder
+}
+
+// NewPoster creates a Poster. The transport, token source and encoder
+// (may be nil) should match the HTTP sender so that TLS, proxy,
+// authentication and encryption settings are identical.
+func NewPoster(endpoint string, transport http.RoundTripper, tokens sender.TokenSource, encoder sender.Encoder, timeout time.Duration) *Poster {
+	return &Poster{
+		client: &http.Client{
+			Timeout:   timeout,
+			Transport: transport,
+		},
+		endpoint: endpoint,
+		tokens:   tokens,
+		encoder:  encoder,
+	}
+}
+
+// Post sends the events in a single request ({"alerts": [...]}).
+// Delivery is attempted once; the events are also part of the next
+// metrics payload.
+func (p *Poster) Post(ctx context.Context, events []payload.AlertEvent) error {
+	body, err := json.Marshal(struct {
+		Alerts []payload.AlertEvent `json:"alerts"`
+	}{events})
+	if err != nil {
+		return fmt.Errorf("failed to marshal alert events: %w", err)
+	}
+
+	header, body, err := sender.EncodeJSON(p.encoder, body)
+	if err != nil {
+		return fmt.Errorf("failed to encode alert events: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header = header
+
+	token, err := p.tokens.Token()
+	if err != nil {
+		return fmt.Errorf("failed to get token: %w", err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	req.Header.Set("User-Agent", version.UserAgent())
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("server returned status %d", resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,121 @@
+package collector
+
+import (
+	"reflect"
+	"time"
+)
+
+// Budget limits the CPU time each collector may use per run.
+//
+// A collector that exceeds its share in After consecutive runs is backed
+// off: it only runs every second collection, then every fourth and so on,
+// up to every MaxFactor-th. Skipped collections report its previous
+// values. After consecutive runs within the share halve the backoff again.
+type Budget struct {
+	// CPU time per collector and run (0 = unlimited)
+	Share time.Duration
+
+	// Consecutive runs over (or within) the share before backing off
+	// (or recovering)
+	After int
+
+	// Longest backoff, in collections
+	MaxFactor int
+}
+
+// backoff tracks a collector against its CPU share.
+type backoff struct {
+	over   int // consecutive runs over the share
+	under  int // consecutive runs within the share
+	factor int // runs every factor-th collection
+	wait   int // collections to skip before the next run
+}
+
+// SetBudget sets the CPU budget of the collectors and resets their backoff.
+func (c *Collector) SetBudget(budget Budget) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.budget = budget
+	c.backoffs = make(map[string]*backoff, len(c.collectors))
+	for _, col := range c.collectors {
+		c.backoffs[col.Name()] = &backoff{factor: 1}
+		c.stats[col.Name()].Backoff = 0
+	}
+}
+
+// skip reports whether a backed-off collector sits out this collection.
+// Its previous values are copied into metrics and it is listed as stale.
+func (c *Collector) skip(name string, metrics *Metrics) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b := c.backoffs[name]
+	if b == nil || b.wait == 0 {
+		return false
+	}
+
+	b.wait--
+	c.stats[name].Skipped++
+	metrics.Stale = append(metrics.Stale, name)
+
+	if c.last != nil {
+		if section, err := sectionField(name); err == nil {
+			reflect.ValueOf(metrics).Elem().FieldByIndex(section.Index).
+				Set(reflect.ValueOf(c.last).Elem().FieldByIndex(section.Index))
+		}
+	}
+
+	return true
+}
+
+// account records the CPU time of a run and adjusts the collector's
+// backoff.
+func (c *Collector) account(name string, cpu time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := c.stats[name]
+	s.LastCPU = nsToMs(uint64(cpu))
+
+	b := c.backoffs[name]
+	if b == nil || c.budget.Share <= 0 {
+		return
+	}
+
+	if cpu > c.budget.Share {
+		s.OverBudget++
+		b.over++
+		b.under = 0
+
+		if b.over >= c.budget.After && b.factor < c.budget.MaxFactor {
+			b.factor = min(b.factor*2, c.budget.MaxFactor)
+			b.over = 0
+			log.Warn().
+				Str("collector", name).
+				Dur("cpu", cpu).
+				Dur("share", c.budget.Share).
+				Int("every", b.factor).
+				Msg("🐢 Collector exceeds its CPU budget, backing off")
+		}
+	} else {
+		b.under++
+		b.over = 0
+
+		if b.under >= c.budget.After && b.factor > 1 {
+			b.factor /= 2
+			b.under = 0
+			log.Info().
+				Str("collector", name).
+				Int("every", b.factor).
+				Msg("Collector within its CPU budget again, reducing backoff")
+		}
+	}
+
+	b.wait = b.factor - 1
+	if b.factor > 1 {
+		s.Backoff = b.factor
+	} else {
+		s.Backoff = 0
+	}
+}
@@ -0,0 +1,129 @@
+package collector
+
+import (
+	"context"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBudgetBackoff(t *testing.T) {
+	budget := Budget{Share: 10 * time.Millisecond, After: 2, MaxFactor: 4}
+	over, within := 20*time.Millisecond, 5*time.Millisecond
+
+	tests := []struct {
+		name        string
+		runs        []time.Duration
+		wantBackoff int
+		wantOver    uint64
+	}{
+		{name: "within share", runs: []time.Duration{within, within, within}},
+		{name: "once over", runs: []time.Duration{over, within}, wantOver: 1},
+		{name: "backs off", runs: []time.Duration{over, over}, wantBackoff: 2, wantOver: 2},
+		{name: "capped", runs: []time.Duration{over, over, over, over, over, over}, wantBackoff: 4, wantOver: 6},
+		{name: "recovers", runs: []time.Duration{over, over, within, within}, wantOver: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := New("memory")
+			if err != nil {
+				t.Fatal(err)
+			}
+			c.SetBudget(budget)
+
+			for _, cpu := range tt.runs {
+				c.account("memory", cpu)
+			}
+
+			stats := c.stats["memory"]
+			if stats.Backoff != tt.wantBackoff {
+				t.Errorf("Backoff = %d, want %d", stats.Backoff, tt.wantBackoff)
+			}
+			if stats.OverBudget != tt.wantOver {
+				t.Errorf("OverBudget = %d, want %d", stats.OverBudget, tt.wantOver)
+			}
+		})
+	}
+}
+
+func TestBudgetChargesCollectorThread(t *testing.T) {
+	if _, measurable := threadCPUTime(); !measurable {
+		t.Skip("thread CPU time cannot be measured on this platform")
+	}
+
+	spin := 20 * time.Millisecond
+	busy := &testCollector{name: "memory", work: func() {
+		// Spins on the collector's own (locked) thread
+		start, _ := threadCPUTime()
+		for now := start; now-start < spin; now, _ = threadCPUTime() {
+		}
+	}}
+	idle := &testCollector{name: "cpu", work: func() { time.Sleep(spin) }}
+	spawner := &testCollector{name: "disk", work: func() {
+		// Work handed to another goroutine is not charged
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for start := time.Now(); time.Since(start) < spin; {
+			}
+		}()
+		<-done
+	}}
+
+	c := &Collector{
+		collectors: []MetricCollector{busy, idle, spawner},
+		stats:      map[string]*CollectorStats{"memory": {}, "cpu": {}, "disk": {}},
+	}
+	c.SetBudget(Budget{Share: 5 * time.Millisecond, After: 1, MaxFactor: 2})
+
+	var reported []uint64
+	var stale [][]string
+	for range 3 {
+		metrics, err := c.CollectAll(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		reported = append(reported, metrics.Memory.UsedMB)
+		stale = append(stale, metrics.Stale)
+	}
+
+	// Only the busy collector is charged over its share: run 2 is skipped
+	// with the previous values, run 3 runs again
+	if !slices.Equal(reported, []uint64{1, 1, 2}) {
+		t.Errorf("reported %v, want [1 1 2]", reported)
+	}
+	if !slices.Equal(stale[0], nil) || !slices.Equal(stale[1], []string{"memory"}) || !slices.Equal(stale[2], nil) {
+		t.Errorf("stale %q, want [] [memory] []", stale)
+	}
+
+	stats := c.Stats()
+	if stats["memory"].LastCPU < 10 || stats["memory"].Skipped != 1 {
+		t.Errorf("busy collector: LastCPU = %vms, Skipped = %d, want its spin and 1", stats["memory"].LastCPU, stats["memory"].Skipped)
+	}
+	for _, name := range []string{"cpu", "disk"} {
+		if stats[name].LastCPU >= 5 || stats[name].Skipped != 0 {
+			t.Errorf("%s collector: LastCPU = %vms, Skipped = %d, want neither charged nor skipped", name, stats[name].LastCPU, stats[name].Skipped)
+		}
+	}
+}
+
+// testCollector does some work and reports its number of runs as memory usage.
+type testCollector struct {
+	name string
+	work func()
+	runs atomic.Uint64
+}
+
+func (c *testCollector) Name() string { return c.name }
+
+func (c *testCollector) Collect(ctx context.Context, m *Metrics) error {
+	c.work()
+
+	runs := c.runs.Add(1)
+	if c.name == "memory" {
+		m.Memory.UsedMB = runs
+	}
+	return nil
+}
@@ -3,12 +3,18 @@ package collector
 import (
 	"context"
 	"errors"
+	"fmt"
+	"runtime"
 	"sync"
 	"time"
 
-	"github.com/rs/zerolog/log"
+	"dideban-agent/internal/logger"
+	"dideban-agent/internal/payload"
 )
 
+// log is the logger of the collector component.
+var log = logger.New("collector")
+
 // MetricCollector defines a common interface for all metric collectors
 // (CPU, Memory, Disk, etc).
 //
@@ -29,23 +35,91 @@ type MetricCollector interface {
 // handling errors, and measuring collection duration.
 type Collector struct {
 	collectors []MetricCollector
+
+	mu       sync.Mutex
+	stats    map[string]*CollectorStats
+	budget   Budget
+	backoffs map[string]*backoff // nil until SetBudget is called
+	last     *Metrics            // previous snapshot, for backed-off collectors
+}
+
+// registry maps collector names to their constructors.
+var registry = map[string]func() MetricCollector{
+	"cpu":    func() MetricCollector { return &CPUCollector{} },
+	"memory": func() MetricCollector { return &MemoryCollector{} },
+	"disk":   func() MetricCollector { return &DiskCollector{} },
 }
 
 // New creates and initializes a new Collector instance
-// with all default system metric collectors registered.
-func New() *Collector {
-	return &Collector{
-		collectors: []MetricCollector{
-			&CPUCollector{},
-			&MemoryCollector{},
-			&DiskCollector{},
-		},
+// with the named metric collectors registered.
+//
+// If no names are given, all default system metric collectors are registered.
+func New(names ...string) (*Collector, error) {
+	if len(names) == 0 {
+		names = []string{"cpu", "memory", "disk"}
+	}
+
+	c := &Collector{stats: make(map[string]*CollectorStats, len(names))}
+	for _, name := range names {
+		newCollector, ok := registry[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown collector: %s", name)
+		}
+		c.collectors = append(c.collectors, newCollector())
+		c.stats[name] = &CollectorStats{}
+	}
+
+	return c, nil
+}
+
+// Names returns the names of all registered collectors.
+func (c *Collector) Names() []string {
+	names := make([]string, 0, len(c.collectors))
+	for _, col := range c.collectors {
+		names = append(names, col.Name())
+	}
+	return names
+}
+
+// Stats returns the accounting of every registered collector, keyed by name.
+func (c *Collector) Stats() map[string]CollectorStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := make(map[string]CollectorStats, len(c.stats))
+	for name, s := range c.stats {
+		stats[name] = *s
 	}
+	return stats
+}
+
+// record updates the accounting of a collector after a run.
+func (c *Collector) record(name string, start time.Time, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := c.stats[name]
+	s.LastDuration = time.Since(start).Milliseconds()
+
+	if err != nil {
+		s.Failures++
+		s.LastError = err.Error()
+		return
+	}
+
+	s.Successes++
+	s.LastError = ""
+	s.LastSuccess = time.Now().UnixMilli()
 }
 
 // CollectAll runs all registered metric collectors concurrently.
 // Partial results are returned even if one or more collectors fail.
 //
+// With a CPU budget (SetBudget), each collector is locked to its thread
+// for the run and charged that thread's CPU time. Work it hands to other
+// goroutines is not charged; the built-in collectors do not start any.
+// Backed-off collectors are listed in Metrics.Stale.
+//
 // Returns:
 //   - *Metrics: collected metrics (maybe partial)
 //   - error: combined error if any collector fails
@@ -62,22 +136,32 @@ func (c *Collector) CollectAll(ctx context.Context) (*Metrics, error) {
 		errs []error
 	)
 
-	// Run each collector in its own goroutine
+	addError := func(col MetricCollector, err error) {
+		mu.Lock()
+		errs = append(errs, &CollectError{Collector: col.Name(), Err: err})
+		mu.Unlock()
+	}
+
+	c.mu.Lock()
+	budgeted := c.budget.Share > 0
+	c.mu.Unlock()
+
+	_, measurable := threadCPUTime()
+	measure := budgeted && measurable
+
 	for _, col := range c.collectors {
+		if c.skip(col.Name(), metrics) {
+			continue
+		}
+
+		// Run each collector in its own goroutine
 		wg.Add(1)
 
 		go func(col MetricCollector) {
 			defer wg.Done()
 
-			if err := col.Collect(ctx, metrics); err != nil {
-				log.Warn().
-					Err(err).
-					Str("collector", col.Name()).
-					Msg("metric collection failed")
-
-				mu.Lock()
-				errs = append(errs, err)
-				mu.Unlock()
+			if err := c.run(ctx, col, metrics, measure); err != nil {
+				addError(col, err)
 			}
 		}(col)
 	}
@@ -88,6 +172,11 @@ func (c *Collector) CollectAll(ctx context.Context) (*Metrics, error) {
 	// Measure total collection duration
 	metrics.CollectDuration = time.Since(start).Milliseconds()
 
+	last := *metrics
+	c.mu.Lock()
+	c.last = &last
+	c.mu.Unlock()
+
 	// Return partial metrics with a combined error (if any)
 	if len(errs) > 0 {
 		return metrics, errors.Join(errs...)
@@ -96,6 +185,72 @@ func (c *Collector) CollectAll(ctx context.Context) (*Metrics, error) {
 	return metrics, nil
 }
 
+// run runs a single collector and records the outcome and, if measure is
+// set, the CPU time of its thread.
+func (c *Collector) run(ctx context.Context, col MetricCollector, metrics *Metrics, measure bool) error {
+	if measure {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+	}
+
+	colStart := time.Now()
+	cpuStart, _ := threadCPUTime()
+	err := col.Collect(ctx, metrics)
+	cpuEnd, _ := threadCPUTime()
+
+	// Cancellation (shutdown, sampler stopped) is not a collector failure
+	cancelled := err != nil && ctx.Err() != nil
+	if !cancelled {
+		c.record(col.Name(), colStart, err)
+		if measure {
+			c.account(col.Name(), cpuEnd-cpuStart)
+		}
+	}
+
+	if err != nil && !cancelled {
+		log.Warn().
+			Err(err).
+			Str("collector", col.Name()).
+			Msg("metric collection failed")
+	}
+
+	return err
+}
+
+// CollectError reports the failure of a single collector.
+type CollectError struct {
+	Collector string
+	Err       error
+}
+
+func (e *CollectError) Error() string {
+	return e.Collector + ": " + e.Err.Error()
+}
+
+func (e *CollectError) Unwrap() error {
+	return e.Err
+}
+
+// FailedCollectors returns the names of the collectors that failed,
+// given the error returned by CollectAll.
+func FailedCollectors(err error) []string {
+	var errs []error
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs = joined.Unwrap()
+	} else if err != nil {
+		errs = []error{err}
+	}
+
+	var names []string
+	for _, err := range errs {
+		var collectErr *CollectError
+		if errors.As(err, &collectErr) {
+			names = append(names, collectErr.Collector)
+		}
+	}
+	return names
+}
+
 // Metrics represents a snapshot of all collected system metrics.
 type Metrics struct {
 	Timestamp       int64 `json:"timestamp_ms"`
@@ -104,4 +259,50 @@ type Metrics struct {
 	CPU    CPUStats  `json:"cpu"`
 	Memory MemStats  `json:"memory"`
 	Disk   DiskStats `json:"disk"`
+
+	// Collectors backed off by the CPU budget: their sections repeat the
+	// values of an earlier snapshot
+	Stale []string `json:"stale,omitempty"`
+
+	// Aggregates of sub-interval samples (if sampling is enabled)
+	Aggregates *Aggregates `json:"aggregates,omitempty"`
+
+	// Status of remotely delivered configuration (if enabled)
+	Config *payload.ConfigStatus `json:"config,omitempty"`
+
+	// Local alert state transitions since the previous snapshot
+	Alerts []payload.AlertEvent `json:"alerts,omitempty"`
+
+	// State of the agent itself
+	Agent *AgentStats `json:"agent,omitempty"`
+}
+
+// AgentStats reports the state of the agent itself.
+type AgentStats struct {
+	Version    string `json:"version"`
+	ConfigHash string `json:"config_hash"`
+	Uptime     int64  `json:"uptime_s"`
+
+	Process    *ProcessStats             `json:"process,omitempty"`
+	Collectors map[string]CollectorStats `json:"collectors,omitempty"`
+	Sender     *payload.SenderStats      `json:"sender,omitempty"`
+	Queue      *payload.QueueStats       `json:"queue,omitempty"`
+	Schedule   *payload.ScheduleStats    `json:"schedule,omitempty"`
+	Logs       *payload.LogShipStats     `json:"logs,omitempty"`
+	Sandbox    *payload.SandboxStats     `json:"sandbox,omitempty"`
+}
+
+// CollectorStats reports the accounting of a single collector.
+type CollectorStats struct {
+	LastDuration int64  `json:"last_duration_ms"`
+	Successes    uint64 `json:"successes"`
+	Failures     uint64 `json:"failures"`
+	LastError    string `json:"last_error,omitempty"`
+	LastSuccess  int64  `json:"last_success_ms,omitempty"`
+
+	// CPU time of the last run (on platforms where it can be measured)
+	LastCPU    float64 `json:"last_cpu_ms,omitempty"`
+	OverBudget uint64  `json:"over_budget,omitempty"` // runs over the collector's CPU share
+	Backoff    int     `json:"backoff,omitempty"`     // backed off: runs every n-th collection
+	Skipped    uint64  `json:"skipped,omitempty"`     // collections skipped while backed off
 }
@@ -4,7 +4,6 @@ import (
 	"context"
 	"fmt"
 	"math"
-	"time"
 
 	"github.com/shirou/gopsutil/cpu"
 	"github.com/shirou/gopsutil/load"
@@ -38,33 +37,15 @@ func (c *CPUCollector) Collect(ctx context.Context, metrics *Metrics) error {
 	default:
 	}
 
-	// Use a goroutine with context to make CPU collection cancellable
-	type cpuResult struct {
-		percentages []float64
-		err         error
-	}
-
-	cpuChan := make(chan cpuResult, 1)
-	go func() {
-		// Get CPU usage with a short interval for responsiveness
-		percentages, err := cpu.Percent(200*time.Millisecond, false)
-		cpuChan <- cpuResult{percentages: percentages, err: err}
-	}()
-
-	// Wait for CPU result or context cancellation
-	var cpuRes cpuResult
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
-	case cpuRes = <-cpuChan:
-	}
-
-	if cpuRes.err != nil {
-		return fmt.Errorf("failed to get CPU usage: %w", cpuRes.err)
+	// Usage since the previous call (since startup for the first one), so
+	// the whole interval is covered without blocking the collection
+	percentages, err := cpu.Percent(0, false)
+	if err != nil {
+		return fmt.Errorf("failed to get CPU usage: %w", err)
 	}
 
-	if len(cpuRes.percentages) > 0 {
-		metrics.CPU.UsagePercent = math.Round(cpuRes.percentages[0])
+	if len(percentages) > 0 {
+		metrics.CPU.UsagePercent = math.Round(percentages[0])
 	}
 
 	// Retrieve system load averages (1m, 5m, 15m)
@@ -0,0 +1,36 @@
+package collector
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCPUCollectorDoesNotBlock(t *testing.T) {
+	c := &CPUCollector{}
+
+	for i := range 3 {
+		var metrics Metrics
+		start := time.Now()
+
+		if err := c.Collect(context.Background(), &metrics); err != nil {
+			t.Fatalf("Collect() error = %v", err)
+		}
+
+		if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+			t.Errorf("run %d took %v, want no sampling delay", i, elapsed)
+		}
+		if usage := metrics.CPU.UsagePercent; usage < 0 || usage > 100 {
+			t.Errorf("run %d: UsagePercent = %v, want 0-100", i, usage)
+		}
+	}
+}
+
+func TestCPUCollectorCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := (&CPUCollector{}).Collect(ctx, &Metrics{}); err == nil {
+		t.Error("Collect() succeeded with a cancelled context, want error")
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !(linux || freebsd)
+
+package collector
+
+import "time"
+
+// threadCPUTime reports that per-thread CPU time cannot be measured.
+func threadCPUTime() (time.Duration, bool) {
+	return 0, false
+}
@@ -0,0 +1,20 @@
+//go:build linux || freebsd
+
+package collector
+
+import (
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// threadCPUTime returns the user and system CPU time used by the calling
+// thread, and false if it cannot be measured. The caller must be locked
+// to its thread (runtime.LockOSThread).
+func threadCPUTime() (time.Duration, bool) {
+	var usage unix.Rusage
+	if err := unix.Getrusage(unix.RUSAGE_THREAD, &usage); err != nil {
+		return 0, false
+	}
+	return time.Duration(usage.Utime.Nano() + usage.Stime.Nano()), true
+}
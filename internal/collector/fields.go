@@ -0,0 +1,142 @@
+package collector
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// NumericField is a numeric leaf field of Metrics, addressed by its
+// dotted JSON path (e.g. "cpu.usage_percent").
+type NumericField struct {
+	path  string
+	index []int
+}
+
+// LookupField resolves a dotted metric path such as "disk.usage_percent"
+// to a numeric field of Metrics, using the JSON field names.
+func LookupField(path string) (NumericField, error) {
+	t := reflect.TypeFor[Metrics]()
+	var index []int
+
+	for segment := range strings.SplitSeq(path, ".") {
+		if t.Kind() != reflect.Struct {
+			return NumericField{}, fmt.Errorf("unknown metric: %s", path)
+		}
+
+		field, ok := fieldByJSONName(t, segment)
+		if !ok {
+			return NumericField{}, fmt.Errorf("unknown metric: %s", path)
+		}
+
+		index = append(index, field.Index...)
+		t = field.Type
+	}
+
+	if !isNumeric(t) {
+		return NumericField{}, fmt.Errorf("metric is not numeric: %s", path)
+	}
+
+	return NumericField{path: path, index: index}, nil
+}
+
+// Path returns the dotted JSON path of the field.
+func (f NumericField) Path() string {
+	return f.path
+}
+
+// Collector returns the name of the collector that populates the field
+// (the first path segment).
+func (f NumericField) Collector() string {
+	name, _, _ := strings.Cut(f.path, ".")
+	return name
+}
+
+// Value reads the field from the snapshot as a float64.
+func (f NumericField) Value(m *Metrics) float64 {
+	v := reflect.ValueOf(m).Elem().FieldByIndex(f.index)
+
+	switch {
+	case v.CanInt():
+		return float64(v.Int())
+	case v.CanUint():
+		return float64(v.Uint())
+	default:
+		return v.Float()
+	}
+}
+
+// sectionField returns the Metrics field holding the section written
+// by the named collector (its JSON name equals the collector name).
+func sectionField(name string) (reflect.StructField, error) {
+	field, ok := fieldByJSONName(reflect.TypeFor[Metrics](), name)
+	if !ok || field.Type.Kind() != reflect.Struct {
+		return reflect.StructField{}, fmt.Errorf("no metrics section for collector: %s", name)
+	}
+	return field, nil
+}
+
+// sectionFields returns all numeric fields of the named collector's section.
+func sectionFields(name string) ([]NumericField, error) {
+	section, err := sectionField(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields []NumericField
+	appendNumericFields(&fields, section.Type, name, section.Index)
+	return fields, nil
+}
+
+// appendNumericFields walks a struct type and appends its numeric leaves.
+func appendNumericFields(fields *[]NumericField, t reflect.Type, path string, index []int) {
+	for i := range t.NumField() {
+		field := t.Field(i)
+		name := jsonName(field)
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+
+		fieldPath := path + "." + name
+		fieldIndex := append(append([]int(nil), index...), field.Index...)
+
+		switch {
+		case isNumeric(field.Type):
+			*fields = append(*fields, NumericField{path: fieldPath, index: fieldIndex})
+		case field.Type.Kind() == reflect.Struct:
+			appendNumericFields(fields, field.Type, fieldPath, fieldIndex)
+		}
+	}
+}
+
+// fieldByJSONName finds the exported struct field with the given JSON name.
+func fieldByJSONName(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if field.IsExported() && jsonName(field) == name {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// isNumeric reports whether values of t can be read as a float64.
+func isNumeric(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	default:
+		return false
+	}
+}
+
+// jsonName returns the JSON name of a struct field.
+func jsonName(field reflect.StructField) string {
+	name := strings.Split(field.Tag.Get("json"), ",")[0]
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
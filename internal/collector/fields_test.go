@@ -0,0 +1,74 @@
+package collector
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestLookupField(t *testing.T) {
+	m := &Metrics{Timestamp: 1000}
+	m.CPU.UsagePercent = 42.5
+	m.Memory.AvailableMB = 512
+	m.Disk.TotalGB = 100
+
+	tests := []struct {
+		path          string
+		wantCollector string
+		want          float64
+		wantErr       bool
+	}{
+		{path: "cpu.usage_percent", wantCollector: "cpu", want: 42.5},
+		{path: "memory.available_mb", wantCollector: "memory", want: 512},
+		{path: "disk.total_gb", wantCollector: "disk", want: 100},
+		{path: "timestamp_ms", wantCollector: "timestamp_ms", want: 1000},
+		{path: "cpu", wantErr: true},
+		{path: "cpu.no_such_field", wantErr: true},
+		{path: "cpu.usage_percent.more", wantErr: true},
+		{path: "agent.uptime_s", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			field, err := LookupField(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LookupField(%q) error = %v, wantErr %v", tt.path, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			if got := field.Collector(); got != tt.wantCollector {
+				t.Errorf("Collector() = %q, want %q", got, tt.wantCollector)
+			}
+			if got := field.Value(m); got != tt.want {
+				t.Errorf("Value() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSectionFields(t *testing.T) {
+	fields, err := sectionFields("memory")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var paths []string
+	for _, field := range fields {
+		paths = append(paths, field.Path())
+
+		// Every enumerated field resolves to itself
+		if _, err := LookupField(field.Path()); err != nil {
+			t.Errorf("LookupField(%q) error = %v", field.Path(), err)
+		}
+	}
+
+	want := []string{"memory.used_mb", "memory.total_mb", "memory.usage_percent", "memory.available_mb"}
+	if !slices.Equal(paths, want) {
+		t.Errorf("sectionFields(memory) = %v, want %v", paths, want)
+	}
+
+	if _, err := sectionFields("timestamp_ms"); err == nil {
+		t.Error("sectionFields(timestamp_ms) succeeded, want error")
+	}
+}
@@ -0,0 +1,49 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// collectorPaths lists the filesystem locations each collector reads on
+// Linux, below the proc ("proc") or sys ("sys") mount. The disk collector
+// only calls statfs, which filesystem sandboxes do not restrict.
+var collectorPaths = map[string][]string{
+	"cpu":    {"proc"},
+	"memory": {"proc"},
+	"disk":   {},
+}
+
+// Paths returns the filesystem paths the named collectors and the agent's
+// own process statistics read, e.g. to restrict filesystem access to them.
+// HOST_PROC and HOST_SYS are honored like in the collectors themselves.
+func Paths(names ...string) []string {
+	roots := map[string]string{
+		"proc": envOr("HOST_PROC", "/proc"),
+		"sys":  envOr("HOST_SYS", "/sys"),
+	}
+
+	// Process statistics of the agent itself
+	paths := []string{roots["proc"]}
+
+	for _, name := range names {
+		for _, path := range collectorPaths[name] {
+			root, rest, _ := strings.Cut(path, "/")
+			paths = append(paths, filepath.Join(roots[root], rest))
+		}
+	}
+
+	slices.Sort(paths)
+	return slices.Compact(paths)
+}
+
+// envOr returns the value of an environment variable, or fallback if it
+// is not set.
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
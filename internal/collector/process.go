@@ -0,0 +1,74 @@
+package collector
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/shirou/gopsutil/process"
+)
+
+// ProcessStats reports the resource usage of the agent process.
+type ProcessStats struct {
+	RSS          uint64  `json:"rss_bytes"`
+	HeapAlloc    uint64  `json:"heap_alloc_bytes"`
+	CPUUser      float64 `json:"cpu_user_s"`
+	CPUSystem    float64 `json:"cpu_system_s"`
+	Goroutines   int     `json:"goroutines"`
+	GCCount      uint32  `json:"gc_count"`
+	GCPauseTotal float64 `json:"gc_pause_total_ms"`
+	GCLastPause  float64 `json:"gc_last_pause_ms"`
+	MaxProcs     int     `json:"max_procs"`                    // GOMAXPROCS
+	MemoryLimit  int64   `json:"memory_limit_bytes,omitempty"` // soft Go memory limit (if set)
+}
+
+// CollectProcess gathers the resource usage of the agent process itself.
+//
+// Go runtime figures are always filled in; if the operating system
+// figures (RSS, CPU time) cannot be read, they are left at zero and the
+// error is returned along with the partial result.
+func CollectProcess() (*ProcessStats, error) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	stats := &ProcessStats{
+		HeapAlloc:    mem.HeapAlloc,
+		Goroutines:   runtime.NumGoroutine(),
+		GCCount:      mem.NumGC,
+		GCPauseTotal: nsToMs(mem.PauseTotalNs),
+		MaxProcs:     runtime.GOMAXPROCS(0),
+	}
+	if limit := debug.SetMemoryLimit(-1); limit != math.MaxInt64 {
+		stats.MemoryLimit = limit
+	}
+	if mem.NumGC > 0 {
+		stats.GCLastPause = nsToMs(mem.PauseNs[(mem.NumGC+255)%256])
+	}
+
+	proc, err := process.NewProcess(int32(os.Getpid()))
+	if err != nil {
+		return stats, fmt.Errorf("failed to open agent process: %w", err)
+	}
+
+	memInfo, err := proc.MemoryInfo()
+	if err != nil {
+		return stats, fmt.Errorf("failed to get agent memory usage: %w", err)
+	}
+	stats.RSS = memInfo.RSS
+
+	times, err := proc.Times()
+	if err != nil {
+		return stats, fmt.Errorf("failed to get agent CPU time: %w", err)
+	}
+	stats.CPUUser = round2(times.User)
+	stats.CPUSystem = round2(times.System)
+
+	return stats, nil
+}
+
+// nsToMs converts nanoseconds to milliseconds, rounded to three decimals.
+func nsToMs(ns uint64) float64 {
+	return math.Round(float64(ns)/1e3) / 1e3
+}
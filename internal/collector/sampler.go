@@ -0,0 +1,357 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+
+	"dideban-agent/internal/ring"
+)
+
+// Source produces metric snapshots. It is implemented by Collector and Sampler.
+type Source interface {
+	CollectAll(ctx context.Context) (*Metrics, error)
+	Names() []string
+	Stats() map[string]CollectorStats
+}
+
+// SamplerConfig contains configuration for sub-interval sampling.
+type SamplerConfig struct {
+	// Collectors sampled in the background (others are collected per snapshot)
+	Collectors []string
+
+	// Time between samples
+	Interval time.Duration
+
+	// Expected time between snapshots; sizes the sample buffer
+	Window time.Duration
+
+	// CPU budget per collector and snapshot; sampled collectors get the
+	// part of it that corresponds to one sample
+	Budget Budget
+}
+
+// Aggregate summarizes the samples of a numeric metric.
+type Aggregate struct {
+	Min  float64 `json:"min"`
+	Max  float64 `json:"max"`
+	Avg  float64 `json:"avg"`
+	Last float64 `json:"last"`
+	P95  float64 `json:"p95"`
+}
+
+// Aggregates summarizes the samples taken since the previous snapshot.
+// Fields are keyed by metric path, e.g. "cpu.usage_percent".
+type Aggregates struct {
+	WindowMs int64                `json:"window_ms"`
+	Samples  int                  `json:"samples"`
+	Fields   map[string]Aggregate `json:"fields"`
+}
+
+// sample holds the numeric fields of one sample, aligned with
+// Sampler.fields. Fields of failed and backed-off collectors are NaN.
+type sample []float64
+
+// Sampler collects fast collectors at a higher rate than snapshots are
+// taken, and reports min/max/avg/last/p95 of every numeric field over
+// the window between two snapshots.
+//
+// Snapshot values of sampled collectors are those of the latest sample.
+type Sampler struct {
+	config  SamplerConfig
+	sampled *Collector
+	direct  *Collector // nil if every collector is sampled
+
+	fields   []NumericField
+	sections [][]int // Metrics field index per sampled collector
+
+	mu          sync.Mutex
+	samples     *ring.Buffer[sample]
+	last        *Metrics
+	lastErr     error
+	windowStart time.Time
+	taken       chan struct{} // closed (and replaced) when a sample is taken
+
+	stop context.CancelFunc
+	done chan struct{}
+}
+
+// NewSampler creates a Sampler for the named collectors. Collectors in
+// config.Collectors are sampled; the others are collected per snapshot.
+// Call Start to begin sampling.
+func NewSampler(names []string, config SamplerConfig) (*Sampler, error) {
+	if config.Interval <= 0 {
+		return nil, fmt.Errorf("sampling interval must be greater than zero")
+	}
+
+	var sampledNames, directNames []string
+	for _, name := range names {
+		if slices.Contains(config.Collectors, name) {
+			sampledNames = append(sampledNames, name)
+		} else {
+			directNames = append(directNames, name)
+		}
+	}
+
+	if len(sampledNames) == 0 {
+		return nil, fmt.Errorf("no enabled collector to sample")
+	}
+
+	s := &Sampler{config: config, windowStart: time.Now(), taken: make(chan struct{})}
+
+	var err error
+	if s.sampled, err = New(sampledNames...); err != nil {
+		return nil, err
+	}
+	if len(directNames) > 0 {
+		if s.direct, err = New(directNames...); err != nil {
+			return nil, err
+		}
+		s.direct.SetBudget(config.Budget)
+	}
+
+	sampleBudget := config.Budget
+	if config.Window > 0 {
+		sampleBudget.Share = time.Duration(float64(config.Budget.Share) * float64(config.Interval) / float64(config.Window))
+	}
+	s.sampled.SetBudget(sampleBudget)
+
+	for _, name := range sampledNames {
+		section, err := sectionField(name)
+		if err != nil {
+			return nil, err
+		}
+		fields, err := sectionFields(name)
+		if err != nil {
+			return nil, err
+		}
+		s.sections = append(s.sections, section.Index)
+		s.fields = append(s.fields, fields...)
+	}
+
+	// Room for one window of samples plus some slack for late snapshots
+	capacity := int(math.Ceil(float64(config.Window)/float64(config.Interval))) + 1
+	s.samples = ring.New[sample](capacity)
+
+	return s, nil
+}
+
+// Start samples in the background until ctx is cancelled or Close is called.
+// The first window starts now.
+func (s *Sampler) Start(ctx context.Context) {
+	ctx, s.stop = context.WithCancel(ctx)
+	s.done = make(chan struct{})
+
+	s.mu.Lock()
+	s.windowStart = time.Now()
+	s.mu.Unlock()
+
+	go func() {
+		defer close(s.done)
+
+		ticker := time.NewTicker(s.config.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.sample(ctx)
+			}
+		}
+	}()
+}
+
+// Close stops sampling and waits for the sampling goroutine to exit.
+func (s *Sampler) Close() {
+	if s.stop == nil {
+		return
+	}
+	s.stop()
+	<-s.done
+}
+
+// Names returns the names of all collectors, sampled or not.
+func (s *Sampler) Names() []string {
+	names := s.sampled.Names()
+	if s.direct != nil {
+		names = append(names, s.direct.Names()...)
+	}
+	return names
+}
+
+// Stats returns the accounting of every collector, sampled or not.
+// Sampled collectors count one run per sample.
+func (s *Sampler) Stats() map[string]CollectorStats {
+	stats := s.sampled.Stats()
+	if s.direct != nil {
+		maps.Copy(stats, s.direct.Stats())
+	}
+	return stats
+}
+
+// CollectAll collects the non-sampled collectors and merges in the
+// latest sample and the aggregates of the window since the previous call.
+//
+// If no sample was taken in the window (e.g. on startup), it waits for the
+// next one.
+func (s *Sampler) CollectAll(ctx context.Context) (*Metrics, error) {
+	start := time.Now()
+
+	var (
+		metrics *Metrics
+		errs    []error
+	)
+
+	if s.direct != nil {
+		var err error
+		metrics, err = s.direct.CollectAll(ctx)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	} else {
+		metrics = &Metrics{Timestamp: start.UnixMilli()}
+	}
+
+	s.mu.Lock()
+	empty := s.samples.Len() == 0
+	taken := s.taken
+	s.mu.Unlock()
+
+	if empty {
+		s.awaitSample(ctx, taken)
+	}
+
+	if s.direct == nil {
+		metrics.CollectDuration = time.Since(start).Milliseconds()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.last != nil {
+		dst := reflect.ValueOf(metrics).Elem()
+		src := reflect.ValueOf(s.last).Elem()
+		for _, index := range s.sections {
+			dst.FieldByIndex(index).Set(src.FieldByIndex(index))
+		}
+		metrics.Stale = append(metrics.Stale, s.last.Stale...)
+	}
+
+	if s.lastErr != nil {
+		errs = append(errs, s.lastErr)
+	}
+
+	now := time.Now()
+	metrics.Aggregates = aggregate(s.fields, s.samples.Drain())
+	metrics.Aggregates.WindowMs = now.Sub(s.windowStart).Milliseconds()
+	s.windowStart = now
+
+	return metrics, errors.Join(errs...)
+}
+
+// awaitSample waits until taken is closed by the sampling goroutine, or
+// takes a sample itself if sampling is not running: sampling on demand
+// while the goroutine runs would run the collectors concurrently.
+func (s *Sampler) awaitSample(ctx context.Context, taken <-chan struct{}) {
+	if s.done != nil {
+		select {
+		case <-taken:
+			return
+		case <-ctx.Done():
+			return
+		case <-s.done:
+		}
+	}
+
+	s.sample(ctx)
+}
+
+// sample collects the sampled collectors once and records the result.
+func (s *Sampler) sample(ctx context.Context) {
+	metrics, err := s.sampled.CollectAll(ctx)
+	if ctx.Err() != nil {
+		return
+	}
+
+	// Backed-off collectors repeat earlier values, which would skew the aggregates
+	missing := append(FailedCollectors(err), metrics.Stale...)
+
+	values := make(sample, len(s.fields))
+	for i, field := range s.fields {
+		if slices.Contains(missing, field.Collector()) {
+			values[i] = math.NaN()
+			continue
+		}
+		values[i] = field.Value(metrics)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.samples.Push(values) {
+		log.Debug().Msg("Sample buffer full, oldest sample overwritten")
+	}
+	s.last = metrics
+	s.lastErr = err
+
+	close(s.taken)
+	s.taken = make(chan struct{})
+}
+
+// aggregate computes the aggregates of every field over the samples.
+// NaN values (failed samples) are skipped.
+func aggregate(fields []NumericField, samples []sample) *Aggregates {
+	result := &Aggregates{
+		Samples: len(samples),
+		Fields:  make(map[string]Aggregate, len(fields)),
+	}
+
+	values := make([]float64, 0, len(samples))
+
+	for i, field := range fields {
+		values = values[:0]
+		for _, sample := range samples {
+			if !math.IsNaN(sample[i]) {
+				values = append(values, sample[i])
+			}
+		}
+
+		if len(values) == 0 {
+			continue
+		}
+
+		agg := Aggregate{
+			Min:  values[0],
+			Max:  values[0],
+			Last: values[len(values)-1],
+		}
+
+		var sum float64
+		for _, v := range values {
+			agg.Min = min(agg.Min, v)
+			agg.Max = max(agg.Max, v)
+			sum += v
+		}
+		agg.Avg = round2(sum / float64(len(values)))
+
+		slices.Sort(values)
+		agg.P95 = values[int(math.Ceil(0.95*float64(len(values))))-1]
+
+		result.Fields[field.Path()] = agg
+	}
+
+	return result
+}
+
+// round2 rounds to two decimal places.
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
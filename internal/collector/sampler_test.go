@@ -0,0 +1,140 @@
+package collector
+
+import (
+	"context"
+	"maps"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestAggregate(t *testing.T) {
+	nan := math.NaN()
+
+	// seq returns the values 1..n in reverse order
+	seq := func(n int) []sample {
+		samples := make([]sample, n)
+		for i := range samples {
+			samples[i] = sample{float64(n - i), 0}
+		}
+		return samples
+	}
+
+	tests := []struct {
+		name    string
+		samples []sample
+		want    map[string]Aggregate
+	}{
+		{
+			name: "no samples",
+			want: map[string]Aggregate{},
+		},
+		{
+			name:    "single sample",
+			samples: []sample{{42.5, 1}},
+			want: map[string]Aggregate{
+				"cpu.usage_percent": {Min: 42.5, Max: 42.5, Avg: 42.5, Last: 42.5, P95: 42.5},
+				"cpu.load_1":        {Min: 1, Max: 1, Avg: 1, Last: 1, P95: 1},
+			},
+		},
+		{
+			name:    "average rounded",
+			samples: []sample{{1, 0}, {2, 0}, {2, 0}},
+			want: map[string]Aggregate{
+				"cpu.usage_percent": {Min: 1, Max: 2, Avg: 1.67, Last: 2, P95: 2},
+				"cpu.load_1":        {},
+			},
+		},
+		{
+			// ceil(0.95 * 20) = 19th smallest
+			name:    "p95 of 20",
+			samples: seq(20),
+			want: map[string]Aggregate{
+				"cpu.usage_percent": {Min: 1, Max: 20, Avg: 10.5, Last: 1, P95: 19},
+				"cpu.load_1":        {},
+			},
+		},
+		{
+			// ceil(0.95 * 10) = 10th smallest
+			name:    "p95 of 10",
+			samples: seq(10),
+			want: map[string]Aggregate{
+				"cpu.usage_percent": {Min: 1, Max: 10, Avg: 5.5, Last: 1, P95: 10},
+				"cpu.load_1":        {},
+			},
+		},
+		{
+			name:    "failed samples skipped",
+			samples: []sample{{1, 2}, {nan, 4}, {3, nan}},
+			want: map[string]Aggregate{
+				"cpu.usage_percent": {Min: 1, Max: 3, Avg: 2, Last: 3, P95: 3},
+				"cpu.load_1":        {Min: 2, Max: 4, Avg: 3, Last: 4, P95: 4},
+			},
+		},
+		{
+			name:    "field without values omitted",
+			samples: []sample{{nan, 1}, {nan, 1}},
+			want: map[string]Aggregate{
+				"cpu.load_1": {Min: 1, Max: 1, Avg: 1, Last: 1, P95: 1},
+			},
+		},
+	}
+
+	var fields []NumericField
+	for _, path := range []string{"cpu.usage_percent", "cpu.load_1"} {
+		field, err := LookupField(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fields = append(fields, field)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := aggregate(fields, tt.samples)
+
+			if got.Samples != len(tt.samples) {
+				t.Errorf("Samples = %d, want %d", got.Samples, len(tt.samples))
+			}
+			if !maps.Equal(got.Fields, tt.want) {
+				t.Errorf("Fields = %+v, want %+v", got.Fields, tt.want)
+			}
+		})
+	}
+}
+
+func TestSamplerCollectAllWaitsForSample(t *testing.T) {
+	interval := 50 * time.Millisecond
+	s, err := NewSampler([]string{"memory"}, SamplerConfig{
+		Collectors: []string{"memory"},
+		Interval:   interval,
+		Window:     time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	s.Start(ctx)
+	defer s.Close()
+
+	// On startup, the snapshot waits for the sampling goroutine instead of
+	// sampling concurrently with it
+	metrics, err := s.CollectAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if metrics.Aggregates.Samples != 1 {
+		t.Errorf("Samples = %d, want 1", metrics.Aggregates.Samples)
+	}
+	if window := time.Duration(metrics.Aggregates.WindowMs) * time.Millisecond; window < interval-5*time.Millisecond {
+		t.Errorf("WindowMs = %v, want at least the sampling interval %v", window, interval)
+	}
+	if metrics.Memory.TotalMB == 0 {
+		t.Error("snapshot has no values of the sampled collector")
+	}
+	if runs := s.Stats()["memory"].Successes; runs != 1 {
+		t.Errorf("memory collector ran %d times, want 1", runs)
+	}
+}
@@ -0,0 +1,155 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AlertRule defines a local threshold alerting rule.
+type AlertRule struct {
+	// Unique rule name
+	Name string `mapstructure:"name"`
+
+	// Condition, e.g. "disk.usage_percent > 90 for 5m"
+	Expr string `mapstructure:"expr"`
+
+	// Threshold at which a firing alert resolves (hysteresis).
+	// Defaults to the firing threshold.
+	Resolve *float64 `mapstructure:"resolve"`
+
+	// Severity: info, warning, critical
+	Severity string `mapstructure:"severity"`
+
+	// Additional labels attached to alert events
+	Labels map[string]string `mapstructure:"labels"`
+}
+
+// AlertExpr is a parsed alert rule condition.
+type AlertExpr struct {
+	Metric    string
+	Operator  string
+	Threshold float64
+	For       time.Duration
+}
+
+// alertExprPattern matches "<metric> <op> <number> [for <duration>]".
+var alertExprPattern = regexp.MustCompile(
+	`^\s*([a-z0-9_]+(?:\.[a-z0-9_]+)+)\s*(>=|<=|>|<|==|!=)\s*(-?[0-9]+(?:\.[0-9]+)?)\s*(?:for\s+([0-9a-z.]+))?\s*$`,
+)
+
+// Supported alert severities.
+var validAlertSeverities = map[string]struct{}{
+	"info":     {},
+	"warning":  {},
+	"critical": {},
+}
+
+// ParseAlertExpr parses an alert rule condition such as
+// "memory.available_mb < 500" or "disk.usage_percent > 90 for 5m".
+func ParseAlertExpr(expr string) (*AlertExpr, error) {
+	match := alertExprPattern.FindStringSubmatch(expr)
+	if match == nil {
+		return nil, fmt.Errorf("invalid alert expression %q (expected: <metric> <op> <value> [for <duration>])", expr)
+	}
+
+	threshold, err := strconv.ParseFloat(match[3], 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid alert threshold %q: %w", match[3], err)
+	}
+
+	parsed := &AlertExpr{
+		Metric:    match[1],
+		Operator:  match[2],
+		Threshold: threshold,
+	}
+
+	if match[4] != "" {
+		parsed.For, err = time.ParseDuration(match[4])
+		if err != nil || parsed.For < 0 {
+			return nil, fmt.Errorf("invalid alert duration %q", match[4])
+		}
+	}
+
+	return parsed, nil
+}
+
+// validateAlerts validates local alerting rules. Only the collector of a
+// metric path is checked here; the field itself is checked against the
+// collector snapshot when the alert package compiles the rules.
+func validateAlerts(cfg *Config) error {
+	if cfg.Alerts.Endpoint != "" {
+		endpoint, err := url.Parse(cfg.Alerts.Endpoint)
+		if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+			return fmt.Errorf("config: invalid alerts.endpoint: %s", cfg.Alerts.Endpoint)
+		}
+	}
+
+	enabled := cfg.EnabledCollectors()
+	names := make(map[string]struct{}, len(cfg.Alerts.Rules))
+
+	for i, rule := range cfg.Alerts.Rules {
+		if rule.Name == "" {
+			return fmt.Errorf("config: alerts.rules[%d].name is required", i)
+		}
+
+		if _, ok := names[rule.Name]; ok {
+			return fmt.Errorf("config: duplicate alert rule name: %s", rule.Name)
+		}
+		names[rule.Name] = struct{}{}
+
+		expr, err := ParseAlertExpr(rule.Expr)
+		if err != nil {
+			return fmt.Errorf("config: alerts.rules[%s]: %w", rule.Name, err)
+		}
+
+		section, _, _ := strings.Cut(expr.Metric, ".")
+		if !slices.Contains(enabled, section) {
+			return fmt.Errorf("config: alert %s uses metric of disabled or unknown collector: %s", rule.Name, expr.Metric)
+		}
+
+		if err := validateResolve(rule, expr); err != nil {
+			return err
+		}
+
+		if _, ok := validAlertSeverities[rule.Severity]; !ok {
+			return fmt.Errorf(
+				"config: invalid severity for alert %s: %s (valid: info, warning, critical)",
+				rule.Name, rule.Severity,
+			)
+		}
+	}
+
+	return nil
+}
+
+// validateResolve checks that the resolve threshold of a rule lies on
+// the side of the firing threshold where the condition no longer holds;
+// otherwise the alert would resolve while it still fires.
+func validateResolve(rule AlertRule, expr *AlertExpr) error {
+	if rule.Resolve == nil {
+		return nil
+	}
+	resolve := *rule.Resolve
+
+	switch expr.Operator {
+	case ">", ">=":
+		if resolve > expr.Threshold {
+			return fmt.Errorf("config: alert %s: resolve (%g) must not be above the threshold (%g) for %s", rule.Name, resolve, expr.Threshold, expr.Operator)
+		}
+	case "<", "<=":
+		if resolve < expr.Threshold {
+			return fmt.Errorf("config: alert %s: resolve (%g) must not be below the threshold (%g) for %s", rule.Name, resolve, expr.Threshold, expr.Operator)
+		}
+	default:
+		if resolve != expr.Threshold {
+			return fmt.Errorf("config: alert %s: resolve is not supported with %s", rule.Name, expr.Operator)
+		}
+	}
+
+	return nil
+}
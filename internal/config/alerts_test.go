@@ -0,0 +1,44 @@
+package config
+
+import "testing"
+
+func TestValidateAlerts(t *testing.T) {
+	resolve := func(v float64) *float64 { return &v }
+
+	tests := []struct {
+		name    string
+		rule    AlertRule
+		wantErr bool
+	}{
+		{name: "valid", rule: AlertRule{Expr: "disk.usage_percent > 90 for 5m"}},
+		{name: "invalid expression", rule: AlertRule{Expr: "disk.usage_percent >> 90"}, wantErr: true},
+		{name: "disabled collector", rule: AlertRule{Expr: "memory.available_mb < 500"}, wantErr: true},
+		{name: "resolve below for >", rule: AlertRule{Expr: "disk.usage_percent > 90", Resolve: resolve(85)}},
+		{name: "resolve equal for >=", rule: AlertRule{Expr: "disk.usage_percent >= 90", Resolve: resolve(90)}},
+		{name: "resolve above for >", rule: AlertRule{Expr: "disk.usage_percent > 90", Resolve: resolve(95)}, wantErr: true},
+		{name: "resolve above for <", rule: AlertRule{Expr: "cpu.usage_percent < 10", Resolve: resolve(20)}},
+		{name: "resolve below for <=", rule: AlertRule{Expr: "cpu.usage_percent <= 10", Resolve: resolve(5)}, wantErr: true},
+		{name: "resolve equal for ==", rule: AlertRule{Expr: "cpu.cores == 1", Resolve: resolve(1)}},
+		{name: "resolve for !=", rule: AlertRule{Expr: "cpu.cores != 4", Resolve: resolve(2)}, wantErr: true},
+		{name: "invalid severity", rule: AlertRule{Expr: "disk.usage_percent > 90", Severity: "fatal"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{}
+			cfg.Collectors.CPU.Enabled = true
+			cfg.Collectors.Disk.Enabled = true
+
+			rule := tt.rule
+			rule.Name = "rule"
+			if rule.Severity == "" {
+				rule.Severity = "warning"
+			}
+			cfg.Alerts.Rules = []AlertRule{rule}
+
+			if err := validateAlerts(cfg); (err != nil) != tt.wantErr {
+				t.Errorf("validateAlerts() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -1,6 +1,9 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
@@ -12,6 +15,19 @@ import (
 	"github.com/spf13/viper"
 )
 
+// LogComponents lists the components whose level can be set in
+// log.components.
+var LogComponents = []string{
+	"agent", "alert", "collector", "enroll", "notify",
+	"queue", "remoteconfig", "sender", "status",
+}
+
+// Log outputs.
+const (
+	LogOutputStderr   = "stderr"
+	LogOutputJournald = "journald"
+)
+
 // Application runtime modes.
 const (
 	ModeProduction  = "production"
@@ -27,16 +43,67 @@ const (
 type Config struct {
 	// Agent-specific configuration
 	Agent struct {
-		Name     string        `mapstructure:"name"`
-		Interval time.Duration `mapstructure:"interval"`
+		Name        string        `mapstructure:"name"`
+		Interval    time.Duration `mapstructure:"interval"`
+		Align       bool          `mapstructure:"align"`        // align collections to interval boundaries
+		Splay       time.Duration `mapstructure:"splay"`        // maximum random offset of scheduled collections
+		StateDir    string        `mapstructure:"state_dir"`    // persistent agent state (credentials, keys)
+		WatchConfig bool          `mapstructure:"watch_config"` // reload when the config file changes
 	} `mapstructure:"agent"`
 
 	// Core backend configuration
 	Core struct {
 		Endpoint string `mapstructure:"endpoint"`
-		Token    string `mapstructure:"token"`
+		Token    string `mapstructure:"token" secret:"true"`
+
+		// File containing the token (re-read when it changes)
+		TokenFile string `mapstructure:"token_file"`
+
+		// TLS settings for the connection to Core
+		TLS struct {
+			CAFile     string   `mapstructure:"ca_file"`
+			CertFile   string   `mapstructure:"cert_file"`
+			KeyFile    string   `mapstructure:"key_file"`
+			MinVersion string   `mapstructure:"min_version"` // 1.2, 1.3
+			ServerName string   `mapstructure:"server_name"`
+			PinnedSPKI []string `mapstructure:"pinned_spki"` // base64 SHA-256 of SubjectPublicKeyInfo
+		} `mapstructure:"tls"`
+
+		// Ed25519 signatures over request bodies (key kept in agent.state_dir)
+		Signing struct {
+			Enabled bool `mapstructure:"enabled"`
+		} `mapstructure:"signing"`
+
+		// Sealed-box encryption of request bodies to a Core public key
+		Encryption struct {
+			Enabled   bool   `mapstructure:"enabled"`
+			PublicKey string `mapstructure:"public_key"` // base64 X25519 public key
+			KeyID     string `mapstructure:"key_id"`     // defaults to a hash of the key
+		} `mapstructure:"encryption"`
 	} `mapstructure:"core"`
 
+	// Metric collectors (each can be enabled or disabled)
+	Collectors struct {
+		CPU    CollectorConfig `mapstructure:"cpu"`
+		Memory CollectorConfig `mapstructure:"memory"`
+		Disk   CollectorConfig `mapstructure:"disk"`
+
+		// Sub-interval sampling with min/max/avg/last/p95 aggregation
+		Sampling struct {
+			Enabled    bool          `mapstructure:"enabled"`
+			Interval   time.Duration `mapstructure:"interval"`   // time between samples
+			Collectors []string      `mapstructure:"collectors"` // collectors to sample
+		} `mapstructure:"sampling"`
+	} `mapstructure:"collectors"`
+
+	// Enrollment configuration (exchange a bootstrap token for a per-agent credential)
+	Enroll struct {
+		Enabled        bool          `mapstructure:"enabled"`
+		Endpoint       string        `mapstructure:"endpoint"`
+		BootstrapToken string        `mapstructure:"bootstrap_token" secret:"true"`
+		MinInterval    time.Duration `mapstructure:"min_interval"` // minimum time between re-enrollments
+	} `mapstructure:"enroll"`
+
 	// Sender configuration
 	Sender struct {
 		MaxRetries        int           `mapstructure:"max_retries"`
@@ -44,25 +111,207 @@ type Config struct {
 		MaxRetryDelay     time.Duration `mapstructure:"max_retry_delay"`
 		RequestTimeout    time.Duration `mapstructure:"request_timeout"`
 		ClientTimeout     time.Duration `mapstructure:"client_timeout"`
+
+		// Circuit breaker around the Core endpoint
+		Breaker struct {
+			Enabled          bool          `mapstructure:"enabled"`
+			FailureThreshold int           `mapstructure:"failure_threshold"`
+			CoolDown         time.Duration `mapstructure:"cool_down"`
+		} `mapstructure:"breaker"`
 	} `mapstructure:"sender"`
 
+	// Outgoing snapshot queue (decouples collection from sending)
+	Queue struct {
+		Size          int    `mapstructure:"size"`            // snapshots held in memory
+		Overflow      string `mapstructure:"overflow"`        // drop_oldest, drop_newest, spill
+		SpillMaxFiles int    `mapstructure:"spill_max_files"` // snapshots kept on disk (spill)
+	} `mapstructure:"queue"`
+
+	// Graceful shutdown
+	Shutdown struct {
+		Timeout       time.Duration `mapstructure:"timeout"`        // deadline for flushing queued snapshots
+		FinalSnapshot bool          `mapstructure:"final_snapshot"` // collect one last snapshot before flushing
+	} `mapstructure:"shutdown"`
+
+	// Remote configuration delivered by Core
+	RemoteConfig struct {
+		Enabled      bool          `mapstructure:"enabled"`
+		Endpoint     string        `mapstructure:"endpoint"`      // polled with GET; empty = only via sender responses
+		PollInterval time.Duration `mapstructure:"poll_interval"` // how often the endpoint is polled
+		PinnedKeys   []string      `mapstructure:"pinned_keys"`   // local keys remote config cannot override
+	} `mapstructure:"remote_config"`
+
+	// Local threshold alerting
+	Alerts struct {
+		Endpoint string      `mapstructure:"endpoint"` // Core endpoint events are posted to immediately; empty = payload only
+		Rules    []AlertRule `mapstructure:"rules"`
+	} `mapstructure:"alerts"`
+
+	// Local notification channels for alert events
+	Notify struct {
+		Channels []NotifyChannel `mapstructure:"channels"`
+	} `mapstructure:"notify"`
+
+	// Local health and status HTTP API (off by default)
+	Status struct {
+		Enabled bool   `mapstructure:"enabled"`
+		Listen  string `mapstructure:"listen"` // loopback address; empty = unix socket only
+		Socket  string `mapstructure:"socket"` // unix socket path; empty = TCP only
+
+		// /readyz fails if the last collection or successful send is older (0 = 3 intervals)
+		ReadyCollectAge time.Duration `mapstructure:"ready_collect_age"`
+		ReadySendAge    time.Duration `mapstructure:"ready_send_age"`
+	} `mapstructure:"status"`
+
+	// Outbound proxy configuration (applies to every HTTP-based sender)
+	Proxy struct {
+		URL             string   `mapstructure:"url" secret:"url"` // http://, https://, socks5://
+		FromEnvironment bool     `mapstructure:"from_environment"` // HTTP_PROXY, HTTPS_PROXY, NO_PROXY
+		NoProxy         []string `mapstructure:"no_proxy"`         // bypass list (NO_PROXY syntax)
+	} `mapstructure:"proxy"`
+
 	// Logging configuration
 	Log struct {
 		Level  string `mapstructure:"level"`  // debug, info, warn, error, fatal, panic
 		Pretty bool   `mapstructure:"pretty"` // human-readable console output
+		Output string `mapstructure:"output"` // stderr, journald
+
+		// Additional JSON log file with rotation (disabled if path is empty)
+		File LogFileConfig `mapstructure:"file"`
+
+		// Per-component levels overriding level, e.g. {sender: debug}
+		Components map[string]string `mapstructure:"components"`
+
+		// Repeated messages: at most burst per period (burst 0 = no sampling)
+		Sampling struct {
+			Burst  int           `mapstructure:"burst"`
+			Period time.Duration `mapstructure:"period"`
+		} `mapstructure:"sampling"`
+
+		// Forwarding of the agent's own warnings and errors to Core (off by default)
+		Ship struct {
+			Enabled           bool          `mapstructure:"enabled"`
+			Endpoint          string        `mapstructure:"endpoint"`       // Core log endpoint
+			Level             string        `mapstructure:"level"`          // minimum level shipped
+			BufferSize        int           `mapstructure:"buffer_size"`    // entries kept while Core is unreachable
+			BatchSize         int           `mapstructure:"batch_size"`     // entries per request
+			FlushInterval     time.Duration `mapstructure:"flush_interval"` // time between requests
+			MaxRetries        int           `mapstructure:"max_retries"`
+			InitialRetryDelay time.Duration `mapstructure:"initial_retry_delay"`
+			MaxRetryDelay     time.Duration `mapstructure:"max_retry_delay"`
+		} `mapstructure:"ship"`
 	} `mapstructure:"log"`
 
+	// Limits on the agent's own resource usage
+	Resources struct {
+		MemoryLimitMB int           `mapstructure:"memory_limit_mb"` // soft Go memory limit (0 = none)
+		MaxProcs      int           `mapstructure:"max_procs"`       // GOMAXPROCS (0 = Go default)
+		CPUBudget     time.Duration `mapstructure:"cpu_budget"`      // CPU time per collection, shared by the collectors (0 = unlimited)
+
+		// Collectors exceeding their share of cpu_budget run less often
+		Backoff struct {
+			After     int `mapstructure:"after"`      // consecutive collections over (or within) the share
+			MaxFactor int `mapstructure:"max_factor"` // longest backoff, in collection intervals
+		} `mapstructure:"backoff"`
+	} `mapstructure:"resources"`
+
+	// Privilege dropping and sandboxing at startup (Linux)
+	Sandbox struct {
+		User         string   `mapstructure:"user"`         // user to switch to after startup (requires root)
+		Group        string   `mapstructure:"group"`        // defaults to the user's primary group
+		Capabilities []string `mapstructure:"capabilities"` // kept after switching, e.g. CAP_DAC_READ_SEARCH
+		NoNewPrivs   bool     `mapstructure:"no_new_privs"`
+
+		// Filesystem access restricted to the paths the agent needs
+		Landlock struct {
+			Enabled    bool     `mapstructure:"enabled"`
+			ReadPaths  []string `mapstructure:"read_paths"`  // additional read-only paths
+			WritePaths []string `mapstructure:"write_paths"` // additional writable paths
+		} `mapstructure:"landlock"`
+	} `mapstructure:"sandbox"`
+
+	// Redaction of credentials in errors, printouts and command lines
+	Redact struct {
+		Patterns []string `mapstructure:"patterns"` // regular expressions masked in addition to the built-in rules
+	} `mapstructure:"redact"`
+
 	// Application mode (development or production)
 	Mode string `mapstructure:"mode"`
+
+	// Path of the configuration file in use (empty if none was found)
+	File string `mapstructure:"-"`
+}
+
+// CollectorConfig contains settings shared by all metric collectors.
+type CollectorConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+}
+
+// LogFileConfig contains settings of the log file output.
+type LogFileConfig struct {
+	Path           string        `mapstructure:"path"`
+	MaxSizeMB      int           `mapstructure:"max_size_mb"`     // rotate when the file grows larger
+	RotateInterval time.Duration `mapstructure:"rotate_interval"` // rotate when the file gets older (0 = never)
+	MaxBackups     int           `mapstructure:"max_backups"`     // rotated files kept (0 = unlimited)
+	MaxAge         time.Duration `mapstructure:"max_age"`         // rotated files deleted when older (0 = never)
+}
+
+// collectorNames lists the names of all supported collectors.
+var collectorNames = []string{"cpu", "memory", "disk"}
+
+// EnabledCollectors returns the names of all enabled collectors.
+func (c *Config) EnabledCollectors() []string {
+	var names []string
+
+	if c.Collectors.CPU.Enabled {
+		names = append(names, "cpu")
+	}
+	if c.Collectors.Memory.Enabled {
+		names = append(names, "memory")
+	}
+	if c.Collectors.Disk.Enabled {
+		names = append(names, "disk")
+	}
+
+	return names
+}
+
+// Hash returns a short fingerprint of the effective configuration, so
+// agents running the same configuration can be recognized. It is computed
+// over the redacted configuration: the fingerprint is published (payload,
+// status API, diagnostics) and must not allow guessing secrets, so
+// changing only a secret does not change it.
+func (c *Config) Hash() string {
+	data, err := json.Marshal(c.Redacted())
+	if err != nil {
+		return ""
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
 }
 
 // Load loads configuration from defaults, configuration file,
 // and environment variables, then validates the result.
 //
+// Any string value may contain ${env:VAR} or ${file:/path} references,
+// which are resolved before validation.
+//
 // The function fails fast on:
 //   - Invalid configuration file
 //   - Invalid or missing required configuration values
 func Load() (*Config, error) {
+	v, err := newViper()
+	if err != nil {
+		return nil, err
+	}
+
+	return build(v)
+}
+
+// newViper creates a viper instance populated with defaults, the optional
+// configuration file and environment variables.
+func newViper() (*viper.Viper, error) {
 	v := viper.New()
 
 	// Register default values
@@ -91,11 +340,23 @@ func Load() (*Config, error) {
 		}
 	}
 
+	return v, nil
+}
+
+// build unmarshals, resolves, normalizes and validates the configuration
+// held by v.
+func build(v *viper.Viper) (*Config, error) {
 	// Unmarshal configuration into struct
 	var cfg Config
 	if err := v.Unmarshal(&cfg); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
 	}
+	cfg.File = v.ConfigFileUsed()
+
+	// Resolve ${env:VAR} and ${file:/path} references
+	if err := resolveReferences(&cfg); err != nil {
+		return nil, err
+	}
 
 	// Normalize configuration
 	normalizeConfig(&cfg)
@@ -108,6 +369,16 @@ func Load() (*Config, error) {
 	return &cfg, nil
 }
 
+// getStateDir returns the default state directory for the current OS
+func getStateDir() string {
+	if configDir := getConfigDir(); configDir != "" {
+		return filepath.Join(configDir, "state")
+	}
+	// No shared fallback such as the temporary directory: other users
+	// could create it first. agent.state_dir must then be configured.
+	return ""
+}
+
 // getConfigDir returns the appropriate config directory for the current OS
 func getConfigDir() string {
 	if runtime.GOOS == "windows" {
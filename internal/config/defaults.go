@@ -14,15 +14,110 @@ import (
 func setDefaults(v *viper.Viper) {
 	// Agent defaults
 	v.SetDefault("agent.interval", 30*time.Second)
+	v.SetDefault("agent.align", false)
+	v.SetDefault("agent.splay", 0)
 	v.SetDefault("agent.name", getDefaultAgentName())
+	v.SetDefault("agent.state_dir", getStateDir())
+	v.SetDefault("agent.watch_config", false)
+
+	// Collector defaults (all enabled)
+	v.SetDefault("collectors.cpu.enabled", true)
+	v.SetDefault("collectors.memory.enabled", true)
+	v.SetDefault("collectors.disk.enabled", true)
+	v.SetDefault("collectors.sampling.enabled", false)
+	v.SetDefault("collectors.sampling.interval", 1*time.Second)
+	v.SetDefault("collectors.sampling.collectors", []string{"cpu", "memory"})
 
 	// Core defaults (empty by default, required in production)
 	v.SetDefault("core.endpoint", "")
 	v.SetDefault("core.token", "")
+	v.SetDefault("core.token_file", "")
+	v.SetDefault("core.tls.min_version", "1.2")
+	v.SetDefault("core.signing.enabled", false)
+	v.SetDefault("core.encryption.enabled", false)
+	v.SetDefault("core.encryption.public_key", "")
+	v.SetDefault("core.encryption.key_id", "")
+
+	// Enrollment defaults (disabled, static token is used)
+	v.SetDefault("enroll.enabled", false)
+	v.SetDefault("enroll.endpoint", "")
+	v.SetDefault("enroll.bootstrap_token", "")
+	v.SetDefault("enroll.min_interval", 5*time.Minute)
+
+	// Queue defaults
+	v.SetDefault("queue.size", 100)
+	v.SetDefault("queue.overflow", "drop_oldest")
+	v.SetDefault("queue.spill_max_files", 10000)
+
+	// Shutdown defaults
+	v.SetDefault("shutdown.timeout", 10*time.Second)
+	v.SetDefault("shutdown.final_snapshot", false)
+
+	// Status API defaults (disabled, loopback only)
+	v.SetDefault("status.enabled", false)
+	v.SetDefault("status.listen", "127.0.0.1:9925")
+	v.SetDefault("status.socket", "")
+	v.SetDefault("status.ready_collect_age", 0)
+	v.SetDefault("status.ready_send_age", 0)
+
+	// Remote configuration defaults (disabled)
+	v.SetDefault("remote_config.enabled", false)
+	v.SetDefault("remote_config.endpoint", "")
+	v.SetDefault("remote_config.poll_interval", 5*time.Minute)
+	v.SetDefault("remote_config.pinned_keys", []string{})
+
+	// Alerting defaults (no rules)
+	v.SetDefault("alerts.endpoint", "")
+	v.SetDefault("alerts.rules", []AlertRule{})
+
+	// Notification defaults (no channels)
+	v.SetDefault("notify.channels", []NotifyChannel{})
+
+	// Proxy defaults (standard proxy environment variables are honored)
+	v.SetDefault("proxy.url", "")
+	v.SetDefault("proxy.from_environment", true)
+	v.SetDefault("proxy.no_proxy", []string{})
 
 	// Logging defaults
 	v.SetDefault("log.level", "info")
 	v.SetDefault("log.pretty", true)
+	v.SetDefault("log.output", LogOutputStderr)
+	v.SetDefault("log.file.path", "")
+	v.SetDefault("log.file.max_size_mb", 100)
+	v.SetDefault("log.file.rotate_interval", 0)
+	v.SetDefault("log.file.max_backups", 5)
+	v.SetDefault("log.file.max_age", 30*24*time.Hour)
+	v.SetDefault("log.components", map[string]string{})
+	v.SetDefault("log.sampling.burst", 0)
+	v.SetDefault("log.sampling.period", 10*time.Minute)
+	v.SetDefault("log.ship.enabled", false)
+	v.SetDefault("log.ship.endpoint", "")
+	v.SetDefault("log.ship.level", "warn")
+	v.SetDefault("log.ship.buffer_size", 1000)
+	v.SetDefault("log.ship.batch_size", 100)
+	v.SetDefault("log.ship.flush_interval", 10*time.Second)
+	v.SetDefault("log.ship.max_retries", 3)
+	v.SetDefault("log.ship.initial_retry_delay", 2*time.Second)
+	v.SetDefault("log.ship.max_retry_delay", 1*time.Minute)
+
+	// Resource defaults (no limits)
+	v.SetDefault("resources.memory_limit_mb", 0)
+	v.SetDefault("resources.max_procs", 0)
+	v.SetDefault("resources.cpu_budget", 0)
+	v.SetDefault("resources.backoff.after", 3)
+	v.SetDefault("resources.backoff.max_factor", 8)
+
+	// Sandbox defaults (privileges are kept as started)
+	v.SetDefault("sandbox.user", "")
+	v.SetDefault("sandbox.group", "")
+	v.SetDefault("sandbox.capabilities", []string{})
+	v.SetDefault("sandbox.no_new_privs", false)
+	v.SetDefault("sandbox.landlock.enabled", false)
+	v.SetDefault("sandbox.landlock.read_paths", []string{})
+	v.SetDefault("sandbox.landlock.write_paths", []string{})
+
+	// Redaction defaults (built-in rules only)
+	v.SetDefault("redact.patterns", []string{})
 
 	// Sender defaults
 	v.SetDefault("sender.max_retries", 3)
@@ -30,6 +125,9 @@ func setDefaults(v *viper.Viper) {
 	v.SetDefault("sender.max_retry_delay", 30*time.Second)
 	v.SetDefault("sender.request_timeout", 10*time.Second)
 	v.SetDefault("sender.client_timeout", 30*time.Second)
+	v.SetDefault("sender.breaker.enabled", true)
+	v.SetDefault("sender.breaker.failure_threshold", 5)
+	v.SetDefault("sender.breaker.cool_down", 1*time.Minute)
 
 	// Application mode
 	v.SetDefault("mode", ModeDevelopment)
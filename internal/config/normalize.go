@@ -6,4 +6,35 @@ import "strings"
 // a canonical form for internal use.
 func normalizeConfig(cfg *Config) {
 	cfg.Log.Level = strings.ToLower(cfg.Log.Level)
+	cfg.Log.Output = strings.ToLower(cfg.Log.Output)
+	cfg.Log.Ship.Level = strings.ToLower(cfg.Log.Ship.Level)
+	for component, level := range cfg.Log.Components {
+		cfg.Log.Components[component] = strings.ToLower(level)
+	}
+	cfg.Queue.Overflow = strings.ToLower(cfg.Queue.Overflow)
+
+	for i, capability := range cfg.Sandbox.Capabilities {
+		capability = strings.ToUpper(capability)
+		if !strings.HasPrefix(capability, "CAP_") {
+			capability = "CAP_" + capability
+		}
+		cfg.Sandbox.Capabilities[i] = capability
+	}
+
+	for i := range cfg.Alerts.Rules {
+		rule := &cfg.Alerts.Rules[i]
+		rule.Severity = strings.ToLower(rule.Severity)
+		if rule.Severity == "" {
+			rule.Severity = "warning"
+		}
+	}
+
+	for i := range cfg.Notify.Channels {
+		channel := &cfg.Notify.Channels[i]
+		channel.Type = strings.ToLower(channel.Type)
+		for j, severity := range channel.Severities {
+			channel.Severities[j] = strings.ToLower(severity)
+		}
+		normalizeNotifyChannel(channel)
+	}
 }
@@ -0,0 +1,167 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"dideban-agent/internal/redact"
+)
+
+// Supported notification channel types.
+const (
+	ChannelWebhook = "webhook"
+	ChannelSlack   = "slack"
+	ChannelSMTP    = "smtp"
+	ChannelExec    = "exec"
+)
+
+// NotifyChannel defines a local notification channel for alert events.
+type NotifyChannel struct {
+	// Unique channel name
+	Name string `mapstructure:"name"`
+
+	// Channel type: webhook, slack, smtp, exec
+	Type string `mapstructure:"type"`
+
+	// Target URL (webhook, slack); Slack and webhook URLs often embed a token
+	URL string `mapstructure:"url" secret:"true"`
+
+	// Additional HTTP headers (webhook); values are secret
+	Headers map[string]string `mapstructure:"headers" secret:"true"`
+
+	// Go template for the webhook body, Slack text or email body
+	// (empty = channel default)
+	Template string `mapstructure:"template"`
+
+	// Email delivery through a local relay (smtp)
+	SMTP struct {
+		Host     string   `mapstructure:"host"`
+		Port     int      `mapstructure:"port"`
+		Username string   `mapstructure:"username"`
+		Password string   `mapstructure:"password" secret:"true"`
+		StartTLS bool     `mapstructure:"starttls"` // required for authentication unless the relay is local
+		From     string   `mapstructure:"from"`
+		To       []string `mapstructure:"to"`
+		Subject  string   `mapstructure:"subject"` // Go template (empty = default)
+	} `mapstructure:"smtp"`
+
+	// Command and arguments to run; the event is passed as JSON on stdin (exec)
+	Command []string `mapstructure:"command" secret:"cmdline"`
+
+	// Severities that trigger the channel (empty = all)
+	Severities []string `mapstructure:"severities"`
+
+	// At most RateLimit notifications per RatePeriod (0 = unlimited)
+	RateLimit  int           `mapstructure:"rate_limit"`
+	RatePeriod time.Duration `mapstructure:"rate_period"`
+
+	// Delivery retries after the first attempt
+	Retries    int           `mapstructure:"retries"`
+	RetryDelay time.Duration `mapstructure:"retry_delay"`
+
+	// Notifications with the same deduplication key (Go template) are
+	// sent at most once per DedupWindow (0 = no deduplication)
+	DedupKey    string        `mapstructure:"dedup_key"`
+	DedupWindow time.Duration `mapstructure:"dedup_window"`
+
+	// Timeout of a single delivery attempt
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// Defaults applied to notification channels (list entries cannot use viper defaults).
+const (
+	defaultNotifyRatePeriod = time.Hour
+	defaultNotifyRetryDelay = 5 * time.Second
+	defaultNotifyTimeout    = 10 * time.Second
+	defaultNotifyDedupKey   = "{{.Rule}}/{{.State}}"
+	defaultSMTPPort         = 25
+)
+
+// normalizeNotifyChannel fills in defaults for unset channel settings.
+func normalizeNotifyChannel(channel *NotifyChannel) {
+	if channel.RatePeriod == 0 {
+		channel.RatePeriod = defaultNotifyRatePeriod
+	}
+	if channel.RetryDelay == 0 {
+		channel.RetryDelay = defaultNotifyRetryDelay
+	}
+	if channel.Timeout == 0 {
+		channel.Timeout = defaultNotifyTimeout
+	}
+	if channel.DedupKey == "" {
+		channel.DedupKey = defaultNotifyDedupKey
+	}
+	if channel.Type == ChannelSMTP && channel.SMTP.Port == 0 {
+		channel.SMTP.Port = defaultSMTPPort
+	}
+}
+
+// validateNotify validates local notification channels.
+// Templates are checked when the channels are created.
+func validateNotify(cfg *Config) error {
+	names := make(map[string]struct{}, len(cfg.Notify.Channels))
+
+	for i, channel := range cfg.Notify.Channels {
+		if channel.Name == "" {
+			return fmt.Errorf("config: notify.channels[%d].name is required", i)
+		}
+
+		if _, ok := names[channel.Name]; ok {
+			return fmt.Errorf("config: duplicate notification channel name: %s", channel.Name)
+		}
+		names[channel.Name] = struct{}{}
+
+		if err := validateNotifyChannel(&channel); err != nil {
+			return fmt.Errorf("config: notify channel %s: %w", channel.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// validateNotifyChannel validates the settings of a single channel.
+func validateNotifyChannel(channel *NotifyChannel) error {
+	switch channel.Type {
+	case ChannelWebhook, ChannelSlack:
+		target, err := url.Parse(channel.URL)
+		if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+			return fmt.Errorf("invalid url: %s", redact.URL(channel.URL))
+		}
+
+	case ChannelSMTP:
+		if channel.SMTP.Host == "" {
+			return fmt.Errorf("smtp.host is required")
+		}
+		if channel.SMTP.Port <= 0 || channel.SMTP.Port > 65535 {
+			return fmt.Errorf("invalid smtp.port: %d", channel.SMTP.Port)
+		}
+		if channel.SMTP.From == "" || len(channel.SMTP.To) == 0 {
+			return fmt.Errorf("smtp.from and smtp.to are required")
+		}
+
+	case ChannelExec:
+		if len(channel.Command) == 0 || channel.Command[0] == "" {
+			return fmt.Errorf("command is required")
+		}
+
+	default:
+		return fmt.Errorf("invalid type: %q (valid: webhook, slack, smtp, exec)", channel.Type)
+	}
+
+	for _, severity := range channel.Severities {
+		if _, ok := validAlertSeverities[severity]; !ok {
+			return fmt.Errorf("invalid severity: %s (valid: info, warning, critical)", severity)
+		}
+	}
+
+	if channel.RateLimit < 0 || channel.Retries < 0 || channel.DedupWindow < 0 {
+		return fmt.Errorf("rate_limit, retries and dedup_window must be >= 0")
+	}
+
+	if channel.RatePeriod <= 0 || channel.RetryDelay <= 0 || channel.Timeout <= 0 {
+		return fmt.Errorf("rate_period, retry_delay and timeout must be > 0")
+	}
+
+	return nil
+}
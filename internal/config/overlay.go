@@ -0,0 +1,225 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// tunableKeys are the only keys an overlay may change; remote_config.pinned_keys
+// narrows them further. Everything else stays local: keys that control how
+// the agent reaches and authenticates against Core (a bad remote document
+// could lock the agent out or send its token elsewhere), destinations that
+// receive data or credentials (alert and log endpoints, proxy, notification
+// channels, which include commands), file paths, resource limits, the status
+// API, redaction and the sandbox.
+var tunableKeys = []string{
+	"agent.name",
+	"agent.interval",
+	"agent.align",
+	"agent.splay",
+	"collectors.*",
+	"sender.*",
+	"queue.*",
+	"shutdown.*",
+	"alerts.rules",
+	"log.level",
+	"log.components",
+	"log.sampling.*",
+	"log.ship.enabled",
+	"log.ship.level",
+	"log.ship.buffer_size",
+	"log.ship.batch_size",
+	"log.ship.flush_interval",
+	"log.ship.max_retries",
+	"log.ship.initial_retry_delay",
+	"log.ship.max_retry_delay",
+}
+
+// Overlay is a set of configuration values applied on top of the local
+// configuration sources (e.g. a configuration document delivered by Core).
+type Overlay struct {
+	// Version identifies the overlay document
+	Version string
+
+	// Values is a nested map using the same keys as the configuration file
+	Values map[string]any
+}
+
+// OverlayResult describes how an overlay was applied.
+type OverlayResult struct {
+	// Keys applied from the overlay
+	Applied []string
+
+	// Keys ignored because they are not tunable or pinned by local configuration
+	Ignored []string
+}
+
+// LoadWithOverlay loads configuration like Load and applies the overlay
+// on top of all local sources before validation.
+//
+// Keys that are not tunable or are pinned locally (remote_config.pinned_keys)
+// are ignored and reported in the result. Unknown keys and ${...}
+// references make the overlay invalid; references are only resolved in
+// local sources, so Core cannot read local files or environment variables.
+func LoadWithOverlay(overlay *Overlay) (*Config, *OverlayResult, error) {
+	v, err := newViper()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result := &OverlayResult{}
+
+	if overlay != nil {
+		values, err := flattenOverlay(overlay.Values)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		pinned := v.GetStringSlice("remote_config.pinned_keys")
+
+		for _, key := range sortedKeys(values) {
+			if hasReference(values[key]) {
+				return nil, nil, fmt.Errorf("config: references are not allowed in overlay values: %s", key)
+			}
+
+			if !isPinned(key, tunableKeys) || isPinned(key, pinned) {
+				result.Ignored = append(result.Ignored, key)
+				continue
+			}
+
+			v.Set(key, values[key])
+			result.Applied = append(result.Applied, key)
+		}
+	}
+
+	cfg, err := build(v)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return cfg, result, nil
+}
+
+// isPinned reports whether key matches one of the pinned patterns.
+// A pattern matches the key itself and, if it ends in ".*" or names a
+// section, every key below it.
+func isPinned(key string, patterns []string) bool {
+	for _, pattern := range patterns {
+		section := strings.TrimSuffix(pattern, ".*")
+		if key == section || strings.HasPrefix(key, section+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// hasReference reports whether an overlay value contains a ${...}
+// reference, also inside lists and maps.
+func hasReference(value any) bool {
+	switch value := value.(type) {
+	case string:
+		return strings.Contains(value, "${")
+	case []any:
+		return slices.ContainsFunc(value, hasReference)
+	case []string:
+		return slices.ContainsFunc(value, func(s string) bool { return strings.Contains(s, "${") })
+	case map[string]any:
+		for k, nested := range value {
+			if strings.Contains(k, "${") || hasReference(nested) {
+				return true
+			}
+		}
+	case map[string]string:
+		for k, nested := range value {
+			if strings.Contains(k, "${") || strings.Contains(nested, "${") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// flattenOverlay converts a nested overlay map into dotted leaf keys.
+func flattenOverlay(values map[string]any) (map[string]any, error) {
+	known := configKeys()
+	flat := make(map[string]any)
+
+	var walk func(prefix string, m map[string]any) error
+	walk = func(prefix string, m map[string]any) error {
+		for k, value := range m {
+			key := strings.ToLower(k)
+			if prefix != "" {
+				key = prefix + "." + key
+			}
+
+			if _, ok := known[key]; ok {
+				flat[key] = value
+				continue
+			}
+
+			nested, ok := value.(map[string]any)
+			if !ok {
+				return fmt.Errorf("config: unknown key in overlay: %s", key)
+			}
+
+			if err := walk(key, nested); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := walk("", values); err != nil {
+		return nil, err
+	}
+
+	return flat, nil
+}
+
+// configKeys returns the set of dotted leaf keys of the Config schema.
+func configKeys() map[string]struct{} {
+	keys := make(map[string]struct{})
+	collectKeys(reflect.TypeFor[Config](), "", keys)
+	return keys
+}
+
+// collectKeys walks the struct type and records its leaf keys.
+func collectKeys(t reflect.Type, prefix string, keys map[string]struct{}) {
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		key := strings.Split(field.Tag.Get("mapstructure"), ",")[0]
+		if key == "-" {
+			continue
+		}
+		if key == "" {
+			key = strings.ToLower(field.Name)
+		}
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+
+		if field.Type.Kind() == reflect.Struct {
+			collectKeys(field.Type, key, keys)
+			continue
+		}
+
+		keys[key] = struct{}{}
+	}
+}
+
+// sortedKeys returns map keys in a deterministic order.
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,148 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestIsPinned(t *testing.T) {
+	tests := []struct {
+		key      string
+		patterns []string
+		want     bool
+	}{
+		{key: "agent.interval", patterns: []string{"agent.interval"}, want: true},
+		{key: "agent.interval", patterns: []string{"agent.*"}, want: true},
+		{key: "agent.interval", patterns: []string{"agent"}, want: true},
+		{key: "agent.interval", patterns: []string{"agent.name"}, want: false},
+		{key: "agent.intervals", patterns: []string{"agent.interval"}, want: false},
+		{key: "collectors.cpu.enabled", patterns: []string{"collectors.*"}, want: true},
+		{key: "core.token", patterns: tunableKeys, want: false},
+		{key: "core.endpoint", patterns: tunableKeys, want: false},
+		{key: "log.ship.endpoint", patterns: tunableKeys, want: false},
+		{key: "log.ship.level", patterns: tunableKeys, want: true},
+		{key: "notify.channels", patterns: tunableKeys, want: false},
+		{key: "sandbox.user", patterns: tunableKeys, want: false},
+		{key: "alerts.rules", patterns: tunableKeys, want: true},
+		{key: "alerts.endpoint", patterns: tunableKeys, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if got := isPinned(tt.key, tt.patterns); got != tt.want {
+				t.Errorf("isPinned(%q, %q) = %v, want %v", tt.key, tt.patterns, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHasReference(t *testing.T) {
+	tests := []struct {
+		name  string
+		value any
+		want  bool
+	}{
+		{name: "plain string", value: "30s", want: false},
+		{name: "number", value: 30, want: false},
+		{name: "string", value: "${env:HOME}", want: true},
+		{name: "embedded", value: "prefix-${file:/etc/shadow}", want: true},
+		{name: "list", value: []any{"a", "${env:X}"}, want: true},
+		{name: "string list", value: []string{"a", "${env:X}"}, want: true},
+		{name: "nested map", value: map[string]any{"rules": []any{map[string]any{"expr": "${env:X}"}}}, want: true},
+		{name: "map key", value: map[string]any{"${env:X}": "v"}, want: true},
+		{name: "string map", value: map[string]string{"k": "${env:X}"}, want: true},
+		{name: "clean map", value: map[string]any{"level": "debug"}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hasReference(tt.value); got != tt.want {
+				t.Errorf("hasReference(%v) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadWithOverlay(t *testing.T) {
+	tests := []struct {
+		name        string
+		local       string
+		values      map[string]any
+		wantErr     bool
+		wantApplied []string
+		wantIgnored []string
+		check       func(t *testing.T, cfg *Config)
+	}{
+		{
+			name:        "tunable keys",
+			values:      map[string]any{"agent": map[string]any{"interval": "30s"}, "log": map[string]any{"level": "debug"}},
+			wantApplied: []string{"agent.interval", "log.level"},
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.Agent.Interval != 30*time.Second || cfg.Log.Level != "debug" {
+					t.Errorf("interval %v, level %s", cfg.Agent.Interval, cfg.Log.Level)
+				}
+			},
+		},
+		{
+			name:        "connection keys stay local",
+			values:      map[string]any{"core": map[string]any{"endpoint": "https://attacker.example"}, "agent": map[string]any{"state_dir": "/tmp/x"}},
+			wantIgnored: []string{"agent.state_dir", "core.endpoint"},
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.Core.Endpoint == "https://attacker.example" {
+					t.Error("core.endpoint was overridden")
+				}
+			},
+		},
+		{
+			name:        "locally pinned key",
+			local:       "remote_config:\n  pinned_keys: [agent.interval]\n",
+			values:      map[string]any{"agent": map[string]any{"interval": "30s", "name": "remote"}},
+			wantApplied: []string{"agent.name"},
+			wantIgnored: []string{"agent.interval"},
+		},
+		{
+			name:    "reference",
+			values:  map[string]any{"agent": map[string]any{"name": "${env:HOME}"}},
+			wantErr: true,
+		},
+		{
+			name:    "unknown key",
+			values:  map[string]any{"agent": map[string]any{"no_such_key": 1}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid value",
+			values:  map[string]any{"agent": map[string]any{"interval": "-1s"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			local := "mode: development\nagent:\n  name: local\n  state_dir: " + filepath.Join(dir, "state") + "\n" + tt.local
+			if err := os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(local), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			t.Chdir(dir)
+
+			cfg, result, err := LoadWithOverlay(&Overlay{Version: "1", Values: tt.values})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadWithOverlay() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			if !slices.Equal(result.Applied, tt.wantApplied) || !slices.Equal(result.Ignored, tt.wantIgnored) {
+				t.Errorf("applied %q, ignored %q, want %q and %q", result.Applied, result.Ignored, tt.wantApplied, tt.wantIgnored)
+			}
+			if tt.check != nil {
+				tt.check(t, cfg)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package config
+
+import (
+	"encoding/json"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+
+	"dideban-agent/internal/redact"
+)
+
+// Configuration fields holding credentials carry a secret tag, which
+// selects how they are redacted:
+//
+//	secret:"true"     the value is replaced (map keys are kept)
+//	secret:"url"      only the password in the URL's user info is replaced
+//	secret:"cmdline"  credential arguments are replaced (redact.Cmdline)
+const secretTag = "secret"
+
+// Redacted returns the configuration as a nested map keyed like the
+// configuration file, with credentials replaced and durations written
+// as strings. It is meant for display (e.g. the status API).
+func (c *Config) Redacted() map[string]any {
+	return redactStruct(reflect.ValueOf(c).Elem())
+}
+
+// String returns the redacted configuration as JSON, so that printing a
+// configuration never reveals credentials.
+func (c *Config) String() string {
+	data, err := json.Marshal(c.Redacted())
+	if err != nil {
+		return redact.Mask
+	}
+	return string(data)
+}
+
+// redactStruct converts a struct into a map keyed by mapstructure names.
+func redactStruct(v reflect.Value) map[string]any {
+	t := v.Type()
+	out := make(map[string]any, t.NumField())
+
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name := strings.Split(field.Tag.Get("mapstructure"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+
+		out[name] = redactValue(v.Field(i), field.Tag.Get(secretTag))
+	}
+
+	return out
+}
+
+// redactValue converts a configuration value for display according to
+// the secret tag of its field.
+func redactValue(v reflect.Value, secret string) any {
+	switch {
+	case secret == "true" && !v.IsZero():
+		if v.Kind() == reflect.Map {
+			// Keep header names, hide their values
+			out := make(map[string]any, v.Len())
+			for _, k := range v.MapKeys() {
+				out[k.String()] = redact.Mask
+			}
+			return out
+		}
+		return redact.Mask
+
+	case secret == "url" && !v.IsZero():
+		if u, err := url.Parse(v.String()); err == nil {
+			return u.Redacted()
+		}
+		return redact.Mask
+
+	case secret == "cmdline" && !v.IsNil():
+		return redact.Cmdline(v.Interface().([]string))
+	}
+
+	if v.Type() == reflect.TypeFor[time.Duration]() {
+		return time.Duration(v.Int()).String()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		return redactStruct(v)
+
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil
+		}
+		out := make([]any, v.Len())
+		for i := range v.Len() {
+			out[i] = redactValue(v.Index(i), secret)
+		}
+		return out
+
+	case reflect.Pointer:
+		if v.IsNil() {
+			return nil
+		}
+		return redactValue(v.Elem(), secret)
+
+	default:
+		return v.Interface()
+	}
+}
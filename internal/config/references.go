@@ -0,0 +1,122 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// referencePattern matches secret references such as ${env:VAR} and ${file:/path}.
+var referencePattern = regexp.MustCompile(`\$\{(env|file):([^}]+)\}`)
+
+// resolveReferences expands ${env:VAR} and ${file:/path} references in
+// every string value of the configuration.
+//
+// References may be embedded in longer strings. File contents are trimmed
+// of surrounding whitespace. An unresolvable reference is an error.
+func resolveReferences(cfg *Config) error {
+	return resolveValue(reflect.ValueOf(cfg).Elem(), "")
+}
+
+// resolveValue walks a configuration value recursively.
+// path is the dotted configuration key used in error messages.
+func resolveValue(v reflect.Value, path string) error {
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := range v.NumField() {
+			field := v.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+
+			key := strings.Split(field.Tag.Get("mapstructure"), ",")[0]
+			if key == "-" {
+				continue
+			}
+			if key == "" {
+				key = strings.ToLower(field.Name)
+			}
+			if path != "" {
+				key = path + "." + key
+			}
+
+			if err := resolveValue(v.Field(i), key); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Slice:
+		for i := range v.Len() {
+			if err := resolveValue(v.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Map:
+		for _, key := range v.MapKeys() {
+			elem := v.MapIndex(key)
+			if elem.Kind() != reflect.String {
+				continue
+			}
+
+			resolved, err := expandReferences(elem.String())
+			if err != nil {
+				return fmt.Errorf("config: %s.%v: %w", path, key, err)
+			}
+			v.SetMapIndex(key, reflect.ValueOf(resolved).Convert(elem.Type()))
+		}
+
+	case reflect.String:
+		resolved, err := expandReferences(v.String())
+		if err != nil {
+			return fmt.Errorf("config: %s: %w", path, err)
+		}
+		v.SetString(resolved)
+	}
+
+	return nil
+}
+
+// expandReferences replaces all references in s with their values.
+func expandReferences(s string) (string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+
+	var firstErr error
+
+	expanded := referencePattern.ReplaceAllStringFunc(s, func(ref string) string {
+		match := referencePattern.FindStringSubmatch(ref)
+		value, err := lookupReference(match[1], match[2])
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		return value
+	})
+
+	return expanded, firstErr
+}
+
+// lookupReference resolves a single reference of the given kind.
+func lookupReference(kind, name string) (string, error) {
+	switch kind {
+	case "env":
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s referenced but not set", name)
+		}
+		return value, nil
+
+	case "file":
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return "", fmt.Errorf("failed to read referenced file: %w", err)
+		}
+		return strings.TrimSpace(string(data)), nil
+
+	default:
+		return "", fmt.Errorf("unknown reference type: %s", kind)
+	}
+}
@@ -0,0 +1,85 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestExpandReferences(t *testing.T) {
+	dir := t.TempDir()
+	secretFile := filepath.Join(dir, "secret")
+	if err := os.WriteFile(secretFile, []byte("  file-value\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DIDEBAN_TEST_TOKEN", "env-value")
+
+	tests := []struct {
+		name    string
+		in      string
+		want    string
+		wantErr string
+	}{
+		{name: "plain", in: "value", want: "value"},
+		{name: "env", in: "${env:DIDEBAN_TEST_TOKEN}", want: "env-value"},
+		{name: "file trimmed", in: "${file:" + secretFile + "}", want: "file-value"},
+		{name: "embedded", in: "Bearer ${env:DIDEBAN_TEST_TOKEN}", want: "Bearer env-value"},
+		{name: "several", in: "${env:DIDEBAN_TEST_TOKEN}:${file:" + secretFile + "}", want: "env-value:file-value"},
+		{name: "unknown kind kept", in: "${vault:secret}", want: "${vault:secret}"},
+		{name: "unset env", in: "${env:DIDEBAN_TEST_UNSET}", wantErr: "DIDEBAN_TEST_UNSET"},
+		{name: "missing file", in: "${file:" + filepath.Join(dir, "missing") + "}", wantErr: "failed to read referenced file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expandReferences(tt.in)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expandReferences(%q) error = %v, want %q", tt.in, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expandReferences(%q) error = %v", tt.in, err)
+			}
+			if got != tt.want {
+				t.Errorf("expandReferences(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveReferences(t *testing.T) {
+	t.Setenv("DIDEBAN_TEST_TOKEN", "env-value")
+
+	cfg := &Config{}
+	cfg.Core.Token = "${env:DIDEBAN_TEST_TOKEN}"
+	cfg.Redact.Patterns = []string{"plain", "${env:DIDEBAN_TEST_TOKEN}"}
+	cfg.Notify.Channels = []NotifyChannel{{
+		Name:    "ops",
+		Headers: map[string]string{"Authorization": "Bearer ${env:DIDEBAN_TEST_TOKEN}"},
+	}}
+
+	if err := resolveReferences(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Core.Token != "env-value" {
+		t.Errorf("core.token = %q", cfg.Core.Token)
+	}
+	if !slices.Equal(cfg.Redact.Patterns, []string{"plain", "env-value"}) {
+		t.Errorf("redact.patterns = %q", cfg.Redact.Patterns)
+	}
+	if got := cfg.Notify.Channels[0].Headers["Authorization"]; got != "Bearer env-value" {
+		t.Errorf("notify.channels[0].headers.Authorization = %q", got)
+	}
+
+	// Errors name the configuration key
+	cfg.Notify.Channels[0].Headers["Authorization"] = "${env:DIDEBAN_TEST_UNSET}"
+	err := resolveReferences(cfg)
+	if err == nil || !strings.Contains(err.Error(), "notify.channels[0].headers.Authorization") {
+		t.Errorf("resolveReferences() error = %v, want the key of the reference", err)
+	}
+}
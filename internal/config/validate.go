@@ -1,7 +1,18 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
 	"fmt"
+	"net"
+	"net/url"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+
+	"dideban-agent/internal/redact"
+	"dideban-agent/pkg/sealedbox"
 )
 
 type configValidator func(*Config) error
@@ -11,10 +22,21 @@ type configValidator func(*Config) error
 func validateConfig(cfg *Config) error {
 	validators := []configValidator{
 		validateAgent,
+		validateCollectors,
 		validateMode,
 		validateCore,
 		validateSender,
+		validateQueue,
+		validateShutdown,
+		validateStatus,
+		validateRemoteConfig,
+		validateAlerts,
+		validateNotify,
+		validateProxy,
 		validateLog,
+		validateResources,
+		validateSandbox,
+		validateRedact,
 	}
 
 	for _, validator := range validators {
@@ -36,6 +58,52 @@ func validateAgent(cfg *Config) error {
 		return fmt.Errorf("config: agent.interval must be greater than zero")
 	}
 
+	if cfg.Agent.Splay < 0 || cfg.Agent.Splay >= cfg.Agent.Interval {
+		return fmt.Errorf("config: agent.splay must be >= 0 and < agent.interval")
+	}
+
+	return nil
+}
+
+// requireStateDir reports that feature needs agent.state_dir, which has no
+// default when the agent runs without a home directory.
+func requireStateDir(cfg *Config, feature string) error {
+	if cfg.Agent.StateDir == "" {
+		return fmt.Errorf("config: agent.state_dir is required when %s is enabled (no home directory to default to)", feature)
+	}
+	return nil
+}
+
+// validateCollectors ensures at least one collector is enabled and
+// validates sampling settings.
+func validateCollectors(cfg *Config) error {
+	if len(cfg.EnabledCollectors()) == 0 {
+		return fmt.Errorf("config: at least one collector must be enabled")
+	}
+
+	sampling := cfg.Collectors.Sampling
+	if !sampling.Enabled {
+		return nil
+	}
+
+	if sampling.Interval <= 0 || sampling.Interval >= cfg.Agent.Interval {
+		return fmt.Errorf("config: collectors.sampling.interval must be > 0 and < agent.interval")
+	}
+
+	sampled := 0
+	for _, name := range sampling.Collectors {
+		if !slices.Contains(collectorNames, name) {
+			return fmt.Errorf("config: unknown collector in collectors.sampling.collectors: %s", name)
+		}
+		if slices.Contains(cfg.EnabledCollectors(), name) {
+			sampled++
+		}
+	}
+
+	if sampled == 0 {
+		return fmt.Errorf("config: collectors.sampling.collectors must include an enabled collector")
+	}
+
 	return nil
 }
 
@@ -58,8 +126,99 @@ func validateCore(cfg *Config) error {
 		return fmt.Errorf("config: core.endpoint is required in %s mode", cfg.Mode)
 	}
 
-	if cfg.Core.Token == "" {
-		return fmt.Errorf("config: core.token is required in %s mode", cfg.Mode)
+	if err := validateCoreAuth(cfg); err != nil {
+		return err
+	}
+
+	if cfg.Core.Signing.Enabled {
+		if err := requireStateDir(cfg, "core.signing"); err != nil {
+			return err
+		}
+	}
+
+	if err := validateCoreTLS(cfg); err != nil {
+		return err
+	}
+
+	return validateCoreEncryption(cfg)
+}
+
+// validateCoreAuth validates how the agent authenticates against Core:
+// either a static token (core.token / core.token_file) or enrollment.
+func validateCoreAuth(cfg *Config) error {
+	if cfg.Enroll.Enabled {
+		if cfg.Enroll.Endpoint == "" {
+			return fmt.Errorf("config: enroll.endpoint is required when enrollment is enabled")
+		}
+
+		if cfg.Enroll.BootstrapToken == "" {
+			return fmt.Errorf("config: enroll.bootstrap_token is required when enrollment is enabled")
+		}
+
+		if cfg.Enroll.MinInterval <= 0 {
+			return fmt.Errorf("config: enroll.min_interval must be > 0")
+		}
+
+		if cfg.Core.Token != "" || cfg.Core.TokenFile != "" {
+			return fmt.Errorf("config: core.token and core.token_file cannot be used with enrollment")
+		}
+
+		return requireStateDir(cfg, "enrollment")
+	}
+
+	if cfg.Core.Token == "" && cfg.Core.TokenFile == "" {
+		return fmt.Errorf("config: core.token or core.token_file is required in %s mode", cfg.Mode)
+	}
+
+	if cfg.Core.Token != "" && cfg.Core.TokenFile != "" {
+		return fmt.Errorf("config: core.token and core.token_file are mutually exclusive")
+	}
+
+	return nil
+}
+
+// Supported minimum TLS versions.
+var validTLSVersions = map[string]struct{}{
+	"1.2": {},
+	"1.3": {},
+}
+
+// validateCoreTLS validates TLS settings for the connection to Core.
+// Certificate files themselves are loaded (and checked) by the sender.
+func validateCoreTLS(cfg *Config) error {
+	tls := cfg.Core.TLS
+
+	if _, ok := validTLSVersions[tls.MinVersion]; !ok {
+		return fmt.Errorf("config: invalid core.tls.min_version: %s (valid: 1.2, 1.3)", tls.MinVersion)
+	}
+
+	if (tls.CertFile == "") != (tls.KeyFile == "") {
+		return fmt.Errorf("config: core.tls.cert_file and core.tls.key_file must be set together")
+	}
+
+	for _, pin := range tls.PinnedSPKI {
+		hash, err := base64.StdEncoding.DecodeString(pin)
+		if err != nil || len(hash) != sha256.Size {
+			return fmt.Errorf("config: invalid core.tls.pinned_spki entry: %s", pin)
+		}
+	}
+
+	return nil
+}
+
+// validateCoreEncryption validates the Core key bodies are encrypted to.
+func validateCoreEncryption(cfg *Config) error {
+	encryption := cfg.Core.Encryption
+	if !encryption.Enabled {
+		return nil
+	}
+
+	if encryption.PublicKey == "" {
+		return fmt.Errorf("config: core.encryption.public_key is required when encryption is enabled")
+	}
+
+	if _, err := sealedbox.ParsePublicKey(encryption.PublicKey); err != nil {
+		return fmt.Errorf("config: invalid core.encryption.public_key: %w", err)
 	}
 
 	return nil
@@ -97,6 +256,157 @@ func validateSender(cfg *Config) error {
 		return fmt.Errorf("config: sender.client_timeout must be > 0")
 	}
 
+	if cfg.Sender.Breaker.Enabled {
+		if cfg.Sender.Breaker.FailureThreshold <= 0 {
+			return fmt.Errorf("config: sender.breaker.failure_threshold must be > 0")
+		}
+
+		if cfg.Sender.Breaker.CoolDown <= 0 {
+			return fmt.Errorf("config: sender.breaker.cool_down must be > 0")
+		}
+	}
+
+	return nil
+}
+
+// validateRemoteConfig validates remote configuration settings.
+func validateRemoteConfig(cfg *Config) error {
+	if !cfg.RemoteConfig.Enabled {
+		return nil
+	}
+
+	if cfg.Mode != ModeProduction {
+		return fmt.Errorf("config: remote_config requires %s mode", ModeProduction)
+	}
+
+	if cfg.RemoteConfig.Endpoint != "" && cfg.RemoteConfig.PollInterval <= 0 {
+		return fmt.Errorf("config: remote_config.poll_interval must be > 0")
+	}
+
+	known := configKeys()
+	for _, pattern := range cfg.RemoteConfig.PinnedKeys {
+		if !isKnownPattern(pattern, known) {
+			return fmt.Errorf("config: unknown key in remote_config.pinned_keys: %s", pattern)
+		}
+	}
+
+	return requireStateDir(cfg, "remote_config")
+}
+
+// isKnownPattern reports whether a pinned key pattern matches at least
+// one configuration key.
+func isKnownPattern(pattern string, known map[string]struct{}) bool {
+	for key := range known {
+		if isPinned(key, []string{pattern}) {
+			return true
+		}
+	}
+	return false
+}
+
+// Supported queue overflow policies.
+var validOverflowPolicies = map[string]struct{}{
+	"drop_oldest": {},
+	"drop_newest": {},
+	"spill":       {},
+}
+
+// validateQueue validates the outgoing snapshot queue settings.
+func validateQueue(cfg *Config) error {
+	if cfg.Queue.Size <= 0 {
+		return fmt.Errorf("config: queue.size must be greater than zero")
+	}
+
+	if _, ok := validOverflowPolicies[cfg.Queue.Overflow]; !ok {
+		return fmt.Errorf(
+			"config: invalid queue.overflow: %s (valid: drop_oldest, drop_newest, spill)",
+			cfg.Queue.Overflow,
+		)
+	}
+
+	if cfg.Queue.Overflow == "spill" {
+		if cfg.Queue.SpillMaxFiles <= 0 {
+			return fmt.Errorf("config: queue.spill_max_files must be greater than zero")
+		}
+
+		if err := requireStateDir(cfg, "queue.overflow spill"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateShutdown validates graceful shutdown settings.
+func validateShutdown(cfg *Config) error {
+	if cfg.Shutdown.Timeout <= 0 {
+		return fmt.Errorf("config: shutdown.timeout must be greater than zero")
+	}
+
+	return nil
+}
+
+// validateStatus validates the local status API settings. The API only
+// listens on loopback addresses or a unix socket.
+func validateStatus(cfg *Config) error {
+	status := cfg.Status
+	if !status.Enabled {
+		return nil
+	}
+
+	if status.Listen == "" && status.Socket == "" {
+		return fmt.Errorf("config: status requires status.listen or status.socket")
+	}
+
+	if status.Listen != "" {
+		host, _, err := net.SplitHostPort(status.Listen)
+		if err != nil {
+			return fmt.Errorf("config: invalid status.listen: %w", err)
+		}
+
+		ip := net.ParseIP(host)
+		if host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+			return fmt.Errorf("config: status.listen must be a loopback address, got %s", host)
+		}
+	}
+
+	if status.ReadyCollectAge < 0 || status.ReadySendAge < 0 {
+		return fmt.Errorf("config: status.ready_collect_age and status.ready_send_age must be >= 0")
+	}
+
+	return nil
+}
+
+// Supported proxy URL schemes.
+var validProxySchemes = map[string]struct{}{
+	"http":    {},
+	"https":   {},
+	"socks5":  {},
+	"socks5h": {},
+}
+
+// validateProxy validates outbound proxy configuration.
+func validateProxy(cfg *Config) error {
+	if cfg.Proxy.URL == "" {
+		return nil
+	}
+
+	proxyURL, err := url.Parse(cfg.Proxy.URL)
+	if err != nil {
+		return fmt.Errorf("config: invalid proxy.url: %w", redact.Error(err))
+	}
+
+	if _, ok := validProxySchemes[proxyURL.Scheme]; !ok {
+		return fmt.Errorf(
+			"config: invalid proxy.url scheme: %s (valid: http, https, socks5, socks5h)",
+			proxyURL.Scheme,
+		)
+	}
+
+	if proxyURL.Host == "" {
+		return fmt.Errorf("config: proxy.url must include a host")
+	}
+
 	return nil
 }
 
@@ -117,5 +427,139 @@ func validateLog(cfg *Config) error {
 		return fmt.Errorf("config: log.pretty is not allowed in production mode")
 	}
 
+	switch cfg.Log.Output {
+	case LogOutputStderr:
+	case LogOutputJournald:
+		if runtime.GOOS != "linux" {
+			return fmt.Errorf("config: log.output journald is only available on Linux")
+		}
+	default:
+		return fmt.Errorf("config: invalid log.output: %s (valid: stderr, journald)", cfg.Log.Output)
+	}
+
+	for component, level := range cfg.Log.Components {
+		if !slices.Contains(LogComponents, component) {
+			return fmt.Errorf(
+				"config: unknown component in log.components: %s (valid: %s)",
+				component, strings.Join(LogComponents, ", "),
+			)
+		}
+		if _, ok := validLogLevels[level]; !ok {
+			return fmt.Errorf("config: invalid log level for component %s: %s", component, level)
+		}
+	}
+
+	file := cfg.Log.File
+	if file.Path != "" && (file.MaxSizeMB <= 0 || file.RotateInterval < 0 || file.MaxBackups < 0 || file.MaxAge < 0) {
+		return fmt.Errorf("config: log.file.max_size_mb must be > 0 and rotate_interval, max_backups, max_age >= 0")
+	}
+
+	if cfg.Log.Sampling.Burst < 0 || (cfg.Log.Sampling.Burst > 0 && cfg.Log.Sampling.Period <= 0) {
+		return fmt.Errorf("config: log.sampling.burst must be >= 0 and log.sampling.period > 0")
+	}
+
+	return validateLogShip(cfg)
+}
+
+// validateLogShip validates log shipping configuration.
+func validateLogShip(cfg *Config) error {
+	ship := cfg.Log.Ship
+	if !ship.Enabled {
+		return nil
+	}
+
+	endpoint, err := url.Parse(ship.Endpoint)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return fmt.Errorf("config: invalid log.ship.endpoint: %q", ship.Endpoint)
+	}
+
+	if _, ok := validLogLevels[ship.Level]; !ok {
+		return fmt.Errorf("config: invalid log.ship.level: %s", ship.Level)
+	}
+
+	if ship.BufferSize <= 0 || ship.BatchSize <= 0 || ship.FlushInterval <= 0 {
+		return fmt.Errorf("config: log.ship.buffer_size, batch_size and flush_interval must be greater than zero")
+	}
+
+	if ship.MaxRetries < 0 {
+		return fmt.Errorf("config: log.ship.max_retries must be >= 0")
+	}
+
+	if ship.InitialRetryDelay <= 0 || ship.MaxRetryDelay < ship.InitialRetryDelay {
+		return fmt.Errorf("config: log.ship.initial_retry_delay must be > 0 and <= max_retry_delay")
+	}
+
+	return nil
+}
+
+// Capabilities that can be kept after switching users: reading files and
+// process information of other users. Capabilities that allow changing the
+// system or escalating back to root are not supported.
+var validCapabilities = map[string]struct{}{
+	"CAP_DAC_READ_SEARCH": {},
+	"CAP_SYS_PTRACE":      {},
+}
+
+// validateResources validates the limits on the agent's own resource usage.
+func validateResources(cfg *Config) error {
+	resources := cfg.Resources
+
+	if resources.MemoryLimitMB < 0 {
+		return fmt.Errorf("config: resources.memory_limit_mb must not be negative")
+	}
+
+	if resources.MaxProcs < 0 {
+		return fmt.Errorf("config: resources.max_procs must not be negative")
+	}
+
+	if resources.CPUBudget < 0 {
+		return fmt.Errorf("config: resources.cpu_budget must not be negative")
+	}
+
+	if resources.Backoff.After < 1 {
+		return fmt.Errorf("config: resources.backoff.after must be at least 1")
+	}
+
+	if resources.Backoff.MaxFactor < 1 {
+		return fmt.Errorf("config: resources.backoff.max_factor must be at least 1")
+	}
+
+	return nil
+}
+
+// validateSandbox validates privilege dropping and sandboxing settings.
+func validateSandbox(cfg *Config) error {
+	sandbox := cfg.Sandbox
+	enabled := sandbox.User != "" || sandbox.Group != "" || len(sandbox.Capabilities) > 0 ||
+		sandbox.NoNewPrivs || sandbox.Landlock.Enabled
+
+	if enabled && runtime.GOOS != "linux" {
+		return fmt.Errorf("config: sandbox is only available on Linux")
+	}
+
+	if sandbox.User == "" && (sandbox.Group != "" || len(sandbox.Capabilities) > 0) {
+		return fmt.Errorf("config: sandbox.group and sandbox.capabilities require sandbox.user")
+	}
+
+	for _, capability := range sandbox.Capabilities {
+		if _, ok := validCapabilities[capability]; !ok {
+			return fmt.Errorf("config: unsupported sandbox.capabilities entry: %s", capability)
+		}
+	}
+
+	for _, path := range slices.Concat(sandbox.Landlock.ReadPaths, sandbox.Landlock.WritePaths) {
+		if !filepath.IsAbs(path) {
+			return fmt.Errorf("config: sandbox.landlock paths must be absolute: %s", path)
+		}
+	}
+
+	return nil
+}
+
+// validateRedact validates the additional redaction patterns.
+func validateRedact(cfg *Config) error {
+	if _, err := redact.Compile(cfg.Redact.Patterns); err != nil {
+		return fmt.Errorf("config: redact.patterns: %w", err)
+	}
 	return nil
 }
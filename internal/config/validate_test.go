@@ -0,0 +1,106 @@
+package config
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestValidateSandboxCapabilities(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("sandbox is only available on Linux")
+	}
+
+	tests := []struct {
+		name         string
+		user         string
+		capabilities []string
+		wantErr      bool
+	}{
+		{name: "none", user: "dideban"},
+		{name: "read search", user: "dideban", capabilities: []string{"CAP_DAC_READ_SEARCH"}},
+		{name: "read search and ptrace", user: "dideban", capabilities: []string{"CAP_DAC_READ_SEARCH", "CAP_SYS_PTRACE"}},
+		{name: "without user", capabilities: []string{"CAP_SYS_PTRACE"}, wantErr: true},
+		{name: "net admin", user: "dideban", capabilities: []string{"CAP_NET_ADMIN"}, wantErr: true},
+		{name: "sys resource", user: "dideban", capabilities: []string{"CAP_SYS_RESOURCE"}, wantErr: true},
+		{name: "lower case", user: "dideban", capabilities: []string{"cap_sys_ptrace"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{}
+			cfg.Sandbox.User = tt.user
+			cfg.Sandbox.Capabilities = tt.capabilities
+
+			if err := validateSandbox(cfg); (err != nil) != tt.wantErr {
+				t.Errorf("validateSandbox() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateStateDir(t *testing.T) {
+	tests := []struct {
+		name     string
+		enable   func(cfg *Config)
+		validate configValidator
+		wantErr  bool
+	}{
+		{name: "agent", enable: func(cfg *Config) {}, validate: validateAgent},
+		{name: "queue drop", enable: func(cfg *Config) {}, validate: validateQueue},
+		{
+			name:     "queue spill",
+			enable:   func(cfg *Config) { cfg.Queue.Overflow = "spill" },
+			validate: validateQueue,
+			wantErr:  true,
+		},
+		{
+			name:     "enrollment",
+			enable:   func(cfg *Config) { cfg.Enroll.Enabled = true },
+			validate: validateCore,
+			wantErr:  true,
+		},
+		{
+			name:     "signing",
+			enable:   func(cfg *Config) { cfg.Core.Signing.Enabled = true },
+			validate: validateCore,
+			wantErr:  true,
+		},
+		{
+			name:     "remote config",
+			enable:   func(cfg *Config) { cfg.RemoteConfig.Enabled = true },
+			validate: validateRemoteConfig,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Mode: ModeProduction}
+			cfg.Agent.Name = "web-01"
+			cfg.Agent.Interval = time.Minute
+			cfg.Core.Endpoint = "https://core.example"
+			cfg.Core.Token = "token"
+			cfg.Core.TLS.MinVersion = "1.2"
+			cfg.Enroll.Endpoint = "https://core.example/enroll"
+			cfg.Enroll.BootstrapToken = "bootstrap"
+			cfg.Enroll.MinInterval = time.Minute
+			cfg.Queue.Size = 10
+			cfg.Queue.Overflow = "drop_oldest"
+			cfg.Queue.SpillMaxFiles = 10
+			tt.enable(cfg)
+			if cfg.Enroll.Enabled {
+				cfg.Core.Token = ""
+			}
+
+			if err := tt.validate(cfg); (err != nil) != tt.wantErr {
+				t.Fatalf("without state_dir: error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			cfg.Agent.StateDir = t.TempDir()
+			if err := tt.validate(cfg); err != nil {
+				t.Errorf("with state_dir: error = %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package diagnose
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"dideban-agent/internal/config"
+)
+
+// agentClient queries the status API of a running agent.
+type agentClient struct {
+	client  *http.Client
+	base    string
+	address string
+}
+
+// connectAgent finds a running agent through the status API configured
+// in cfg, preferring the unix socket. It returns an error if the status
+// API is disabled or does not answer.
+func connectAgent(ctx context.Context, cfg *config.Config, timeout time.Duration) (*agentClient, error) {
+	if !cfg.Status.Enabled {
+		return nil, errors.New("status API is disabled (status.enabled)")
+	}
+
+	c := &agentClient{client: &http.Client{Timeout: timeout}}
+
+	if socket := cfg.Status.Socket; socket != "" {
+		if _, err := os.Stat(socket); err == nil {
+			c.client.Transport = &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var dialer net.Dialer
+					return dialer.DialContext(ctx, "unix", socket)
+				},
+			}
+			c.base = "http://agent"
+			c.address = "unix:" + socket
+		}
+	}
+
+	if c.base == "" {
+		if cfg.Status.Listen == "" {
+			return nil, fmt.Errorf("status socket %s not found", cfg.Status.Socket)
+		}
+		c.base = "http://" + cfg.Status.Listen
+		c.address = cfg.Status.Listen
+	}
+
+	if _, err := c.get(ctx, "/healthz"); err != nil {
+		return nil, fmt.Errorf("no agent answering on %s: %w", c.address, err)
+	}
+
+	return c, nil
+}
+
+// get returns the body of a successful GET request.
+func (c *agentClient) get(ctx context.Context, path string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.base+path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: status %d", path, resp.StatusCode)
+	}
+
+	return body, nil
+}
+
+// getJSON decodes the JSON body of a successful GET request into v.
+func (c *agentClient) getJSON(ctx context.Context, path string, v any) error {
+	body, err := c.get(ctx, path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, v)
+}
@@ -0,0 +1,197 @@
+package diagnose
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"dideban-agent/internal/redact"
+	"dideban-agent/internal/sender"
+	"dideban-agent/internal/version"
+)
+
+// Check is the result of one step of the connectivity test.
+type Check struct {
+	Name     string `json:"name"`
+	OK       bool   `json:"ok"`
+	Skipped  bool   `json:"skipped,omitempty"`
+	Duration int64  `json:"duration_ms"`
+	Detail   string `json:"detail,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// CheckCore tests the connection to the Core endpoint step by step:
+// DNS resolution, TCP connection, TLS handshake (https only) and an
+// authenticated request. Later steps are skipped once one fails.
+//
+// If a proxy applies to the endpoint, DNS and TCP are checked against
+// the proxy and the TLS handshake is covered by the authenticated request
+// tunnelled through it.
+func CheckCore(ctx context.Context, endpoint string, transport *http.Transport, tokens sender.TokenSource, timeout time.Duration) []Check {
+	target, err := url.Parse(endpoint)
+	if err != nil || target.Host == "" {
+		return []Check{{Name: "endpoint", Error: fmt.Sprintf("invalid endpoint %q", endpoint)}}
+	}
+
+	host, port := target.Hostname(), target.Port()
+	if port == "" {
+		port = "80"
+		if target.Scheme == "https" {
+			port = "443"
+		}
+	}
+
+	proxied := false
+	if transport.Proxy != nil {
+		proxy, err := transport.Proxy(&http.Request{URL: target})
+		if err != nil {
+			return []Check{{Name: "proxy", Error: err.Error()}}
+		}
+		if proxy != nil {
+			proxied = true
+			host, port = proxy.Hostname(), proxy.Port()
+			if port == "" {
+				port = defaultProxyPort(proxy.Scheme)
+			}
+		}
+	}
+
+	var checks []Check
+	failed := false
+
+	step := func(name string, run func(ctx context.Context) (string, error)) {
+		if failed {
+			checks = append(checks, Check{Name: name, Skipped: true, Detail: "previous step failed"})
+			return
+		}
+
+		stepCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		start := time.Now()
+		detail, err := run(stepCtx)
+		check := Check{
+			Name:     name,
+			OK:       err == nil,
+			Duration: time.Since(start).Milliseconds(),
+			Detail:   detail,
+		}
+		if err != nil {
+			check.Error = redact.String(err.Error())
+			failed = true
+		}
+		checks = append(checks, check)
+	}
+
+	var conn net.Conn
+
+	step("dns", func(ctx context.Context) (string, error) {
+		addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+		if err != nil {
+			return "", err
+		}
+		detail := host + " resolved to " + strings.Join(addrs, ", ")
+		if proxied {
+			detail = "proxy " + detail
+		}
+		return detail, nil
+	})
+
+	step("tcp", func(ctx context.Context) (string, error) {
+		var dialer net.Dialer
+		c, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+		if err != nil {
+			return "", err
+		}
+		conn = c
+		return "connected to " + c.RemoteAddr().String(), nil
+	})
+
+	if target.Scheme == "https" && !proxied {
+		step("tls", func(ctx context.Context) (string, error) {
+			config := transport.TLSClientConfig.Clone()
+			if config.ServerName == "" {
+				config.ServerName = target.Hostname()
+			}
+
+			tlsConn := tls.Client(conn, config)
+			if err := tlsConn.HandshakeContext(ctx); err != nil {
+				return "", err
+			}
+
+			state := tlsConn.ConnectionState()
+			detail := fmt.Sprintf("%s, %s", tls.VersionName(state.Version), tls.CipherSuiteName(state.CipherSuite))
+			if len(state.PeerCertificates) > 0 {
+				leaf := state.PeerCertificates[0]
+				detail += fmt.Sprintf(", certificate %q valid until %s", leaf.Subject.CommonName, leaf.NotAfter.Format(time.RFC3339))
+			}
+			return detail, nil
+		})
+	}
+
+	if conn != nil {
+		conn.Close()
+	}
+
+	step("auth", func(ctx context.Context) (string, error) {
+		return checkAuth(ctx, endpoint, transport, tokens)
+	})
+
+	return checks
+}
+
+// checkAuth sends an authenticated GET to the endpoint. Core's answer to
+// a GET is irrelevant as long as the credential is not rejected (401/403).
+func checkAuth(ctx context.Context, endpoint string, transport *http.Transport, tokens sender.TokenSource) (string, error) {
+	if tokens == nil {
+		return "", errors.New("no credential available")
+	}
+
+	token, err := tokens.Token()
+	if err != nil {
+		return "", fmt.Errorf("failed to get token: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return "", err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	req.Header.Set("User-Agent", version.UserAgent())
+
+	client := &http.Client{Transport: transport}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return "", fmt.Errorf("credential rejected (status %d)", resp.StatusCode)
+	case resp.StatusCode >= 500:
+		return "", fmt.Errorf("server error (status %d)", resp.StatusCode)
+	default:
+		return fmt.Sprintf("credential accepted (status %d)", resp.StatusCode), nil
+	}
+}
+
+// defaultProxyPort returns the port of a proxy URL without one.
+func defaultProxyPort(scheme string) string {
+	switch scheme {
+	case "https":
+		return "443"
+	case "socks5", "socks5h":
+		return "1080"
+	default:
+		return "80"
+	}
+}
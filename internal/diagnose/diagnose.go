@@ -0,0 +1,297 @@
+package diagnose
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"runtime/pprof"
+	"time"
+
+	"dideban-agent/internal/collector"
+	"dideban-agent/internal/config"
+	"dideban-agent/internal/hostinfo"
+	"dideban-agent/internal/redact"
+	"dideban-agent/internal/sender"
+	"dideban-agent/internal/version"
+)
+
+// collectFacts gathers the host facts (replaced in tests).
+var collectFacts = hostinfo.Collect
+
+// Options contains settings of a diagnostics run.
+type Options struct {
+	// Configuration the agent runs with, or nil with ConfigError if it
+	// cannot be loaded
+	Config      *config.Config
+	ConfigError error
+
+	// Transport and credential for the connectivity test; a nil transport
+	// skips the test, with CoreError as the reason
+	Transport *http.Transport
+	Tokens    sender.TokenSource
+	CoreError error
+
+	// Number of recent snapshots included
+	Snapshots int
+
+	// Timeout of every request and connectivity step
+	Timeout time.Duration
+}
+
+// Summary describes a diagnostics bundle. It is included in the bundle
+// as summary.json.
+type Summary struct {
+	CreatedAt time.Time `json:"created_at"`
+
+	// Where runtime data comes from: the running agent's status API, or
+	// this process if no agent answered (AgentError tells why)
+	Source     string `json:"source"`
+	AgentError string `json:"agent_error,omitempty"`
+
+	Connectivity []Check  `json:"connectivity,omitempty"`
+	Errors       []string `json:"errors,omitempty"`
+}
+
+// errorf records a problem that left part of the bundle incomplete.
+// Credentials in the message are masked.
+func (s *Summary) errorf(format string, args ...any) {
+	s.Errors = append(s.Errors, redact.String(fmt.Sprintf(format, args...)))
+}
+
+// Run gathers diagnostics and writes them to w as a tar.gz archive:
+//
+//   - summary.json: sources, connectivity results and problems found
+//   - version.json: version and build information
+//   - host.json: host facts
+//   - config.json: effective configuration, with secrets redacted
+//   - status.json: status of the running agent (if any)
+//   - snapshots.json: recent snapshots
+//   - collectors.json: per-collector accounting, including last errors
+//   - sender.json: sender, queue and log shipping statistics
+//   - goroutines.txt: goroutine dump
+//   - memstats.json: Go runtime memory statistics
+//   - connectivity.json: DNS, TCP, TLS and authentication checks
+//
+// Runtime data is read from the running agent through its status API if
+// it answers; otherwise one snapshot is collected locally and the dumps
+// describe this process.
+func Run(ctx context.Context, opts Options, w io.Writer) (*Summary, error) {
+	b := &bundle{
+		prefix:  "dideban-diagnose-" + time.Now().UTC().Format("20060102T150405Z") + "/",
+		created: time.Now(),
+	}
+	summary := &Summary{CreatedAt: b.created.UTC()}
+
+	b.addJSON("version.json", newBuildInfo())
+
+	facts, err := collectFacts(ctx)
+	if err != nil {
+		summary.errorf("host facts: %v", err)
+	}
+	b.addJSON("host.json", facts)
+
+	if cfg := opts.Config; cfg == nil {
+		summary.Source = "none"
+		summary.errorf("configuration: %v", opts.ConfigError)
+		b.addJSON("config.json", map[string]string{"error": opts.ConfigError.Error()})
+	} else {
+		agent, err := connectAgent(ctx, cfg, opts.Timeout)
+		if err != nil {
+			summary.Source = "local"
+			summary.AgentError = err.Error()
+			fromLocal(ctx, b, cfg, opts, summary)
+		} else {
+			summary.Source = "agent at " + agent.address
+			fromAgent(ctx, b, agent, opts, summary)
+		}
+
+		if opts.Transport != nil {
+			summary.Connectivity = CheckCore(ctx, cfg.Core.Endpoint, opts.Transport, opts.Tokens, opts.Timeout)
+			b.addJSON("connectivity.json", summary.Connectivity)
+		} else {
+			summary.errorf("connectivity test skipped: %v", opts.CoreError)
+		}
+	}
+
+	b.addJSON("summary.json", summary)
+
+	return summary, b.write(w)
+}
+
+// fromAgent adds the runtime data of the running agent.
+func fromAgent(ctx context.Context, b *bundle, agent *agentClient, opts Options, summary *Summary) {
+	var status map[string]json.RawMessage
+	if err := agent.getJSON(ctx, "/status", &status); err != nil {
+		summary.errorf("agent status: %v", err)
+	} else {
+		b.addJSON("status.json", status)
+		b.addJSON("config.json", map[string]any{
+			"source": "running agent",
+			"hash":   status["config_hash"],
+			"config": status["config"],
+		})
+		b.addJSON("collectors.json", status["collectors"])
+		b.addJSON("sender.json", map[string]any{
+			"sender": status["sender"],
+			"queue":  status["queue"],
+			"logs":   status["logs"],
+		})
+	}
+
+	var history []json.RawMessage
+	if err := agent.getJSON(ctx, "/history", &history); err != nil {
+		summary.errorf("agent snapshots: %v", err)
+	} else {
+		b.addJSON("snapshots.json", history[max(len(history)-opts.Snapshots, 0):])
+	}
+
+	if dump, err := agent.get(ctx, "/debug/goroutines"); err != nil {
+		summary.errorf("agent goroutines: %v", err)
+	} else {
+		b.add("goroutines.txt", dump)
+	}
+
+	if stats, err := agent.get(ctx, "/debug/memstats"); err != nil {
+		summary.errorf("agent memory statistics: %v", err)
+	} else {
+		b.add("memstats.json", stats)
+	}
+}
+
+// fromLocal collects a snapshot in this process when no agent answers.
+func fromLocal(ctx context.Context, b *bundle, cfg *config.Config, opts Options, summary *Summary) {
+	b.addJSON("config.json", map[string]any{
+		"source": "local",
+		"file":   cfg.File,
+		"hash":   cfg.Hash(),
+		"config": cfg.Redacted(),
+	})
+
+	c, err := collector.New(cfg.EnabledCollectors()...)
+	if err != nil {
+		summary.errorf("collectors: %v", err)
+	} else {
+		collectCtx, cancel := context.WithTimeout(ctx, opts.Timeout)
+		metrics, err := c.CollectAll(collectCtx)
+		cancel()
+
+		if err != nil {
+			summary.errorf("collection: %v", err)
+		}
+		if metrics != nil {
+			b.addJSON("snapshots.json", []*collector.Metrics{metrics})
+		}
+		b.addJSON("collectors.json", c.Stats())
+	}
+
+	var dump bytes.Buffer
+	dump.WriteString("# No running agent answered; goroutines of the diagnose command\n\n")
+	if err := pprof.Lookup("goroutine").WriteTo(&dump, 2); err != nil {
+		summary.errorf("goroutines: %v", err)
+	}
+	b.add("goroutines.txt", dump.Bytes())
+
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	b.addJSON("memstats.json", &stats)
+}
+
+// buildInfo describes the agent binary.
+type buildInfo struct {
+	Version      string `json:"version"`
+	GoVersion    string `json:"go_version"`
+	OS           string `json:"os"`
+	Arch         string `json:"arch"`
+	Revision     string `json:"vcs_revision,omitempty"`
+	RevisionTime string `json:"vcs_time,omitempty"`
+	Modified     bool   `json:"vcs_modified,omitempty"`
+}
+
+// newBuildInfo reads the build information embedded in the binary.
+func newBuildInfo() *buildInfo {
+	info := &buildInfo{
+		Version:   version.Version,
+		GoVersion: runtime.Version(),
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+	}
+
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+
+	for _, setting := range build.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			info.Revision = setting.Value
+		case "vcs.time":
+			info.RevisionTime = setting.Value
+		case "vcs.modified":
+			info.Modified = setting.Value == "true"
+		}
+	}
+
+	return info
+}
+
+// bundle collects the files of the archive in memory.
+type bundle struct {
+	prefix  string
+	created time.Time
+	files   []bundleFile
+}
+
+// bundleFile is a file of the archive.
+type bundleFile struct {
+	name string
+	data []byte
+}
+
+// add adds a file.
+func (b *bundle) add(name string, data []byte) {
+	b.files = append(b.files, bundleFile{name: name, data: data})
+}
+
+// addJSON adds a file containing v as indented JSON.
+func (b *bundle) addJSON(name string, v any) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		data = []byte(fmt.Sprintf("{\"error\": %q}", err.Error()))
+	}
+	b.add(name, append(data, '\n'))
+}
+
+// write writes the files as a tar.gz archive.
+func (b *bundle) write(w io.Writer) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	for _, file := range b.files {
+		header := &tar.Header{
+			Name:    b.prefix + file.name,
+			Mode:    0o600,
+			Size:    int64(len(file.data)),
+			ModTime: b.created,
+		}
+
+		if err := tw.WriteHeader(header); err != nil {
+			return fmt.Errorf("failed to write %s: %w", file.name, err)
+		}
+		if _, err := tw.Write(file.data); err != nil {
+			return fmt.Errorf("failed to write %s: %w", file.name, err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to finish archive: %w", err)
+	}
+	return gz.Close()
+}
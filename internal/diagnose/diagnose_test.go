@@ -0,0 +1,215 @@
+package diagnose
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"dideban-agent/internal/config"
+	"dideban-agent/internal/hostinfo"
+)
+
+// fakeAgent serves the status API endpoints used by the diagnose command.
+// Paths in failing answer with 500.
+func fakeAgent(failing ...string) http.Handler {
+	mux := http.NewServeMux()
+	respond := func(path, body string) {
+		mux.HandleFunc("GET "+path, func(w http.ResponseWriter, r *http.Request) {
+			for _, p := range failing {
+				if p == path {
+					http.Error(w, "broken", http.StatusInternalServerError)
+					return
+				}
+			}
+			w.Write([]byte(body))
+		})
+	}
+
+	respond("/healthz", `{"status":"ok"}`)
+	respond("/status", `{"config_hash":"abc","config":{"agent":{"name":"web-01"}},"collectors":{},"queue":{"sent":3}}`)
+	respond("/history", `[{"timestamp":1},{"timestamp":2},{"timestamp":3}]`)
+	respond("/debug/goroutines", "goroutine 1 [running]:\n")
+	respond("/debug/memstats", `{"Alloc":1}`)
+	return mux
+}
+
+// statusConfig returns a configuration with the status API listening on
+// the address of server.
+func statusConfig(server *httptest.Server) *config.Config {
+	cfg := &config.Config{}
+	cfg.Status.Enabled = true
+	if server != nil {
+		cfg.Status.Listen = server.Listener.Addr().String()
+	}
+	return cfg
+}
+
+func TestConnectAgent(t *testing.T) {
+	server := httptest.NewServer(fakeAgent())
+	defer server.Close()
+
+	// An agent listening on a unix socket only
+	socket := filepath.Join(t.TempDir(), "status.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	socketServer := httptest.NewUnstartedServer(fakeAgent())
+	socketServer.Listener = listener
+	socketServer.Start()
+	defer socketServer.Close()
+
+	tests := []struct {
+		name        string
+		configure   func(cfg *config.Config)
+		wantAddress string
+		wantErr     string
+	}{
+		{name: "listen address", wantAddress: server.Listener.Addr().String()},
+		{
+			name:        "socket preferred",
+			configure:   func(cfg *config.Config) { cfg.Status.Socket = socket },
+			wantAddress: "unix:" + socket,
+		},
+		{
+			name:        "missing socket falls back to the listen address",
+			configure:   func(cfg *config.Config) { cfg.Status.Socket = socket + ".missing" },
+			wantAddress: server.Listener.Addr().String(),
+		},
+		{
+			name: "missing socket without listen address",
+			configure: func(cfg *config.Config) {
+				cfg.Status.Socket = socket + ".missing"
+				cfg.Status.Listen = ""
+			},
+			wantErr: "not found",
+		},
+		{name: "disabled", configure: func(cfg *config.Config) { cfg.Status.Enabled = false }, wantErr: "disabled"},
+		{name: "not answering", configure: func(cfg *config.Config) { cfg.Status.Listen = "127.0.0.1:1" }, wantErr: "no agent answering"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := statusConfig(server)
+			if tt.configure != nil {
+				tt.configure(cfg)
+			}
+
+			agent, err := connectAgent(context.Background(), cfg, time.Second)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("connectAgent() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("connectAgent() error = %v", err)
+			}
+			if agent.address != tt.wantAddress {
+				t.Errorf("address = %q, want %q", agent.address, tt.wantAddress)
+			}
+
+			var status struct {
+				ConfigHash string `json:"config_hash"`
+			}
+			if err := agent.getJSON(context.Background(), "/status", &status); err != nil || status.ConfigHash != "abc" {
+				t.Errorf("getJSON(/status) = %+v, %v", status, err)
+			}
+			if _, err := agent.get(context.Background(), "/missing"); err == nil {
+				t.Error("get() of a missing endpoint succeeded")
+			}
+		})
+	}
+}
+
+func TestRunFromAgent(t *testing.T) {
+	collectFacts = func(ctx context.Context) (*hostinfo.Facts, error) {
+		return &hostinfo.Facts{Hostname: "web-01"}, nil
+	}
+	t.Cleanup(func() { collectFacts = hostinfo.Collect })
+
+	server := httptest.NewServer(fakeAgent("/debug/memstats"))
+	defer server.Close()
+
+	var out bytes.Buffer
+	summary, err := Run(context.Background(), Options{
+		Config:    statusConfig(server),
+		CoreError: errors.New("no endpoint"),
+		Snapshots: 2,
+		Timeout:   time.Second,
+	}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if summary.Source != "agent at "+server.Listener.Addr().String() {
+		t.Errorf("Source = %q, want the running agent", summary.Source)
+	}
+
+	// Failed endpoints and skipped checks are reported, not fatal
+	errs := strings.Join(summary.Errors, "\n")
+	for _, want := range []string{"agent memory statistics", "connectivity test skipped: no endpoint"} {
+		if !strings.Contains(errs, want) {
+			t.Errorf("Errors = %q, want %q", summary.Errors, want)
+		}
+	}
+
+	files := readBundle(t, &out)
+	for _, name := range []string{"summary.json", "version.json", "host.json", "config.json", "status.json", "collectors.json", "sender.json", "goroutines.txt"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("bundle misses %s", name)
+		}
+	}
+	if _, ok := files["memstats.json"]; ok {
+		t.Error("bundle contains memstats.json although the agent failed to serve it")
+	}
+
+	var snapshots []struct{ Timestamp int64 }
+	if err := json.Unmarshal(files["snapshots.json"], &snapshots); err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 2 || snapshots[0].Timestamp != 2 {
+		t.Errorf("snapshots.json = %+v, want the 2 most recent", snapshots)
+	}
+}
+
+// readBundle returns the files of a tar.gz bundle by name, without the
+// directory prefix.
+func readBundle(t *testing.T, r io.Reader) map[string][]byte {
+	t.Helper()
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+
+	files := make(map[string][]byte)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return files
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[path.Base(header.Name)] = data
+	}
+}
@@ -0,0 +1,387 @@
+package enroll
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+
+	"dideban-agent/internal/hostinfo"
+	"dideban-agent/internal/logger"
+	"dideban-agent/internal/redact"
+	"dideban-agent/internal/state"
+	"dideban-agent/internal/version"
+	"dideban-agent/pkg/signature"
+)
+
+// log is the logger of the enroll component.
+var log = logger.New("enroll")
+
+// State directory file names.
+const (
+	credentialsFile = "credentials.json"
+	certFile        = "client.crt"
+	keyFile         = "client.key"
+)
+
+// collectFacts gathers the host facts sent with the enrollment request.
+var collectFacts = hostinfo.Collect
+
+// ErrRejected is returned when Core permanently rejects an enrollment
+// request (e.g. an invalid or expired bootstrap token).
+var ErrRejected = errors.New("enroll: enrollment rejected by core")
+
+// Config contains configuration for the enrollment handshake.
+type Config struct {
+	// Core registration endpoint
+	Endpoint string
+
+	// Shared bootstrap token exchanged for a per-agent credential
+	BootstrapToken string
+
+	// Agent name reported to Core
+	AgentName string
+
+	// Directory where the issued credential is stored
+	StateDir state.Dir
+
+	// Timeout of a single enrollment request
+	RequestTimeout time.Duration
+
+	// Backoff between failed enrollment attempts at startup
+	InitialRetryDelay time.Duration
+	MaxRetryDelay     time.Duration
+
+	// Minimum time between automatic re-enrollments
+	MinInterval time.Duration
+
+	// Payload signing key published to Core (nil if signing is disabled)
+	PublicKey ed25519.PublicKey
+}
+
+// Credentials is the per-agent credential issued by Core.
+// It is persisted in the state directory with 0600 permissions.
+type Credentials struct {
+	AgentID    string    `json:"agent_id"`
+	Token      string    `json:"token,omitempty"`
+	EnrolledAt time.Time `json:"enrolled_at"`
+
+	// Set if Core issued a client certificate (stored as separate PEM files)
+	HasCertificate bool `json:"has_certificate"`
+
+	// ID of the payload signing key published during enrollment
+	SigningKeyID string `json:"signing_key_id,omitempty"`
+}
+
+// request is the enrollment request body.
+type request struct {
+	Name  string          `json:"name"`
+	Facts *hostinfo.Facts `json:"facts"`
+
+	// Ed25519 payload signing key, base64, and its key ID
+	PublicKey   string `json:"public_key,omitempty"`
+	PublicKeyID string `json:"public_key_id,omitempty"`
+}
+
+// response is the enrollment response body.
+type response struct {
+	AgentID    string `json:"agent_id"`
+	Token      string `json:"token"`
+	ClientCert string `json:"client_cert"` // PEM
+	ClientKey  string `json:"client_key"`  // PEM
+}
+
+// Enroller exchanges a bootstrap token for a per-agent credential and
+// keeps that credential up to date.
+//
+// Enroller implements sender.TokenSource: its Reload method re-enrolls
+// the agent, so a 401 caused by a revoked credential transparently
+// triggers re-enrollment.
+type Enroller struct {
+	config Config
+	client *http.Client
+
+	// Serializes re-enrollments
+	reloadMu sync.Mutex
+
+	mu         sync.Mutex
+	creds      *Credentials
+	lastEnroll time.Time
+}
+
+// New creates an Enroller using the given transport for requests to Core.
+func New(config Config, transport http.RoundTripper) *Enroller {
+	return &Enroller{
+		config: config,
+		client: &http.Client{
+			Timeout:   config.RequestTimeout,
+			Transport: transport,
+		},
+	}
+}
+
+// Ensure returns the stored credential or, if there is none, enrolls the
+// agent. Transient failures are retried with backoff until ctx is
+// cancelled; ErrRejected is returned immediately.
+func (e *Enroller) Ensure(ctx context.Context) (*Credentials, error) {
+	creds, err := e.load()
+	if err == nil {
+		log.Info().
+			Str("agent_id", creds.AgentID).
+			Time("enrolled_at", creds.EnrolledAt).
+			Msg("🪪 Using stored enrollment credential")
+
+		if e.config.PublicKey != nil && creds.SigningKeyID != signature.KeyID(e.config.PublicKey) {
+			log.Warn().
+				Str("key_id", signature.KeyID(e.config.PublicKey)).
+				Msg("🔏 Signing key was not published during enrollment; Core cannot verify signatures until the agent re-enrolls")
+		}
+		return creds, nil
+	}
+
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	backoff := e.config.InitialRetryDelay
+
+	for {
+		creds, err := e.Enroll(ctx)
+		if err == nil {
+			return creds, nil
+		}
+
+		if errors.Is(err, ErrRejected) || ctx.Err() != nil {
+			return nil, err
+		}
+
+		delay := rand.N(backoff)
+		log.Warn().
+			Err(err).
+			Dur("retry_delay", delay).
+			Msg("🔄 Enrollment failed, retrying")
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+
+		backoff = min(backoff*2, e.config.MaxRetryDelay)
+	}
+}
+
+// Stored returns the stored credential without enrolling the agent.
+// The error wraps fs.ErrNotExist if the agent is not enrolled.
+func (e *Enroller) Stored() (*Credentials, error) {
+	return e.load()
+}
+
+// Enroll performs a single enrollment request and stores the issued credential.
+func (e *Enroller) Enroll(ctx context.Context) (*Credentials, error) {
+	facts, err := collectFacts(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("enroll: %w", err)
+	}
+
+	req := request{Name: e.config.AgentName, Facts: facts}
+	if e.config.PublicKey != nil {
+		req.PublicKey = base64.StdEncoding.EncodeToString(e.config.PublicKey)
+		req.PublicKeyID = signature.KeyID(e.config.PublicKey)
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("enroll: failed to marshal request: %w", err)
+	}
+
+	resp, err := e.post(ctx, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.AgentID == "" || (resp.Token == "" && resp.ClientCert == "") {
+		return nil, fmt.Errorf("%w: response contains no credential", ErrRejected)
+	}
+
+	if (resp.ClientCert == "") != (resp.ClientKey == "") {
+		return nil, fmt.Errorf("%w: client certificate and key must be issued together", ErrRejected)
+	}
+
+	creds := &Credentials{
+		AgentID:        resp.AgentID,
+		Token:          resp.Token,
+		EnrolledAt:     time.Now().UTC(),
+		HasCertificate: resp.ClientCert != "",
+		SigningKeyID:   req.PublicKeyID,
+	}
+
+	if err := e.store(creds, resp); err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	e.creds = creds
+	e.lastEnroll = time.Now()
+	e.mu.Unlock()
+
+	log.Info().
+		Str("agent_id", creds.AgentID).
+		Bool("certificate", creds.HasCertificate).
+		Msg("🪪 Agent enrolled")
+
+	return creds, nil
+}
+
+// CertFile returns the path of the issued client certificate.
+func (e *Enroller) CertFile() string {
+	return e.config.StateDir.Path(certFile)
+}
+
+// KeyFile returns the path of the issued client key.
+func (e *Enroller) KeyFile() string {
+	return e.config.StateDir.Path(keyFile)
+}
+
+// Token returns the current per-agent token (empty for certificate-only credentials).
+func (e *Enroller) Token() (string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.creds == nil {
+		return "", errors.New("enroll: agent is not enrolled")
+	}
+	return e.creds.Token, nil
+}
+
+// Reload re-enrolls the agent after its credential was rejected and
+// reports whether a new credential was obtained. Re-enrollment is rate
+// limited by MinInterval. Concurrent calls are serialized: callers that
+// waited for another re-enrollment to complete use its credential
+// instead of enrolling again.
+func (e *Enroller) Reload(ctx context.Context) (bool, error) {
+	e.mu.Lock()
+	rejected := e.creds
+	e.mu.Unlock()
+
+	e.reloadMu.Lock()
+	defer e.reloadMu.Unlock()
+
+	e.mu.Lock()
+	if e.creds != rejected {
+		// Re-enrolled while waiting
+		e.mu.Unlock()
+		return true, nil
+	}
+	wait := e.config.MinInterval - time.Since(e.lastEnroll)
+	if wait <= 0 {
+		// Record the attempt even if it fails, so a broken Core is not hammered
+		e.lastEnroll = time.Now()
+	}
+	e.mu.Unlock()
+
+	if wait > 0 {
+		return false, fmt.Errorf("enroll: re-enrollment rate limited, next attempt in %s", wait.Round(time.Second))
+	}
+
+	log.Warn().Msg("🪪 Credential rejected by core, re-enrolling")
+
+	ctx, cancel := context.WithTimeout(ctx, e.config.RequestTimeout)
+	defer cancel()
+
+	if _, err := e.Enroll(ctx); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// post sends the enrollment request and decodes the response.
+func (e *Enroller) post(ctx context.Context, body []byte) (*response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.config.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("enroll: failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+e.config.BootstrapToken)
+	req.Header.Set("User-Agent", version.UserAgent())
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("enroll: request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("enroll: failed to read response: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		err := fmt.Errorf("enroll: server returned status %d: %s", resp.StatusCode, redact.Body(data, 0))
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+			return nil, fmt.Errorf("%w: %w", ErrRejected, err)
+		}
+		return nil, err
+	}
+
+	var decoded response
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, fmt.Errorf("enroll: invalid response: %w", err)
+	}
+
+	return &decoded, nil
+}
+
+// load reads the stored credential from the state directory.
+func (e *Enroller) load() (*Credentials, error) {
+	data, err := e.config.StateDir.ReadFile(credentialsFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var creds Credentials
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return nil, fmt.Errorf("enroll: corrupt %s: %w", credentialsFile, err)
+	}
+
+	e.mu.Lock()
+	e.creds = &creds
+	e.mu.Unlock()
+
+	return &creds, nil
+}
+
+// store persists the credential (and certificate, if issued) with 0600 permissions.
+// Certificate files are written before the credential file, so a crash
+// never leaves a credential pointing at a missing certificate.
+func (e *Enroller) store(creds *Credentials, resp *response) error {
+	if creds.HasCertificate {
+		if err := e.config.StateDir.WriteFile(keyFile, []byte(resp.ClientKey)); err != nil {
+			return fmt.Errorf("enroll: %w", err)
+		}
+		if err := e.config.StateDir.WriteFile(certFile, []byte(resp.ClientCert)); err != nil {
+			return fmt.Errorf("enroll: %w", err)
+		}
+	}
+
+	data, err := json.MarshalIndent(creds, "", "  ")
+	if err != nil {
+		return fmt.Errorf("enroll: failed to marshal credentials: %w", err)
+	}
+
+	if err := e.config.StateDir.WriteFile(credentialsFile, data); err != nil {
+		return fmt.Errorf("enroll: %w", err)
+	}
+
+	return nil
+}
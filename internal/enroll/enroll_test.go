@@ -0,0 +1,243 @@
+package enroll
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"dideban-agent/internal/hostinfo"
+	"dideban-agent/internal/state"
+	"dideban-agent/pkg/signature"
+)
+
+// newTestEnroller returns an Enroller registering against handler, with
+// its state in a temporary directory.
+func newTestEnroller(t *testing.T, handler http.HandlerFunc) *Enroller {
+	t.Helper()
+
+	collectFacts = func(ctx context.Context) (*hostinfo.Facts, error) {
+		return &hostinfo.Facts{Hostname: "web-01", MachineID: "machine-1"}, ctx.Err()
+	}
+	t.Cleanup(func() { collectFacts = hostinfo.Collect })
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	return New(Config{
+		Endpoint:          server.URL,
+		BootstrapToken:    "bootstrap",
+		AgentName:         "web-01",
+		StateDir:          state.Dir(filepath.Join(t.TempDir(), "state")),
+		RequestTimeout:    5 * time.Second,
+		InitialRetryDelay: time.Millisecond,
+		MaxRetryDelay:     time.Millisecond,
+		MinInterval:       time.Hour,
+	}, nil)
+}
+
+// issue returns a handler issuing the given response and counting requests.
+func issue(resp response, requests *atomic.Int32) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+func TestEnroll(t *testing.T) {
+	public, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got request
+	var header http.Header
+	e := newTestEnroller(t, func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("invalid request body: %v", err)
+		}
+		json.NewEncoder(w).Encode(response{AgentID: "agent-1", Token: "per-agent"})
+	})
+	e.config.PublicKey = public
+
+	creds, err := e.Enroll(context.Background())
+	if err != nil {
+		t.Fatalf("Enroll() error = %v", err)
+	}
+
+	if header.Get("Authorization") != "Bearer bootstrap" {
+		t.Errorf("Authorization = %q", header.Get("Authorization"))
+	}
+	if got.Name != "web-01" || got.Facts == nil || got.Facts.MachineID == "" {
+		t.Errorf("request = %+v, want name and host facts", got)
+	}
+	if got.PublicKeyID != signature.KeyID(public) || got.PublicKey == "" {
+		t.Errorf("request public key = %q (%q), want %q", got.PublicKey, got.PublicKeyID, signature.KeyID(public))
+	}
+
+	if creds.AgentID != "agent-1" || creds.Token != "per-agent" || creds.SigningKeyID != got.PublicKeyID {
+		t.Errorf("Enroll() = %+v", creds)
+	}
+	if token, _ := e.Token(); token != "per-agent" {
+		t.Errorf("Token() = %q, want %q", token, "per-agent")
+	}
+}
+
+func TestEnrollStoresCredentials(t *testing.T) {
+	tests := []struct {
+		name  string
+		resp  response
+		files []string
+	}{
+		{
+			name:  "token",
+			resp:  response{AgentID: "agent-1", Token: "per-agent"},
+			files: []string{credentialsFile},
+		},
+		{
+			name:  "certificate",
+			resp:  response{AgentID: "agent-1", ClientCert: "CERT", ClientKey: "KEY"},
+			files: []string{credentialsFile, certFile, keyFile},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			e := newTestEnroller(t, issue(tt.resp, &requests))
+
+			if _, err := e.Enroll(context.Background()); err != nil {
+				t.Fatalf("Enroll() error = %v", err)
+			}
+
+			for _, name := range tt.files {
+				info, err := os.Stat(e.config.StateDir.Path(name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if perm := info.Mode().Perm(); perm != 0o600 {
+					t.Errorf("%s mode = %04o, want 0600", name, perm)
+				}
+			}
+
+			// A restarted agent uses the stored credential without enrolling
+			restarted := New(e.config, nil)
+			creds, err := restarted.Ensure(context.Background())
+			if err != nil {
+				t.Fatalf("Ensure() error = %v", err)
+			}
+			if creds.AgentID != "agent-1" || creds.HasCertificate != (tt.resp.ClientCert != "") {
+				t.Errorf("Ensure() = %+v", creds)
+			}
+			if requests.Load() != 1 {
+				t.Errorf("%d enrollment requests, want 1", requests.Load())
+			}
+		})
+	}
+}
+
+func TestEnsureStatus(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int
+		wantRejected bool
+	}{
+		{name: "bad request", status: http.StatusBadRequest, wantRejected: true},
+		{name: "unauthorized", status: http.StatusUnauthorized, wantRejected: true},
+		{name: "forbidden", status: http.StatusForbidden, wantRejected: true},
+		{name: "too many requests", status: http.StatusTooManyRequests},
+		{name: "server error", status: http.StatusBadGateway},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			e := newTestEnroller(t, func(w http.ResponseWriter, r *http.Request) {
+				// Transient failures are retried until the second attempt succeeds
+				if requests.Add(1) > 1 {
+					json.NewEncoder(w).Encode(response{AgentID: "agent-1", Token: "per-agent"})
+					return
+				}
+				http.Error(w, "nope", tt.status)
+			})
+
+			_, err := e.Ensure(context.Background())
+			if errors.Is(err, ErrRejected) != tt.wantRejected {
+				t.Fatalf("Ensure() error = %v, want rejected %v", err, tt.wantRejected)
+			}
+
+			want := int32(2)
+			if tt.wantRejected {
+				want = 1
+				if _, err := e.Stored(); !errors.Is(err, fs.ErrNotExist) {
+					t.Errorf("Stored() after rejection error = %v, want not exist", err)
+				}
+			}
+			if requests.Load() != want {
+				t.Errorf("%d enrollment requests, want %d", requests.Load(), want)
+			}
+		})
+	}
+}
+
+func TestReloadRateLimit(t *testing.T) {
+	var requests atomic.Int32
+	e := newTestEnroller(t, issue(response{AgentID: "agent-1", Token: "per-agent"}, &requests))
+	ctx := context.Background()
+
+	if _, err := e.Enroll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Reload(ctx); err == nil {
+		t.Fatal("Reload() right after enrolling was not rate limited")
+	}
+
+	e.mu.Lock()
+	e.lastEnroll = time.Now().Add(-e.config.MinInterval)
+	e.mu.Unlock()
+
+	// Concurrent 401s re-enroll once and all use the new credential
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Go(func() {
+			if changed, err := e.Reload(ctx); !changed || err != nil {
+				t.Errorf("Reload() = %v, %v, want true", changed, err)
+			}
+		})
+	}
+	wg.Wait()
+
+	if requests.Load() != 2 {
+		t.Errorf("%d enrollment requests, want 2", requests.Load())
+	}
+
+	// The next rejection within MinInterval is rate limited again
+	if changed, err := e.Reload(ctx); changed || err == nil {
+		t.Errorf("Reload() = %v, %v, want rate limited", changed, err)
+	}
+	if requests.Load() != 2 {
+		t.Errorf("%d enrollment requests after rate limited Reload(), want 2", requests.Load())
+	}
+}
+
+func TestReloadCancelled(t *testing.T) {
+	var requests atomic.Int32
+	e := newTestEnroller(t, issue(response{AgentID: "agent-1", Token: "per-agent"}, &requests))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := e.Reload(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Reload() with a cancelled context error = %v, want %v", err, context.Canceled)
+	}
+}
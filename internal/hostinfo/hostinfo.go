@@ -0,0 +1,59 @@
+package hostinfo
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/shirou/gopsutil/host"
+)
+
+// Facts describes the host the agent runs on.
+// It is used to identify the agent towards Core and in diagnostics.
+type Facts struct {
+	Hostname        string `json:"hostname"`
+	MachineID       string `json:"machine_id"`
+	OS              string `json:"os"`
+	Arch            string `json:"arch"`
+	Platform        string `json:"platform,omitempty"`
+	PlatformFamily  string `json:"platform_family,omitempty"`
+	PlatformVersion string `json:"platform_version,omitempty"`
+	KernelVersion   string `json:"kernel_version,omitempty"`
+	Virtualization  string `json:"virtualization,omitempty"`
+	CPUs            int    `json:"cpus"`
+}
+
+// Collect gathers host facts.
+//
+// The machine ID is read from the OS (e.g. /etc/machine-id on Linux,
+// MachineGuid on Windows). An error is returned only if no machine ID
+// can be determined, since it is required to identify the host.
+func Collect(ctx context.Context) (*Facts, error) {
+	facts := &Facts{
+		OS:   runtime.GOOS,
+		Arch: runtime.GOARCH,
+		CPUs: runtime.NumCPU(),
+	}
+
+	facts.Hostname, _ = os.Hostname()
+
+	info, err := host.InfoWithContext(ctx)
+	if err != nil && info == nil {
+		return facts, fmt.Errorf("failed to get host info: %w", err)
+	}
+
+	facts.MachineID = strings.TrimSpace(info.HostID)
+	facts.Platform = info.Platform
+	facts.PlatformFamily = info.PlatformFamily
+	facts.PlatformVersion = info.PlatformVersion
+	facts.KernelVersion = info.KernelVersion
+	facts.Virtualization = info.VirtualizationSystem
+
+	if facts.MachineID == "" {
+		return facts, fmt.Errorf("failed to determine machine ID")
+	}
+
+	return facts, nil
+}
@@ -0,0 +1,89 @@
+package logger
+
+import (
+	"github.com/rs/zerolog"
+)
+
+// Component is the logger of an agent component. Entries carry a
+// "component" field, and the level can be overridden per component
+// (log.components).
+//
+// Its methods mirror the zerolog/log package, so a package declares
+//
+//	var log = logger.New("sender")
+//
+// and logs with log.Info(), log.Warn(), ... as usual. The underlying
+// logger follows Init, including configuration reloads.
+type Component struct {
+	name  string
+	local bool
+}
+
+// New returns the logger of the named component.
+func New(name string) *Component {
+	return &Component{name: name}
+}
+
+// NewLocal returns the logger of a component whose entries are written
+// locally only and never shipped, so that the log shipper cannot feed
+// its own failures back into itself.
+func NewLocal(name string) *Component {
+	return &Component{name: name, local: true}
+}
+
+// Logger returns the current zerolog logger of the component.
+func (c *Component) Logger() *zerolog.Logger {
+	mu.RLock()
+	logger, ok := components[c.name]
+	mu.RUnlock()
+
+	if ok {
+		return logger
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if logger, ok := components[c.name]; ok {
+		return logger
+	}
+
+	parent := base
+	if c.local {
+		parent = local
+	}
+
+	l := parent.With().Str("component", c.name).Logger()
+	if level, ok := levels[c.name]; ok {
+		l = l.Level(level)
+	}
+
+	components[c.name] = &l
+	return &l
+}
+
+// Debug starts a new message with debug level.
+func (c *Component) Debug() *zerolog.Event {
+	return c.Logger().Debug()
+}
+
+// Info starts a new message with info level.
+func (c *Component) Info() *zerolog.Event {
+	return c.Logger().Info()
+}
+
+// Warn starts a new message with warn level.
+func (c *Component) Warn() *zerolog.Event {
+	return c.Logger().Warn()
+}
+
+// Error starts a new message with error level.
+func (c *Component) Error() *zerolog.Event {
+	return c.Logger().Error()
+}
+
+// Fatal starts a new message with fatal level. The program exits after
+// the message is written.
+func (c *Component) Fatal() *zerolog.Event {
+	return c.Logger().Fatal()
+}
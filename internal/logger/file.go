@@ -0,0 +1,160 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"dideban-agent/internal/config"
+)
+
+// backupTimeFormat is the timestamp in rotated file names
+// (e.g. agent.log.20261018T174400.000).
+const backupTimeFormat = "20060102T150405.000"
+
+// rotatingFile is a log file that is rotated when it grows larger than
+// MaxSizeMB or older than RotateInterval. Rotated files are renamed with
+// a timestamp suffix and deleted beyond MaxBackups or MaxAge.
+type rotatingFile struct {
+	settings config.LogFileConfig
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	opened time.Time
+}
+
+// newRotatingFile opens (or creates) the log file for appending.
+func newRotatingFile(settings config.LogFileConfig) (*rotatingFile, error) {
+	f := &rotatingFile{settings: settings}
+
+	if err := os.MkdirAll(filepath.Dir(settings.Path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// open opens the log file, continuing an existing one.
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.settings.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat log file: %w", err)
+	}
+
+	f.file = file
+	f.size = info.Size()
+	f.opened = time.Now()
+	return nil
+}
+
+// Write appends an entry, rotating the file first if needed.
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	if f.size > 0 && f.due(len(p)) {
+		if err := f.rotate(); err != nil {
+			fmt.Fprintf(os.Stderr, "logger: %v\n", err)
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// due reports whether the file must be rotated before writing n bytes.
+func (f *rotatingFile) due(n int) bool {
+	if f.size+int64(n) > int64(f.settings.MaxSizeMB)<<20 {
+		return true
+	}
+	return f.settings.RotateInterval > 0 && time.Since(f.opened) >= f.settings.RotateInterval
+}
+
+// rotate renames the current file and starts a new one.
+func (f *rotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return fmt.Errorf("failed to close log file: %w", err)
+	}
+
+	backup := f.settings.Path + "." + time.Now().Format(backupTimeFormat)
+	if err := os.Rename(f.settings.Path, backup); err != nil {
+		// Keep writing to the current file rather than losing entries
+		if openErr := f.open(); openErr != nil {
+			f.file = nil
+			return openErr
+		}
+		return fmt.Errorf("failed to rotate log file: %w", err)
+	}
+
+	if err := f.open(); err != nil {
+		f.file = nil
+		return err
+	}
+
+	f.prune()
+	return nil
+}
+
+// prune deletes rotated files beyond MaxBackups or older than MaxAge.
+func (f *rotatingFile) prune() {
+	backups, err := filepath.Glob(f.settings.Path + ".*")
+	if err != nil {
+		return
+	}
+
+	// Oldest first: the suffix sorts chronologically
+	backups = slices.DeleteFunc(backups, func(name string) bool {
+		_, err := time.Parse(backupTimeFormat, strings.TrimPrefix(name, f.settings.Path+"."))
+		return err != nil
+	})
+	slices.Sort(backups)
+
+	now := time.Now()
+	for i, name := range backups {
+		expired := f.settings.MaxBackups > 0 && i < len(backups)-f.settings.MaxBackups
+		if !expired && f.settings.MaxAge > 0 {
+			if info, err := os.Stat(name); err == nil && now.Sub(info.ModTime()) > f.settings.MaxAge {
+				expired = true
+			}
+		}
+
+		if expired {
+			if err := os.Remove(name); err != nil {
+				fmt.Fprintf(os.Stderr, "logger: failed to remove old log file: %v\n", err)
+			}
+		}
+	}
+}
+
+// Close closes the file. Later writes fail.
+func (f *rotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
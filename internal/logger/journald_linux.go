@@ -0,0 +1,165 @@
+//go:build linux
+
+package logger
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog"
+)
+
+// journaldSocket is the native protocol socket of systemd-journald.
+const journaldSocket = "/run/systemd/journal/socket"
+
+// journaldIdentifier is the SYSLOG_IDENTIFIER of journal entries.
+const journaldIdentifier = "dideban-agent"
+
+// journaldWriter writes zerolog events to journald using its native
+// protocol: the level becomes the entry PRIORITY and every event field
+// becomes a journal field (e.g. "collector" -> COLLECTOR).
+type journaldWriter struct {
+	conn *net.UnixConn
+}
+
+var (
+	journalOnce sync.Once
+	journal     *journaldWriter
+	journalErr  error
+)
+
+// newJournaldWriter returns the journald writer, connecting on first use.
+// The connection is shared by every logger created afterwards.
+func newJournaldWriter() (io.Writer, error) {
+	journalOnce.Do(func() {
+		conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: journaldSocket, Net: "unixgram"})
+		if err != nil {
+			journalErr = fmt.Errorf("failed to connect to journald: %w", err)
+			return
+		}
+		journal = &journaldWriter{conn: conn}
+	})
+
+	if journalErr != nil {
+		return nil, journalErr
+	}
+	return journal, nil
+}
+
+// Write sends one JSON-encoded zerolog event as a journal entry. If the
+// entry cannot be delivered (e.g. it is too large for a datagram), the
+// event is written to stderr instead.
+func (w *journaldWriter) Write(p []byte) (int, error) {
+	var event map[string]any
+	if err := json.Unmarshal(p, &event); err != nil {
+		event = map[string]any{zerolog.MessageFieldName: strings.TrimSpace(string(p))}
+	}
+
+	var entry bytes.Buffer
+
+	level, _ := event[zerolog.LevelFieldName].(string)
+	appendJournalField(&entry, "PRIORITY", journalPriority(level))
+	appendJournalField(&entry, "SYSLOG_IDENTIFIER", journaldIdentifier)
+
+	message, _ := event[zerolog.MessageFieldName].(string)
+	appendJournalField(&entry, "MESSAGE", message)
+
+	keys := make([]string, 0, len(event))
+	for key := range event {
+		switch key {
+		case zerolog.LevelFieldName, zerolog.MessageFieldName, zerolog.TimestampFieldName:
+			// Journald records its own timestamp
+		default:
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		appendJournalField(&entry, journalFieldName(key), journalValue(event[key]))
+	}
+
+	if _, err := w.conn.Write(entry.Bytes()); err != nil {
+		return os.Stderr.Write(p)
+	}
+	return len(p), nil
+}
+
+// appendJournalField appends a field in the native protocol format.
+// Values spanning several lines use the length-prefixed binary form.
+func appendJournalField(buf *bytes.Buffer, name, value string) {
+	buf.WriteString(name)
+
+	if !strings.Contains(value, "\n") {
+		buf.WriteByte('=')
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+		return
+	}
+
+	buf.WriteByte('\n')
+	_ = binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
+
+// journalFieldName converts an event key into a valid journal field
+// name: uppercase letters, digits and underscores, not starting with an
+// underscore or digit (those are reserved), at most 64 characters.
+func journalFieldName(key string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, key)
+
+	name = strings.TrimLeft(name, "_0123456789")
+	if name == "" {
+		name = "FIELD"
+	}
+	return name[:min(len(name), 64)]
+}
+
+// journalValue formats an event field value.
+func journalValue(value any) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
+
+// journalPriority maps a zerolog level to a syslog priority.
+func journalPriority(level string) string {
+	switch level {
+	case zerolog.LevelPanicValue:
+		return "0" // emerg
+	case zerolog.LevelFatalValue:
+		return "2" // crit
+	case zerolog.LevelErrorValue:
+		return "3" // err
+	case zerolog.LevelWarnValue:
+		return "4" // warning
+	case zerolog.LevelDebugValue, zerolog.LevelTraceValue:
+		return "7" // debug
+	default:
+		return "6" // info
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package logger
+
+import (
+	"errors"
+	"io"
+)
+
+// newJournaldWriter reports that journald is not available.
+func newJournaldWriter() (io.Writer, error) {
+	return nil, errors.New("journald is only available on Linux")
+}
@@ -4,6 +4,8 @@ import (
 	"io"
 	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
 
 	"dideban-agent/internal/config"
 
@@ -11,39 +13,168 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
+var (
+	mu sync.RWMutex
+
+	// base is the logger components derive from
+	base = log.Logger
+
+	// local is base without the remote output, for components whose
+	// entries must never be shipped (the log shipper itself)
+	local = log.Logger
+
+	// levels holds per-component level overrides
+	levels map[string]zerolog.Level
+
+	// components caches the logger of every component; reset by Init
+	components = make(map[string]*zerolog.Logger)
+
+	// file is the rotating log file in use, if any
+	file *rotatingFile
+)
+
 // Init initializes the global structured logger for the application.
 //
 // This function configures:
-//   - Global log level
+//   - Global and per-component log levels
+//   - Output destinations (stderr or journald, plus an optional file)
 //   - Output format (JSON or pretty console output)
+//   - Sampling of repeated messages
 //   - Timestamp injection
+//   - Redaction of credentials in every entry, local or shipped
 //
-// IMPORTANT:
-//   - This function should be called exactly once during application startup.
-//   - It mutates the global zerolog logger used across the entire application.
+// It may be called again when the configuration is reloaded; component
+// loggers (see New) pick up the new settings immediately.
 func Init(cfg *config.Config) {
-	// Set global log level based on configuration
-	zerolog.SetGlobalLevel(parseLogLevel(cfg.Log.Level))
+	level := ParseLevel(cfg.Log.Level)
+
+	overrides := make(map[string]zerolog.Level, len(cfg.Log.Components))
+	lowest := level
+	for component, l := range cfg.Log.Components {
+		overrides[component] = ParseLevel(l)
+		lowest = min(lowest, overrides[component])
+	}
+
+	// The global level is the lowest one in use; loggers filter further
+	zerolog.SetGlobalLevel(lowest)
 
 	// Configure log output destination
 	var output io.Writer = os.Stderr
 
+	var warnings []error
+	switch {
+	// Native journald entries with priorities and structured fields
+	case cfg.Log.Output == config.LogOutputJournald:
+		journal, err := newJournaldWriter()
+		if err != nil {
+			warnings = append(warnings, err)
+		} else {
+			output = journal
+		}
+
 	// Enable human-readable console output in development mode
-	if cfg.Log.Pretty {
+	case cfg.Log.Pretty:
 		output = zerolog.ConsoleWriter{
 			Out:        os.Stderr,
 			TimeFormat: "2006-01-02 15:04:05",
 		}
 	}
 
-	// Override the global logger instance
-	log.Logger = zerolog.New(output).
+	// JSON copy of every entry to a rotating file
+	logFile, err := openLogFile(cfg)
+	if err != nil {
+		warnings = append(warnings, err)
+	}
+	if logFile != nil {
+		output = zerolog.MultiLevelWriter(output, logFile)
+	}
+
+	localLogger := zerolog.New(newRedactWriter(output)).
+		Level(level).
 		With().
 		Timestamp().
 		Logger()
+
+	if cfg.Log.Sampling.Burst > 0 {
+		localLogger = localLogger.Hook(newSampler(cfg.Log.Sampling.Burst, cfg.Log.Sampling.Period))
+	}
+
+	// Entries written locally are also handed to the log shipper, if any
+	logger := localLogger.Output(newRedactWriter(output, remote))
+
+	mu.Lock()
+	previous := file
+	base = logger
+	local = localLogger
+	levels = overrides
+	components = make(map[string]*zerolog.Logger)
+	file = logFile
+	mu.Unlock()
+
+	// Override the global logger instance
+	log.Logger = logger
+
+	if previous != nil && previous != logFile {
+		previous.Close()
+	}
+
+	for _, err := range warnings {
+		logger.Warn().Err(err).Msg("Log output unavailable")
+	}
+}
+
+// SetRemote sets the writer that receives a copy of every entry for
+// shipping, or removes it if w is nil. Entries of local components
+// (see NewLocal) are never passed to it.
+func SetRemote(w zerolog.LevelWriter) {
+	if w == nil {
+		remote.target.Store(nil)
+		return
+	}
+	remote.target.Store(&w)
+}
+
+// remoteWriter forwards entries to the current remote writer.
+type remoteWriter struct {
+	target atomic.Pointer[zerolog.LevelWriter]
+}
+
+// remote is the remote output of every non-local logger.
+var remote = &remoteWriter{}
+
+// Write implements io.Writer; entries without a level are not forwarded.
+func (r *remoteWriter) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+// WriteLevel implements zerolog.LevelWriter.
+func (r *remoteWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	if w := r.target.Load(); w != nil {
+		return (*w).WriteLevel(level, p)
+	}
+	return len(p), nil
+}
+
+// openLogFile returns the rotating log file for the configuration,
+// reusing the current one if its settings did not change.
+func openLogFile(cfg *config.Config) (*rotatingFile, error) {
+	settings := cfg.Log.File
+	if settings.Path == "" {
+		return nil, nil
+	}
+
+	mu.RLock()
+	current := file
+	mu.RUnlock()
+
+	if current != nil && current.settings == settings {
+		return current, nil
+	}
+
+	return newRotatingFile(settings)
 }
 
-// parseLogLevel converts a string log level into zerolog.Level.
+// ParseLevel converts a string log level into zerolog.Level.
 //
 // Supported levels:
 //   - debug
@@ -54,7 +185,7 @@ func Init(cfg *config.Config) {
 //   - panic
 //
 // Any unknown value defaults to info level.
-func parseLogLevel(level string) zerolog.Level {
+func ParseLevel(level string) zerolog.Level {
 	switch strings.ToLower(level) {
 	case "debug":
 		return zerolog.DebugLevel
@@ -0,0 +1,37 @@
+package logger
+
+import (
+	"io"
+
+	"dideban-agent/internal/redact"
+
+	"github.com/rs/zerolog"
+)
+
+// redactWriter masks credentials (see redact.String) in every entry
+// before it reaches the outputs, including the log shipper, so errors
+// embedding request URLs or headers do not leak them.
+type redactWriter struct {
+	out zerolog.LevelWriter
+}
+
+// newRedactWriter wraps the outputs in a redactWriter.
+func newRedactWriter(outputs ...io.Writer) *redactWriter {
+	return &redactWriter{out: zerolog.MultiLevelWriter(outputs...)}
+}
+
+// Write implements io.Writer.
+func (w *redactWriter) Write(p []byte) (int, error) {
+	if _, err := w.out.Write([]byte(redact.String(string(p)))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// WriteLevel implements zerolog.LevelWriter.
+func (w *redactWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	if _, err := w.out.WriteLevel(level, []byte(redact.String(string(p)))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
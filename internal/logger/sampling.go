@@ -0,0 +1,89 @@
+package logger
+
+import (
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// sampler is a zerolog hook that limits repeated messages: each distinct
+// message (per level) is written at most burst times per period. The
+// first message written after some were dropped reports how many were
+// suppressed. Fatal and panic messages are never dropped.
+type sampler struct {
+	burst  int
+	period time.Duration
+
+	mu       sync.Mutex
+	messages map[samplerKey]*samplerState
+}
+
+// samplerKey identifies a repeated message.
+type samplerKey struct {
+	level   zerolog.Level
+	message string
+}
+
+// samplerState counts a message within the current period.
+type samplerState struct {
+	start      time.Time
+	count      int
+	suppressed int
+}
+
+// newSampler creates a sampling hook.
+func newSampler(burst int, period time.Duration) *sampler {
+	return &sampler{
+		burst:    burst,
+		period:   period,
+		messages: make(map[samplerKey]*samplerState),
+	}
+}
+
+// Run implements zerolog.Hook.
+func (s *sampler) Run(e *zerolog.Event, level zerolog.Level, message string) {
+	if level >= zerolog.FatalLevel || !e.Enabled() {
+		return
+	}
+
+	now := time.Now()
+	key := samplerKey{level: level, message: message}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, ok := s.messages[key]
+	if !ok || now.Sub(state.start) >= s.period {
+		if !ok {
+			state = &samplerState{}
+			s.messages[key] = state
+		}
+		state.start = now
+		state.count = 0
+	}
+
+	state.count++
+	if state.count > s.burst {
+		state.suppressed++
+		e.Discard()
+		return
+	}
+
+	if state.suppressed > 0 {
+		e.Int("suppressed", state.suppressed)
+		state.suppressed = 0
+	}
+
+	s.expire(now)
+}
+
+// expire forgets messages not seen for a few periods, so one-off
+// messages do not accumulate. Must be called with s.mu held.
+func (s *sampler) expire(now time.Time) {
+	for key, state := range s.messages {
+		if state.suppressed == 0 && now.Sub(state.start) >= 3*s.period {
+			delete(s.messages, key)
+		}
+	}
+}
@@ -0,0 +1,412 @@
+package logship
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+
+	"dideban-agent/internal/logger"
+	"dideban-agent/internal/payload"
+	"dideban-agent/internal/ring"
+	"dideban-agent/internal/sender"
+	"dideban-agent/internal/version"
+
+	"github.com/rs/zerolog"
+)
+
+// log is the logger of the log shipper. Its entries are never shipped,
+// so shipping failures cannot feed back into the buffer.
+var log = logger.NewLocal("logship")
+
+// maxEntrySize is the largest entry that is shipped; larger entries are
+// dropped rather than truncated into invalid JSON.
+const maxEntrySize = 16 << 10
+
+// Config contains configuration for log shipping.
+type Config struct {
+	// Core log endpoint
+	Endpoint string
+
+	// Agent name reported with every batch
+	AgentName string
+
+	// Minimum level of shipped entries
+	Level zerolog.Level
+
+	// Entries kept while Core is unreachable; the oldest are dropped
+	BufferSize int
+
+	// Entries per request and time between requests
+	BatchSize     int
+	FlushInterval time.Duration
+
+	// Retry policy of a batch, independent of the metrics sender
+	MaxRetries        int
+	InitialRetryDelay time.Duration
+	MaxRetryDelay     time.Duration
+
+	// Timeout of a single request
+	RequestTimeout time.Duration
+
+	// Optional encoder applied to every serialized batch (e.g. encryption)
+	Encoder sender.Encoder
+}
+
+// Shipper forwards log entries to Core in batches.
+//
+// It is registered as the remote output of the logger (see
+// logger.SetRemote): entries at or above Config.Level are copied into a
+// bounded ring buffer and posted by a background worker, so logging never
+// waits for the network. Responses are classified like those of the
+// metrics sender (see sender.CheckResponse): a batch is retried with
+// exponential backoff and full jitter, or after the delay requested by
+// Retry-After, and dropped and counted once the retries are exhausted or
+// Core rejects it. After a 401 the token is reloaded once.
+type Shipper struct {
+	mu        sync.Mutex
+	config    Config
+	client    *http.Client
+	tokens    sender.TokenSource
+	buffer    *ring.Buffer[json.RawMessage]
+	shipped   uint64
+	dropped   uint64
+	failures  uint64
+	lastError string
+
+	// Wakes the worker when a full batch is buffered
+	wake chan struct{}
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// New creates a shipper. The transport and token source should match the
+// HTTP sender so that TLS, proxy and authentication settings are identical.
+func New(config Config, transport http.RoundTripper, tokens sender.TokenSource) *Shipper {
+	return &Shipper{
+		config: config,
+		client: &http.Client{
+			Timeout:   config.RequestTimeout,
+			Transport: transport,
+		},
+		tokens: tokens,
+		buffer: ring.New[json.RawMessage](config.BufferSize),
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// Update switches the shipper to new settings, keeping buffered entries
+// (the newest ones if the buffer shrinks).
+func (s *Shipper) Update(config Config, transport http.RoundTripper, tokens sender.TokenSource) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if config.BufferSize != s.buffer.Cap() {
+		buffer := ring.New[json.RawMessage](config.BufferSize)
+		for _, entry := range s.buffer.Drain() {
+			if buffer.Push(entry) {
+				s.dropped++
+			}
+		}
+		s.buffer = buffer
+	}
+
+	s.config = config
+	s.client = &http.Client{
+		Timeout:   config.RequestTimeout,
+		Transport: transport,
+	}
+	s.tokens = tokens
+}
+
+// Write implements io.Writer. Entries without a level are not shipped.
+func (s *Shipper) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+// WriteLevel implements zerolog.LevelWriter. It only buffers the entry
+// and never blocks on the network.
+func (s *Shipper) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if level < s.config.Level || level == zerolog.NoLevel {
+		return len(p), nil
+	}
+
+	entry := bytes.TrimRight(p, "\n")
+	if len(entry) > maxEntrySize || !json.Valid(entry) {
+		s.dropped++
+		return len(p), nil
+	}
+
+	// zerolog reuses p after the write returns
+	if s.buffer.Push(bytes.Clone(entry)) {
+		s.dropped++
+	}
+
+	if s.buffer.Len() >= s.config.BatchSize {
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+
+	return len(p), nil
+}
+
+// Start runs the worker in the background until Close is called.
+func (s *Shipper) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.done = make(chan struct{})
+
+	go func() {
+		defer close(s.done)
+		s.run(ctx)
+	}()
+}
+
+// Close stops the worker and makes a final attempt, without retries, to
+// ship the entries still buffered.
+func (s *Shipper) Close() {
+	if s.cancel == nil {
+		return
+	}
+
+	s.cancel()
+	<-s.done
+
+	s.mu.Lock()
+	timeout := s.config.RequestTimeout
+	s.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	for {
+		batch := s.take()
+		if len(batch) == 0 {
+			return
+		}
+		if err := s.post(ctx, batch); err != nil {
+			s.failed(len(batch), err)
+			return
+		}
+		s.delivered(len(batch))
+	}
+}
+
+// run flushes the buffer every FlushInterval and whenever a full batch
+// is waiting.
+func (s *Shipper) run(ctx context.Context) {
+	for {
+		s.mu.Lock()
+		interval := s.config.FlushInterval
+		s.mu.Unlock()
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		case <-s.wake:
+			timer.Stop()
+		}
+
+		s.flush(ctx)
+	}
+}
+
+// flush ships buffered entries batch by batch. It stops at the first
+// batch that cannot be delivered; later entries wait for the next flush.
+func (s *Shipper) flush(ctx context.Context) {
+	for ctx.Err() == nil {
+		batch := s.take()
+		if len(batch) == 0 {
+			return
+		}
+
+		if err := s.deliver(ctx, batch); err != nil {
+			if ctx.Err() == nil {
+				s.failed(len(batch), err)
+				log.Warn().Err(err).Int("entries", len(batch)).Msg("Failed to ship logs, batch dropped")
+			}
+			return
+		}
+
+		s.delivered(len(batch))
+	}
+}
+
+// take removes up to BatchSize entries from the buffer, oldest first.
+func (s *Shipper) take() []json.RawMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	batch := make([]json.RawMessage, 0, min(s.buffer.Len(), s.config.BatchSize))
+	for len(batch) < s.config.BatchSize {
+		entry, ok := s.buffer.Pop()
+		if !ok {
+			break
+		}
+		batch = append(batch, entry)
+	}
+	return batch
+}
+
+// deliver posts a batch, retrying failed attempts with exponential
+// backoff and full jitter. A Retry-After delay requested by Core takes
+// precedence (capped by MaxRetryDelay); rejected batches are not retried.
+func (s *Shipper) deliver(ctx context.Context, batch []json.RawMessage) error {
+	s.mu.Lock()
+	config := s.config
+	s.mu.Unlock()
+
+	backoff := config.InitialRetryDelay
+	tokenReloaded := false
+
+	var err error
+	var delay time.Duration
+	for attempt := 0; attempt <= config.MaxRetries; attempt++ {
+		if delay > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(delay):
+			}
+		}
+
+		if err = s.post(ctx, batch); err == nil {
+			return nil
+		}
+		log.Debug().Err(err).Int("attempt", attempt+1).Msg("Log shipping attempt failed")
+
+		var sendErr *sender.SendError
+		if errors.As(err, &sendErr) && !sendErr.Retryable() {
+			// The token may have been rotated since it was last read;
+			// re-read it once and retry immediately without using up an attempt
+			if errors.Is(err, sender.ErrUnauthorized) && !tokenReloaded && s.reloadToken(ctx) {
+				tokenReloaded = true
+				attempt--
+				delay = 0
+				continue
+			}
+			return err
+		}
+
+		if sendErr != nil && sendErr.RetryAfter > 0 {
+			delay = min(sendErr.RetryAfter, config.MaxRetryDelay)
+		} else {
+			delay = rand.N(backoff) + 1
+		}
+		backoff = min(backoff*2, config.MaxRetryDelay)
+	}
+
+	if config.MaxRetries == 0 {
+		return err
+	}
+	return fmt.Errorf("failed after %d attempts: %w", config.MaxRetries+1, err)
+}
+
+// post sends a batch in a single request ({"agent": ..., "logs": [...]}).
+func (s *Shipper) post(ctx context.Context, batch []json.RawMessage) error {
+	s.mu.Lock()
+	config, client, tokens := s.config, s.client, s.tokens
+	s.mu.Unlock()
+
+	body, err := json.Marshal(struct {
+		Agent string            `json:"agent"`
+		Logs  []json.RawMessage `json:"logs"`
+	}{config.AgentName, batch})
+	if err != nil {
+		return fmt.Errorf("failed to marshal log entries: %w", err)
+	}
+
+	header, body, err := sender.EncodeJSON(config.Encoder, body)
+	if err != nil {
+		return fmt.Errorf("failed to encode log entries: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, config.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header = header
+
+	token, err := tokens.Token()
+	if err != nil {
+		return fmt.Errorf("failed to get token: %w", err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	req.Header.Set("User-Agent", version.UserAgent())
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	return sender.CheckResponse(resp)
+}
+
+// reloadToken re-reads the token after a 401 and reports whether it changed.
+func (s *Shipper) reloadToken(ctx context.Context) bool {
+	s.mu.Lock()
+	tokens, client := s.tokens, s.client
+	s.mu.Unlock()
+
+	changed, err := tokens.Reload(ctx)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to reload token after 401")
+		return false
+	}
+
+	if changed {
+		// Pooled connections may carry a stale client certificate
+		client.CloseIdleConnections()
+	}
+	return changed
+}
+
+// delivered accounts for a shipped batch.
+func (s *Shipper) delivered(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.shipped += uint64(n)
+	s.lastError = ""
+}
+
+// failed accounts for a dropped batch.
+func (s *Shipper) failed(n int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.dropped += uint64(n)
+	s.failures++
+	s.lastError = err.Error()
+}
+
+// Stats reports the state of the shipper.
+func (s *Shipper) Stats() *payload.LogShipStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return &payload.LogShipStats{
+		Buffered:  s.buffer.Len(),
+		Shipped:   s.shipped,
+		Dropped:   s.dropped,
+		Failures:  s.failures,
+		LastError: s.lastError,
+	}
+}
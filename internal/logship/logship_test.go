@@ -0,0 +1,230 @@
+package logship
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"dideban-agent/internal/config"
+	"dideban-agent/internal/logger"
+	"dideban-agent/internal/sender"
+
+	"github.com/rs/zerolog"
+)
+
+// rotatingTokens switches to the token rotateTo, if set, when it is
+// reloaded and counts the reloads.
+type rotatingTokens struct {
+	mu       sync.Mutex
+	token    string
+	reloads  int
+	rotateTo string
+}
+
+func (r *rotatingTokens) Token() (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.token, nil
+}
+
+func (r *rotatingTokens) Reload(ctx context.Context) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.reloads++
+	if r.rotateTo == "" || r.rotateTo == r.token {
+		return false, nil
+	}
+	r.token = r.rotateTo
+	return true, nil
+}
+
+func testConfig(endpoint string) Config {
+	return Config{
+		Endpoint:          endpoint,
+		AgentName:         "web-01",
+		Level:             zerolog.WarnLevel,
+		BufferSize:        3,
+		BatchSize:         10,
+		FlushInterval:     time.Hour,
+		MaxRetries:        2,
+		InitialRetryDelay: time.Millisecond,
+		MaxRetryDelay:     50 * time.Millisecond,
+		RequestTimeout:    5 * time.Second,
+	}
+}
+
+// entry returns a JSON log entry with the given message.
+func entry(message string) []byte {
+	return []byte(`{"level":"warn","message":"` + message + `"}` + "\n")
+}
+
+func TestWriteLevel(t *testing.T) {
+	tests := []struct {
+		name         string
+		level        zerolog.Level
+		entry        []byte
+		wantBuffered int
+		wantDropped  uint64
+	}{
+		{name: "below the level", level: zerolog.InfoLevel, entry: entry("a")},
+		{name: "at the level", level: zerolog.WarnLevel, entry: entry("a"), wantBuffered: 1},
+		{name: "above the level", level: zerolog.ErrorLevel, entry: entry("a"), wantBuffered: 1},
+		{name: "without level", level: zerolog.NoLevel, entry: entry("a")},
+		{name: "invalid JSON", level: zerolog.ErrorLevel, entry: []byte(`{"message":`), wantDropped: 1},
+		{name: "too large", level: zerolog.ErrorLevel, entry: entry(strings.Repeat("x", maxEntrySize)), wantDropped: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(testConfig(""), nil, sender.StaticToken(""))
+
+			if n, err := s.WriteLevel(tt.level, tt.entry); n != len(tt.entry) || err != nil {
+				t.Fatalf("WriteLevel() = %d, %v", n, err)
+			}
+
+			stats := s.Stats()
+			if stats.Buffered != tt.wantBuffered || stats.Dropped != tt.wantDropped {
+				t.Errorf("buffered %d, dropped %d, want %d and %d", stats.Buffered, stats.Dropped, tt.wantBuffered, tt.wantDropped)
+			}
+		})
+	}
+}
+
+func TestBufferOverflow(t *testing.T) {
+	s := New(testConfig(""), nil, sender.StaticToken(""))
+
+	for _, message := range []string{"1", "2", "3", "4", "5"} {
+		s.WriteLevel(zerolog.WarnLevel, entry(message))
+	}
+
+	if stats := s.Stats(); stats.Buffered != 3 || stats.Dropped != 2 {
+		t.Fatalf("buffered %d, dropped %d, want 3 and 2", stats.Buffered, stats.Dropped)
+	}
+
+	// The oldest entries are dropped
+	var messages []string
+	for _, raw := range s.take() {
+		var e struct{ Message string }
+		if err := json.Unmarshal(raw, &e); err != nil {
+			t.Fatal(err)
+		}
+		messages = append(messages, e.Message)
+	}
+	if got := strings.Join(messages, ","); got != "3,4,5" {
+		t.Errorf("buffered entries %s, want 3,4,5", got)
+	}
+}
+
+func TestNeverShipsOwnLogs(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Log.Level = "info"
+	logger.Init(cfg)
+
+	s := New(testConfig(""), nil, sender.StaticToken(""))
+	logger.SetRemote(s)
+	t.Cleanup(func() { logger.SetRemote(nil) })
+
+	logger.New("sender").Warn().Msg("Failed to send metrics")
+	log.Warn().Msg("Failed to ship logs, batch dropped")
+
+	if buffered := s.Stats().Buffered; buffered != 1 {
+		t.Errorf("buffered %d entries, want only the one of another component", buffered)
+	}
+}
+
+func TestDeliver(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		retryAfter   string
+		rotateTo     string
+		wantErr      bool
+		wantRequests int
+		wantReloads  int
+		wantDelay    time.Duration // minimum delay before the last request
+	}{
+		{name: "accepted", statuses: []int{http.StatusAccepted}, wantRequests: 1},
+		{name: "retried", statuses: []int{http.StatusBadGateway, http.StatusOK}, wantRequests: 2},
+		{name: "retries exhausted", statuses: []int{http.StatusBadGateway}, wantErr: true, wantRequests: 3},
+		{name: "rejected", statuses: []int{http.StatusBadRequest}, wantErr: true, wantRequests: 1},
+		{
+			name:         "token rotated after 401",
+			statuses:     []int{http.StatusUnauthorized, http.StatusOK},
+			rotateTo:     "new",
+			wantRequests: 2,
+			wantReloads:  1,
+		},
+		{
+			name:         "token unchanged after 401",
+			statuses:     []int{http.StatusUnauthorized},
+			wantErr:      true,
+			wantRequests: 1,
+			wantReloads:  1,
+		},
+		{
+			name:         "retry after",
+			statuses:     []int{http.StatusServiceUnavailable, http.StatusOK},
+			retryAfter:   "1",
+			wantRequests: 2,
+			wantDelay:    50 * time.Millisecond, // capped by MaxRetryDelay
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			var last time.Time
+			var delay time.Duration
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := int(requests.Add(1))
+				if !last.IsZero() {
+					delay = time.Since(last)
+				}
+				last = time.Now()
+
+				status := tt.statuses[min(n, len(tt.statuses))-1]
+				if status == http.StatusUnauthorized && r.Header.Get("Authorization") == "Bearer new" {
+					status = http.StatusOK
+				}
+				if tt.retryAfter != "" {
+					w.Header().Set("Retry-After", tt.retryAfter)
+				}
+				w.WriteHeader(status)
+			}))
+			defer server.Close()
+
+			tokens := &rotatingTokens{token: "old", rotateTo: tt.rotateTo}
+			s := New(testConfig(server.URL), http.DefaultTransport, tokens)
+
+			s.WriteLevel(zerolog.ErrorLevel, entry("a"))
+			err := s.deliver(context.Background(), s.take())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("deliver() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				var sendErr *sender.SendError
+				if !errors.As(err, &sendErr) {
+					t.Errorf("deliver() error = %v, want a *sender.SendError", err)
+				}
+			}
+
+			if int(requests.Load()) != tt.wantRequests {
+				t.Errorf("%d requests, want %d", requests.Load(), tt.wantRequests)
+			}
+			if tokens.reloads != tt.wantReloads {
+				t.Errorf("%d token reloads, want %d", tokens.reloads, tt.wantReloads)
+			}
+			if delay < tt.wantDelay {
+				t.Errorf("retried after %v, want at least %v", delay, tt.wantDelay)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+
+	"dideban-agent/internal/config"
+	"dideban-agent/internal/redact"
+)
+
+// inheritedEnv lists the agent's environment variables passed to
+// commands. Everything else (e.g. credentials referenced as ${env:...})
+// stays in the agent.
+var inheritedEnv = []string{"PATH", "LANG", "LC_ALL", "TZ", "SYSTEMROOT"}
+
+// command runs a program for every notification.
+//
+// The notification is written as JSON to the command's stdin, and the
+// main fields are also available as DIDEBAN_ALERT_* environment variables.
+// The command does not inherit the agent's environment apart from
+// inheritedEnv.
+type command struct {
+	args []string
+}
+
+// newCommand creates a command channel.
+func newCommand(cfg config.NotifyChannel) *command {
+	return &command{args: cfg.Command}
+}
+
+// Notify runs the command. A non-zero exit status is an error.
+func (c *command) Notify(ctx context.Context, n *Notification) error {
+	input, err := json.Marshal(n)
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification: %w", err)
+	}
+
+	cmd := exec.CommandContext(ctx, c.args[0], c.args[1:]...)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Env = append(commandEnv(),
+		"DIDEBAN_ALERT_RULE="+n.Rule,
+		"DIDEBAN_ALERT_STATE="+n.State,
+		"DIDEBAN_ALERT_SEVERITY="+n.Severity,
+		"DIDEBAN_ALERT_METRIC="+n.Metric,
+		"DIDEBAN_ALERT_VALUE="+strconv.FormatFloat(n.Value, 'f', -1, 64),
+		"DIDEBAN_ALERT_THRESHOLD="+strconv.FormatFloat(n.Threshold, 'f', -1, 64),
+		"DIDEBAN_ALERT_DEDUP_KEY="+n.DedupKey,
+		"DIDEBAN_ALERT_HOST="+n.Host,
+		"DIDEBAN_ALERT_AGENT="+n.Agent,
+	)
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		detail := redact.Body(output, maxErrorBody)
+		if detail == "" {
+			return fmt.Errorf("command %s failed: %w", c.args[0], err)
+		}
+		return fmt.Errorf("command %s failed: %w: %s", c.args[0], err, detail)
+	}
+
+	return nil
+}
+
+// commandEnv returns the inherited part of the agent's environment.
+func commandEnv() []string {
+	var env []string
+	for _, name := range inheritedEnv {
+		if value, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+value)
+		}
+	}
+	return env
+}
@@ -0,0 +1,69 @@
+//go:build unix
+
+package notify
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"dideban-agent/internal/config"
+)
+
+func TestCommandEnvironment(t *testing.T) {
+	t.Setenv("DIDEBAN_TEST_SECRET", "leaked")
+	t.Setenv("LANG", "C.UTF-8")
+
+	out := filepath.Join(t.TempDir(), "env")
+	c := newCommand(config.NotifyChannel{Command: []string{"/bin/sh", "-c", "env > " + out}})
+
+	n := &Notification{Agent: "web-1", Host: "host-1", DedupKey: "cpu-high"}
+	n.Rule = "cpu-high"
+	n.State = "firing"
+	n.Value = 97.5
+
+	if err := c.Notify(context.Background(), n); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := strings.Split(string(data), "\n")
+
+	tests := []struct {
+		variable string
+		want     bool
+	}{
+		{variable: "DIDEBAN_ALERT_RULE=cpu-high", want: true},
+		{variable: "DIDEBAN_ALERT_STATE=firing", want: true},
+		{variable: "DIDEBAN_ALERT_VALUE=97.5", want: true},
+		{variable: "DIDEBAN_ALERT_AGENT=web-1", want: true},
+		{variable: "LANG=C.UTF-8", want: true},
+		{variable: "DIDEBAN_TEST_SECRET=leaked", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.variable, func(t *testing.T) {
+			if got := slices.Contains(env, tt.variable); got != tt.want {
+				t.Errorf("environment contains %s = %v, want %v", tt.variable, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommandFailure(t *testing.T) {
+	c := newCommand(config.NotifyChannel{Command: []string{"/bin/sh", "-c", "echo password=hunter2; exit 3"}})
+
+	err := c.Notify(context.Background(), &Notification{})
+	if err == nil {
+		t.Fatal("Notify() succeeded, want error")
+	}
+	if strings.Contains(err.Error(), "hunter2") {
+		t.Errorf("error %q contains the command's credential", err)
+	}
+}
@@ -0,0 +1,295 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"text/template"
+	"time"
+
+	"dideban-agent/internal/config"
+	"dideban-agent/internal/logger"
+	"dideban-agent/internal/payload"
+)
+
+// log is the logger of the notify component.
+var log = logger.New("notify")
+
+// queueSize is the number of pending notifications per channel.
+const queueSize = 64
+
+// defaultText is the default message for Slack and email.
+const defaultText = `{{if eq .State "firing"}}🚨{{else}}✅{{end}} [{{.Severity}}] {{.Rule}} is {{.State}} on {{.Host}}: ` +
+	`{{.Metric}} = {{.Value}} (threshold {{.Threshold}})`
+
+// Notification is an alert event as delivered to a channel.
+// It is also the data passed to channel templates.
+type Notification struct {
+	payload.AlertEvent
+
+	Agent    string `json:"agent"`
+	Host     string `json:"host"`
+	DedupKey string `json:"dedup_key"`
+}
+
+// Channel delivers notifications to a single destination.
+type Channel interface {
+	Notify(ctx context.Context, n *Notification) error
+}
+
+// Dispatcher fans alert events out to the configured channels.
+//
+// Each channel has its own queue and worker, so a slow or unreachable
+// destination does not delay the others or the agent loop.
+type Dispatcher struct {
+	agent   string
+	host    string
+	workers []*worker
+
+	// Cancelled on Close to stop waiting between retries
+	stop context.CancelFunc
+	wg   sync.WaitGroup
+}
+
+// New creates a Dispatcher for the configured channels and starts
+// their workers. HTTP-based channels use transport.
+func New(channels []config.NotifyChannel, agent string, transport http.RoundTripper) (*Dispatcher, error) {
+	host, err := os.Hostname()
+	if err != nil {
+		host = agent
+	}
+
+	d := &Dispatcher{agent: agent, host: host}
+
+	for _, cfg := range channels {
+		w, err := newWorker(cfg, transport)
+		if err != nil {
+			return nil, fmt.Errorf("notify channel %s: %w", cfg.Name, err)
+		}
+		d.workers = append(d.workers, w)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d.stop = cancel
+
+	for _, w := range d.workers {
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			w.run(ctx)
+		}()
+	}
+
+	return d, nil
+}
+
+// Dispatch queues the events on every matching channel.
+// It does not block; notifications are dropped if a channel is
+// rate limited, deduplicated or its queue is full.
+func (d *Dispatcher) Dispatch(events []payload.AlertEvent) {
+	now := time.Now()
+
+	for _, event := range events {
+		for _, w := range d.workers {
+			w.enqueue(&Notification{
+				AlertEvent: event,
+				Agent:      d.agent,
+				Host:       d.host,
+			}, now)
+		}
+	}
+}
+
+// Close stops the workers. Pending notifications get a single delivery
+// attempt; Close returns once they are done.
+func (d *Dispatcher) Close() {
+	d.stop()
+	for _, w := range d.workers {
+		close(w.queue)
+	}
+	d.wg.Wait()
+}
+
+// worker delivers the notifications of a single channel.
+type worker struct {
+	config   config.NotifyChannel
+	channel  Channel
+	dedupKey *template.Template
+	queue    chan *Notification
+
+	// Only accessed from Dispatch (agent loop)
+	sent     []time.Time          // delivery times within the rate period
+	lastSent map[string]time.Time // last notification time per dedup key
+}
+
+// newWorker creates the channel and its worker.
+func newWorker(cfg config.NotifyChannel, transport http.RoundTripper) (*worker, error) {
+	dedupKey, err := parseTemplate("dedup_key", cfg.DedupKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var channel Channel
+	switch cfg.Type {
+	case config.ChannelWebhook:
+		channel, err = newWebhook(cfg, transport)
+	case config.ChannelSlack:
+		channel, err = newSlack(cfg, transport)
+	case config.ChannelSMTP:
+		channel, err = newMailer(cfg)
+	case config.ChannelExec:
+		channel = newCommand(cfg)
+	default:
+		err = fmt.Errorf("unsupported channel type: %s", cfg.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &worker{
+		config:   cfg,
+		channel:  channel,
+		dedupKey: dedupKey,
+		queue:    make(chan *Notification, queueSize),
+		lastSent: make(map[string]time.Time),
+	}, nil
+}
+
+// enqueue applies the severity filter, deduplication and rate limit,
+// then queues the notification.
+func (w *worker) enqueue(n *Notification, now time.Time) {
+	if len(w.config.Severities) > 0 && !slices.Contains(w.config.Severities, n.Severity) {
+		return
+	}
+
+	key, err := render(w.dedupKey, n)
+	if err != nil {
+		log.Warn().Err(err).Str("channel", w.config.Name).Msg("Failed to render deduplication key")
+		key = n.Rule + "/" + n.State
+	}
+	n.DedupKey = key
+
+	if w.config.DedupWindow > 0 {
+		for k, t := range w.lastSent {
+			if now.Sub(t) >= w.config.DedupWindow {
+				delete(w.lastSent, k)
+			}
+		}
+
+		if _, ok := w.lastSent[key]; ok {
+			log.Debug().Str("channel", w.config.Name).Str("dedup_key", key).Msg("Duplicate notification suppressed")
+			return
+		}
+	}
+
+	if w.config.RateLimit > 0 {
+		w.sent = slices.DeleteFunc(w.sent, func(t time.Time) bool {
+			return now.Sub(t) >= w.config.RatePeriod
+		})
+
+		if len(w.sent) >= w.config.RateLimit {
+			log.Warn().Str("channel", w.config.Name).Str("rule", n.Rule).Msg("Notification dropped, channel rate limit reached")
+			return
+		}
+	}
+
+	select {
+	case w.queue <- n:
+		w.sent = append(w.sent, now)
+		w.lastSent[key] = now
+	default:
+		log.Warn().Str("channel", w.config.Name).Str("rule", n.Rule).Msg("Notification dropped, channel queue full")
+	}
+}
+
+// run delivers queued notifications until the queue is closed.
+func (w *worker) run(ctx context.Context) {
+	for n := range w.queue {
+		if err := w.deliver(ctx, n); err != nil {
+			log.Error().
+				Err(err).
+				Str("channel", w.config.Name).
+				Str("rule", n.Rule).
+				Str("state", n.State).
+				Msg("Failed to deliver notification")
+			continue
+		}
+
+		log.Debug().
+			Str("channel", w.config.Name).
+			Str("rule", n.Rule).
+			Str("state", n.State).
+			Msg("🔔 Notification delivered")
+	}
+}
+
+// deliver sends a notification, retrying failed attempts.
+// Retries stop once ctx is cancelled.
+func (w *worker) deliver(ctx context.Context, n *Notification) error {
+	var lastErr error
+
+	for attempt := 0; attempt <= w.config.Retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return lastErr
+			case <-time.After(w.config.RetryDelay):
+			}
+		}
+
+		// Each attempt is bounded by the channel timeout, not by ctx,
+		// so pending notifications still get an attempt on Close
+		attemptCtx, cancel := context.WithTimeout(context.Background(), w.config.Timeout)
+		lastErr = w.channel.Notify(attemptCtx, n)
+		cancel()
+
+		if lastErr == nil {
+			return nil
+		}
+	}
+
+	if w.config.Retries == 0 {
+		return lastErr
+	}
+	return fmt.Errorf("failed after %d attempts: %w", w.config.Retries+1, lastErr)
+}
+
+// templateFuncs are available in every channel template.
+var templateFuncs = template.FuncMap{
+	// json encodes a value, e.g. {{json .Rule}} inside a JSON body
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+// parseTemplate parses a channel template.
+func parseTemplate(name, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s template: %w", name, err)
+	}
+	return tmpl, nil
+}
+
+// render executes a template with the notification.
+func render(tmpl *template.Template, n *Notification) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, n); err != nil {
+		return "", fmt.Errorf("failed to render %s template: %w", tmpl.Name(), err)
+	}
+	return buf.String(), nil
+}
+
+// templateOrDefault returns text, or fallback if text is empty.
+func templateOrDefault(text, fallback string) string {
+	if text == "" {
+		return fallback
+	}
+	return text
+}
@@ -0,0 +1,147 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"dideban-agent/internal/config"
+)
+
+// defaultSubject is the default email subject.
+const defaultSubject = `[{{.Severity}}] {{.Rule}} {{.State}} on {{.Host}}`
+
+// mailer sends notifications as plain text email through a mail relay.
+type mailer struct {
+	host     string
+	addr     string
+	username string
+	password string
+	startTLS bool
+	from     string
+	to       []string
+	subject  *template.Template
+	body     *template.Template
+}
+
+// newMailer creates an email channel.
+func newMailer(cfg config.NotifyChannel) (*mailer, error) {
+	subject, err := parseTemplate("subject", templateOrDefault(cfg.SMTP.Subject, defaultSubject))
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := parseTemplate("body", templateOrDefault(cfg.Template, defaultText))
+	if err != nil {
+		return nil, err
+	}
+
+	return &mailer{
+		host:     cfg.SMTP.Host,
+		addr:     net.JoinHostPort(cfg.SMTP.Host, strconv.Itoa(cfg.SMTP.Port)),
+		username: cfg.SMTP.Username,
+		password: cfg.SMTP.Password,
+		startTLS: cfg.SMTP.StartTLS,
+		from:     cfg.SMTP.From,
+		to:       cfg.SMTP.To,
+		subject:  subject,
+		body:     body,
+	}, nil
+}
+
+// Notify sends the notification as an email.
+func (s *mailer) Notify(ctx context.Context, n *Notification) error {
+	message, err := s.message(n)
+	if err != nil {
+		return err
+	}
+
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", s.addr, err)
+	}
+	defer conn.Close()
+
+	// net/smtp has no context support; bound the whole session instead
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		return fmt.Errorf("smtp handshake failed: %w", err)
+	}
+	defer client.Close()
+
+	if s.startTLS {
+		if err := client.StartTLS(&tls.Config{ServerName: s.host, MinVersion: tls.VersionTLS12}); err != nil {
+			return fmt.Errorf("smtp starttls failed: %w", err)
+		}
+	}
+
+	if s.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.username, s.password, s.host)); err != nil {
+			return fmt.Errorf("smtp authentication failed: %w", err)
+		}
+	}
+
+	if err := client.Mail(s.from); err != nil {
+		return fmt.Errorf("smtp MAIL FROM failed: %w", err)
+	}
+	for _, to := range s.to {
+		if err := client.Rcpt(to); err != nil {
+			return fmt.Errorf("smtp RCPT TO %s failed: %w", to, err)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("smtp DATA failed: %w", err)
+	}
+	if _, err := w.Write(message); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("smtp message rejected: %w", err)
+	}
+
+	return client.Quit()
+}
+
+// message builds the email (headers and body).
+func (s *mailer) message(n *Notification) ([]byte, error) {
+	subject, err := render(s.subject, n)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := render(s.body, n)
+	if err != nil {
+		return nil, err
+	}
+
+	// Header values must not contain line breaks
+	subject = strings.Join(strings.Fields(subject), " ")
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", s.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(s.to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(strings.ReplaceAll(strings.ReplaceAll(body, "\r\n", "\n"), "\n", "\r\n"))
+	msg.WriteString("\r\n")
+
+	return msg.Bytes(), nil
+}
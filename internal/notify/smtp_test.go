@@ -0,0 +1,188 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"dideban-agent/internal/config"
+)
+
+// fakeSMTP is a minimal SMTP server accepting a single session. It
+// rejects recipients listed in reject and records the commands and the
+// message it received.
+type fakeSMTP struct {
+	listener net.Listener
+	reject   []string
+	commands []string
+	message  string
+	done     chan struct{}
+}
+
+func newFakeSMTP(t *testing.T, reject ...string) *fakeSMTP {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	s := &fakeSMTP{listener: listener, reject: reject, done: make(chan struct{})}
+	go s.serve()
+	return s
+}
+
+func (s *fakeSMTP) serve() {
+	defer close(s.done)
+
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	r := bufio.NewReader(conn)
+	reply := func(line string) { fmt.Fprintf(conn, "%s\r\n", line) }
+
+	reply("220 localhost ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		s.commands = append(s.commands, line)
+
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			reply("250 localhost")
+		case "RCPT":
+			if rejected(arg, s.reject) {
+				reply("550 no such user")
+			} else {
+				reply("250 OK")
+			}
+		case "DATA":
+			reply("354 end with .")
+			var data strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(line)
+			}
+			s.message = data.String()
+			reply("250 queued")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func rejected(arg string, reject []string) bool {
+	for _, addr := range reject {
+		if strings.Contains(arg, addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestMailer(t *testing.T) {
+	tests := []struct {
+		name        string
+		to          []string
+		reject      []string
+		subject     string
+		wantErr     bool
+		wantSubject string
+	}{
+		{
+			name:        "delivered",
+			to:          []string{"ops@example.com", "oncall@example.com"},
+			wantSubject: "Subject: [critical] disk-full firing on host-1",
+		},
+		{
+			name:        "subject without line breaks",
+			to:          []string{"ops@example.com"},
+			subject:     "{{.Rule}}\r\nBcc: victim@example.com",
+			wantSubject: "Subject: disk-full Bcc: victim@example.com",
+		},
+		{
+			name:    "recipient rejected",
+			to:      []string{"ops@example.com", "nobody@example.com"},
+			reject:  []string{"nobody@example.com"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newFakeSMTP(t, tt.reject...)
+			host, port, _ := net.SplitHostPort(srv.listener.Addr().String())
+
+			cfg := config.NotifyChannel{Type: config.ChannelSMTP}
+			cfg.SMTP.Host = host
+			cfg.SMTP.Port, _ = strconv.Atoi(port)
+			cfg.SMTP.From = "agent@example.com"
+			cfg.SMTP.To = tt.to
+			cfg.SMTP.Subject = tt.subject
+
+			m, err := newMailer(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			err = m.Notify(ctx, testNotification())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Notify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			<-srv.done
+
+			for _, to := range tt.to {
+				if !containsPrefix(srv.commands, "RCPT TO:<"+to+">") {
+					t.Errorf("no RCPT TO for %s in %q", to, srv.commands)
+				}
+			}
+
+			headers, body, _ := strings.Cut(srv.message, "\r\n\r\n")
+			if !strings.Contains(headers, tt.wantSubject+"\r\n") {
+				t.Errorf("headers %q do not contain %q", headers, tt.wantSubject)
+			}
+			if !strings.Contains(body, "disk.usage_percent = 95 (threshold 90)") {
+				t.Errorf("body = %q", body)
+			}
+		})
+	}
+}
+
+// containsPrefix reports whether a line of lines starts with prefix.
+func containsPrefix(lines []string, prefix string) bool {
+	for _, line := range lines {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
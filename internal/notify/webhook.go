@@ -0,0 +1,134 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"text/template"
+
+	"dideban-agent/internal/config"
+	"dideban-agent/internal/redact"
+	"dideban-agent/internal/version"
+)
+
+// maxErrorBody limits how much of an error response is reported.
+const maxErrorBody = 512
+
+// webhook posts notifications as JSON to an HTTP endpoint.
+// Without a template, the body is the notification itself.
+type webhook struct {
+	client  *http.Client
+	url     string
+	headers map[string]string
+	body    *template.Template
+}
+
+// newWebhook creates a generic JSON webhook channel.
+func newWebhook(cfg config.NotifyChannel, transport http.RoundTripper) (*webhook, error) {
+	w := &webhook{
+		client:  &http.Client{Transport: transport},
+		url:     cfg.URL,
+		headers: cfg.Headers,
+	}
+
+	if cfg.Template != "" {
+		body, err := parseTemplate("body", cfg.Template)
+		if err != nil {
+			return nil, err
+		}
+		w.body = body
+	}
+
+	return w, nil
+}
+
+// Notify posts the notification.
+func (w *webhook) Notify(ctx context.Context, n *Notification) error {
+	var body []byte
+
+	if w.body != nil {
+		rendered, err := render(w.body, n)
+		if err != nil {
+			return err
+		}
+		body = []byte(rendered)
+	} else {
+		data, err := json.Marshal(n)
+		if err != nil {
+			return fmt.Errorf("failed to marshal notification: %w", err)
+		}
+		body = data
+	}
+
+	return post(ctx, w.client, w.url, w.headers, body)
+}
+
+// slack posts notifications to a Slack-compatible incoming webhook.
+type slack struct {
+	client *http.Client
+	url    string
+	text   *template.Template
+}
+
+// newSlack creates a Slack incoming webhook channel.
+// The template renders the message text.
+func newSlack(cfg config.NotifyChannel, transport http.RoundTripper) (*slack, error) {
+	text, err := parseTemplate("text", templateOrDefault(cfg.Template, defaultText))
+	if err != nil {
+		return nil, err
+	}
+
+	return &slack{
+		client: &http.Client{Transport: transport},
+		url:    cfg.URL,
+		text:   text,
+	}, nil
+}
+
+// Notify posts the notification as a Slack message.
+func (s *slack) Notify(ctx context.Context, n *Notification) error {
+	text, err := render(s.text, n)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	return post(ctx, s.client, s.url, nil, body)
+}
+
+// post sends a JSON body and checks for a 2xx response.
+func post(ctx context.Context, client *http.Client, url string, headers map[string]string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", version.UserAgent())
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		// The error carries the URL, which may embed a token
+		return fmt.Errorf("request failed: %w", redact.Error(err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return fmt.Errorf("server returned status %d: %s", resp.StatusCode, redact.Body(detail, maxErrorBody))
+	}
+
+	// Drain the body so the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxErrorBody))
+	return nil
+}
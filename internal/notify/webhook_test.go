@@ -0,0 +1,152 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"dideban-agent/internal/config"
+)
+
+// testNotification returns a firing notification for the channel tests.
+func testNotification() *Notification {
+	n := &Notification{Agent: "web-1", Host: "host-1", DedupKey: "disk-full/firing"}
+	n.Rule = "disk-full"
+	n.State = "firing"
+	n.Severity = "critical"
+	n.Metric = "disk.usage_percent"
+	n.Value = 95
+	n.Threshold = 90
+	return n
+}
+
+func TestHTTPChannels(t *testing.T) {
+	tests := []struct {
+		name       string
+		channel    config.NotifyChannel
+		wantHeader http.Header
+		check      func(t *testing.T, body []byte)
+	}{
+		{
+			name:       "webhook",
+			channel:    config.NotifyChannel{Type: config.ChannelWebhook, Headers: map[string]string{"Authorization": "Bearer abc"}},
+			wantHeader: http.Header{"Authorization": {"Bearer abc"}, "Content-Type": {"application/json"}},
+			check: func(t *testing.T, body []byte) {
+				var got Notification
+				if err := json.Unmarshal(body, &got); err != nil {
+					t.Fatalf("body is not a notification: %v", err)
+				}
+				if got.Rule != "disk-full" || got.Host != "host-1" || got.DedupKey != "disk-full/firing" || got.Value != 95 {
+					t.Errorf("body = %s", body)
+				}
+			},
+		},
+		{
+			name:    "webhook template",
+			channel: config.NotifyChannel{Type: config.ChannelWebhook, Template: `{"summary": {{json .Rule}}, "value": {{.Value}}}`},
+			check: func(t *testing.T, body []byte) {
+				if got, want := string(body), `{"summary": "disk-full", "value": 95}`; got != want {
+					t.Errorf("body = %s, want %s", got, want)
+				}
+			},
+		},
+		{
+			name:       "slack",
+			channel:    config.NotifyChannel{Type: config.ChannelSlack},
+			wantHeader: http.Header{"Content-Type": {"application/json"}},
+			check: func(t *testing.T, body []byte) {
+				var got map[string]string
+				if err := json.Unmarshal(body, &got); err != nil {
+					t.Fatalf("body is not a Slack message: %v", err)
+				}
+				want := "🚨 [critical] disk-full is firing on host-1: disk.usage_percent = 95 (threshold 90)"
+				if got["text"] != want {
+					t.Errorf("text = %q, want %q", got["text"], want)
+				}
+			},
+		},
+		{
+			name:    "slack template",
+			channel: config.NotifyChannel{Type: config.ChannelSlack, Template: `{{.Rule}}: "{{.State}}"`},
+			check: func(t *testing.T, body []byte) {
+				if got, want := string(body), `{"text":"disk-full: \"firing\""}`; got != want {
+					t.Errorf("body = %s, want %s", got, want)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				header http.Header
+				body   []byte
+			)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				header = r.Header.Clone()
+				body, _ = io.ReadAll(r.Body)
+			}))
+			defer srv.Close()
+
+			tt.channel.URL = srv.URL
+			w, err := newWorker(tt.channel, http.DefaultTransport)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := w.channel.Notify(context.Background(), testNotification()); err != nil {
+				t.Fatalf("Notify() error = %v", err)
+			}
+
+			for name := range tt.wantHeader {
+				if got := header.Get(name); got != tt.wantHeader.Get(name) {
+					t.Errorf("header %s = %q, want %q", name, got, tt.wantHeader.Get(name))
+				}
+			}
+			tt.check(t, body)
+		})
+	}
+}
+
+func TestHTTPChannelErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		io.WriteString(w, `{"error":"invalid","token":"xoxb-secret"}`)
+	}))
+	defer srv.Close()
+
+	// A closed server refuses connections
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	tests := []struct {
+		name     string
+		url      string
+		wantErr  string
+		notInErr string
+	}{
+		{name: "rejected", url: srv.URL, wantErr: "status 403", notInErr: "xoxb-secret"},
+		{name: "unreachable", url: closed.URL + "/services/T0/B0/secret-path", wantErr: "request failed", notInErr: "secret-path"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, err := newWebhook(config.NotifyChannel{URL: tt.url}, http.DefaultTransport)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = w.Notify(context.Background(), testNotification())
+			if err == nil {
+				t.Fatal("Notify() succeeded, want error")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) || strings.Contains(err.Error(), tt.notInErr) {
+				t.Errorf("Notify() error = %q, want %q without %q", err, tt.wantErr, tt.notInErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+// Package payload defines the sections of the snapshot payload that are
+// reported by agent components other than the collectors: the sender,
+// queue, schedule, log shipper, sandbox, remote configuration and alert
+// rules. The collector package embeds them in Metrics; keeping them here
+// lets those components fill them in without depending on each other.
+package payload
+
+// SandboxStats reports the privileges and restrictions the agent runs
+// under, which may be fewer than configured (e.g. on older kernels).
+type SandboxStats struct {
+	UID          int      `json:"uid"`
+	GID          int      `json:"gid"`
+	User         string   `json:"user,omitempty"`         // user switched to at startup
+	Capabilities []string `json:"capabilities"`           // effective capabilities
+	NoNewPrivs   bool     `json:"no_new_privs"`           // no_new_privs is set
+	LandlockABI  int      `json:"landlock_abi,omitempty"` // ABI of the enforced Landlock ruleset (0 = none)
+	Errors       []string `json:"errors,omitempty"`       // requested restrictions that did not take effect
+}
+
+// SenderStats reports the accounting of the HTTP sender.
+type SenderStats struct {
+	Attempts  uint64        `json:"attempts"`          // HTTP requests made
+	Failures  uint64        `json:"failures"`          // sends that failed after all retries
+	Retries   uint64        `json:"retries"`           // attempts after the first one
+	BytesSent uint64        `json:"bytes_sent"`        // request bodies of successful attempts
+	Breaker   *BreakerStats `json:"breaker,omitempty"` // nil if the circuit breaker is disabled
+}
+
+// BreakerStats reports the state of the circuit breaker. Counters are kept
+// across sender rebuilds, like the sender counters.
+type BreakerStats struct {
+	State               string `json:"state"`                        // closed, open or half-open
+	ConsecutiveFailures int    `json:"consecutive_failures"`         // failed sends since the last success
+	Transitions         uint64 `json:"transitions"`                  // state changes since start
+	ShortCircuited      uint64 `json:"short_circuited"`              // sends rejected while open
+	LastTransition      int64  `json:"last_transition_ms,omitempty"` // time of the last state change
+}
+
+// ScheduleStats reports the state of the collection schedule.
+type ScheduleStats struct {
+	Aligned     bool   `json:"aligned"`      // collections aligned to interval boundaries
+	OffsetMs    int64  `json:"offset_ms"`    // random splay added to scheduled times
+	MissedTicks uint64 `json:"missed_ticks"` // scheduled collections skipped since start
+	LagMs       int64  `json:"lag_ms"`       // delay of this collection past its scheduled time
+}
+
+// QueueStats reports the state of the outgoing snapshot queue.
+type QueueStats struct {
+	Depth    int    `json:"depth"`    // snapshots waiting in memory
+	Capacity int    `json:"capacity"` // in-memory queue size
+	Spilled  int    `json:"spilled"`  // snapshots waiting on disk
+	Dropped  uint64 `json:"dropped"`  // snapshots dropped since start
+	Sent     uint64 `json:"sent"`     // snapshots sent since start
+	Overflow string `json:"overflow"` // overflow policy
+
+	LastSent  int64  `json:"last_sent_ms,omitempty"` // time of the last successful send
+	LastError string `json:"last_error,omitempty"`   // error of the last failed send (cleared on success)
+	Paused    bool   `json:"paused,omitempty"`       // delivery paused, credential rejected (401)
+}
+
+// LogShipStats reports the state of log shipping to Core.
+type LogShipStats struct {
+	Buffered  int    `json:"buffered"`             // entries waiting to be shipped
+	Shipped   uint64 `json:"shipped"`              // entries shipped since start
+	Dropped   uint64 `json:"dropped"`              // entries dropped (buffer full or batch failed)
+	Failures  uint64 `json:"failures"`             // batches dropped after all retries
+	LastError string `json:"last_error,omitempty"` // error of the last dropped batch (cleared on success)
+}
+
+// ConfigStatus reports which remote configuration version the agent
+// applied and why the latest one was rejected (if it was).
+type ConfigStatus struct {
+	Version         string   `json:"version,omitempty"`
+	AppliedAt       int64    `json:"applied_at_ms,omitempty"`
+	RejectedVersion string   `json:"rejected_version,omitempty"`
+	RejectReason    string   `json:"reject_reason,omitempty"`
+	IgnoredKeys     []string `json:"ignored_keys,omitempty"`
+}
+
+// Alert states reported in AlertEvent.
+const (
+	AlertFiring   = "firing"
+	AlertResolved = "resolved"
+)
+
+// AlertEvent reports a local alert rule changing state.
+type AlertEvent struct {
+	Rule      string            `json:"rule"`
+	State     string            `json:"state"` // firing, resolved
+	Severity  string            `json:"severity"`
+	Metric    string            `json:"metric"`
+	Value     float64           `json:"value"`
+	Threshold float64           `json:"threshold"` // firing or resolve threshold that was crossed
+	Labels    map[string]string `json:"labels,omitempty"`
+	Since     int64             `json:"since_ms"` // when the condition started to hold
+	Timestamp int64             `json:"timestamp_ms"`
+}
@@ -0,0 +1,628 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"dideban-agent/internal/collector"
+	"dideban-agent/internal/logger"
+	"dideban-agent/internal/payload"
+	"dideban-agent/internal/ring"
+	"dideban-agent/internal/sender"
+	"dideban-agent/internal/state"
+)
+
+// log is the logger of the queue component.
+var log = logger.New("queue")
+
+// Overflow policies applied when the in-memory queue is full.
+const (
+	DropOldest = "drop_oldest"
+	DropNewest = "drop_newest"
+	Spill      = "spill"
+)
+
+// spoolDir is the state directory subdirectory holding spilled snapshots.
+const spoolDir = "spool"
+
+// Config contains configuration for the snapshot queue.
+type Config struct {
+	// Snapshots held in memory
+	Size int
+
+	// Overflow policy: drop_oldest, drop_newest, spill
+	Overflow string
+
+	// Maximum number of spilled snapshots kept on disk (spill policy)
+	SpillMaxFiles int
+
+	// State directory for spilled snapshots (spill policy)
+	StateDir state.Dir
+
+	// Backoff between delivery attempts of a snapshot that failed to send
+	InitialRetryDelay time.Duration
+	MaxRetryDelay     time.Duration
+}
+
+// entry is a queued snapshot. seq identifies it while it is being sent;
+// file is its spool file name if it is delivered from the spool.
+type entry struct {
+	seq     uint64
+	file    string
+	metrics *collector.Metrics
+}
+
+// Queue decouples collection from sending.
+//
+// Collected snapshots are pushed without blocking; a worker (Run)
+// delivers them in order through the current sender. A snapshot stays
+// at the head of the queue until it is sent or fails permanently, so
+// data is kept while Core is unreachable, within the limits of the
+// overflow policy. If Core rejects the credential (401), delivery pauses
+// until the token changes instead of dropping snapshots.
+//
+// Retries compose: a delivery attempt is one Send, in which the HTTP
+// sender makes up to MaxRetries+1 requests. Once it gives up, the queue
+// waits with its own backoff, or for the Retry-After delay of the last
+// response, before the next delivery attempt.
+//
+// With the spill policy, snapshots that overflow the memory queue are
+// written to the spool and delivered from there once the memory queue is
+// empty; a spool file is removed only after its snapshot was delivered.
+type Queue struct {
+	config Config
+
+	// Serializes spool file operations so that spilled snapshots keep their
+	// order. Disk I/O happens with spoolMu held but never with mu held;
+	// spoolMu is always acquired before mu.
+	spoolMu sync.Mutex
+
+	mu       sync.Mutex
+	items    *ring.Buffer[entry]
+	spilled  []string // spool file names, oldest first
+	seq      uint64
+	sender   sender.Sender
+	tokens   sender.TokenSource // nil if the sender does not authenticate
+	paused   bool               // credential rejected, waiting for a new token
+	dropped  uint64
+	sent     uint64
+	lastSent time.Time
+	lastErr  error
+	closing  bool // shutting down; spilled snapshots stay on disk
+	sending  bool // a delivery is in flight
+
+	// Signals the worker that a snapshot was pushed
+	wake chan struct{}
+
+	// Signals Shutdown that a delivery finished, a snapshot left the
+	// queue or delivery paused
+	removed chan struct{}
+
+	// Signals a paused worker that the sender was replaced
+	replaced chan struct{}
+
+	// Stops the worker; done is closed when it returned
+	stop context.CancelFunc
+	done chan struct{}
+}
+
+// New creates a queue delivering through s, which authenticates with
+// tokens (nil if it does not). With the spill policy, snapshots spilled
+// by a previous run are picked up again.
+func New(config Config, s sender.Sender, tokens sender.TokenSource) (*Queue, error) {
+	q := &Queue{
+		config:   config,
+		items:    ring.New[entry](config.Size),
+		sender:   s,
+		tokens:   tokens,
+		wake:     make(chan struct{}, 1),
+		removed:  make(chan struct{}, 1),
+		replaced: make(chan struct{}, 1),
+	}
+
+	if config.Overflow == Spill {
+		spilled, err := q.loadSpool()
+		if err != nil {
+			return nil, err
+		}
+		q.spilled = spilled
+
+		if len(spilled) > 0 {
+			log.Info().Int("snapshots", len(spilled)).Msg("📦 Resuming delivery of spilled snapshots")
+		}
+	}
+
+	return q, nil
+}
+
+// SetSender replaces the sender used for subsequent deliveries and its
+// token source, and returns the previous sender. Paused delivery resumes.
+func (q *Queue) SetSender(s sender.Sender, tokens sender.TokenSource) sender.Sender {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	old := q.sender
+	q.sender = s
+	q.tokens = tokens
+	signal(q.replaced)
+	return old
+}
+
+// Push queues a snapshot, applying the overflow policy if the queue is
+// full. It does not wait for deliveries; with the spill policy, it may
+// wait for the spool to be written.
+func (q *Queue) Push(metrics *collector.Metrics) {
+	if q.config.Overflow == Spill {
+		q.spoolMu.Lock()
+		defer q.spoolMu.Unlock()
+	}
+
+	q.mu.Lock()
+	q.seq++
+	item := entry{seq: q.seq, metrics: metrics}
+
+	// Keep FIFO order once snapshots are on disk
+	spill := q.config.Overflow == Spill && (q.items.Full() || len(q.spilled) > 0)
+	if !spill {
+		q.pushMemory(item)
+	}
+	q.mu.Unlock()
+
+	if spill {
+		q.spill(item)
+	}
+
+	signal(q.wake)
+}
+
+// pushMemory adds a snapshot to the memory queue, dropping the oldest or
+// the newest snapshot if it is full. Must be called with q.mu held.
+func (q *Queue) pushMemory(item entry) {
+	if q.items.Full() && q.config.Overflow == DropNewest {
+		q.dropped++
+		log.Warn().Int64("timestamp_ms", item.metrics.Timestamp).Msg("Queue full, dropping newest snapshot")
+		return
+	}
+
+	if q.items.Push(item) {
+		q.dropped++
+		log.Warn().Msg("Queue full, dropped oldest snapshot")
+	}
+}
+
+// Stats returns the current queue statistics.
+func (q *Queue) Stats() *payload.QueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	stats := &payload.QueueStats{
+		Depth:    q.items.Len(),
+		Capacity: q.items.Cap(),
+		Spilled:  len(q.spilled),
+		Dropped:  q.dropped,
+		Sent:     q.sent,
+		Overflow: q.config.Overflow,
+		Paused:   q.paused,
+	}
+	if !q.lastSent.IsZero() {
+		stats.LastSent = q.lastSent.UnixMilli()
+	}
+	if q.lastErr != nil {
+		stats.LastError = q.lastErr.Error()
+	}
+	return stats
+}
+
+// Start delivers queued snapshots in the background until Shutdown.
+//
+// The worker does not stop with the agent's root context, so a send in
+// flight when a shutdown signal arrives is not aborted.
+func (q *Queue) Start() {
+	var ctx context.Context
+	ctx, q.stop = context.WithCancel(context.Background())
+	q.done = make(chan struct{})
+
+	go func() {
+		defer close(q.done)
+		q.run(ctx)
+	}()
+}
+
+// Shutdown delivers the snapshots queued in memory until they are all
+// sent or ctx is done, then stops the worker. A delivery from the spool
+// in flight is completed, but no further spilled snapshots are sent:
+// they stay on disk for the next start, and with the spill policy,
+// snapshots left in memory are spilled as well.
+//
+// It returns the number of snapshots lost.
+func (q *Queue) Shutdown(ctx context.Context) int {
+	q.mu.Lock()
+	q.closing = true
+	q.mu.Unlock()
+
+	// A paused worker would not deliver before the timeout
+	for q.busy() && !q.isPaused() && ctx.Err() == nil {
+		select {
+		case <-ctx.Done():
+		case <-q.removed:
+		}
+	}
+
+	q.stop()
+	<-q.done
+
+	q.mu.Lock()
+	items := q.items.Drain()
+	if q.config.Overflow != Spill {
+		q.dropped += uint64(len(items))
+		q.mu.Unlock()
+		return len(items)
+	}
+	q.mu.Unlock()
+
+	q.spoolMu.Lock()
+	defer q.spoolMu.Unlock()
+
+	// spill counts the snapshots it fails to write as dropped
+	lost := 0
+	for _, item := range items {
+		if !q.spill(item) {
+			lost++
+		}
+	}
+	return lost
+}
+
+// isPaused reports whether delivery is paused after a rejected credential.
+func (q *Queue) isPaused() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.paused
+}
+
+// busy reports whether snapshots are queued in memory or a delivery is
+// in flight.
+func (q *Queue) busy() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.items.Len() > 0 || q.sending
+}
+
+// run delivers queued snapshots until ctx is cancelled.
+//
+// Snapshots that fail with a retryable error (including an open circuit)
+// are retried with exponential backoff; permanently rejected snapshots
+// are dropped. A rejected credential pauses delivery (waitForToken).
+func (q *Queue) run(ctx context.Context) {
+	backoff := q.config.InitialRetryDelay
+
+	for {
+		item, s, ok := q.next()
+		if !ok {
+			select {
+			case <-ctx.Done():
+				return
+			case <-q.wake:
+				continue
+			}
+		}
+
+		err := s.Send(ctx, item.metrics)
+		q.finished()
+		if err != nil && ctx.Err() != nil {
+			return
+		}
+
+		// The snapshot is fine, the credential is not
+		if errors.Is(err, sender.ErrUnauthorized) {
+			if !q.waitForToken(ctx, err) {
+				return
+			}
+			backoff = q.config.InitialRetryDelay
+			continue
+		}
+
+		if err == nil || !retryable(err) {
+			q.remove(item, err)
+			backoff = q.config.InitialRetryDelay
+			continue
+		}
+
+		q.setLastError(err)
+
+		// An open circuit is expected while Core is down; transitions are logged by the breaker
+		if errors.Is(err, sender.ErrCircuitOpen) {
+			log.Debug().Err(err).Msg("Metrics not sent, circuit breaker open")
+		} else {
+			log.Warn().Err(err).Msg("Failed to send metrics, will retry")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(q.retryDelay(backoff, err)):
+		}
+		backoff = min(backoff*2, q.config.MaxRetryDelay)
+	}
+}
+
+// waitForToken pauses delivery after Core rejected the credential with
+// err. Queued snapshots are kept (within the overflow policy) until the
+// token source reports a new token, checked every MaxRetryDelay, or the
+// sender is replaced. It returns false if ctx was cancelled.
+func (q *Queue) waitForToken(ctx context.Context, err error) bool {
+	q.mu.Lock()
+	q.paused = true
+	q.lastErr = err
+	signal(q.removed)
+	q.mu.Unlock()
+
+	defer func() {
+		q.mu.Lock()
+		q.paused = false
+		q.mu.Unlock()
+	}()
+
+	log.Error().Err(err).Msg("🔒 Credential rejected by Core, pausing delivery until the token changes")
+
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-q.replaced:
+			log.Info().Msg("Sender replaced, resuming delivery")
+			return true
+		case <-time.After(q.config.MaxRetryDelay):
+		}
+
+		q.mu.Lock()
+		tokens := q.tokens
+		q.mu.Unlock()
+
+		if tokens == nil {
+			continue
+		}
+
+		changed, err := tokens.Reload(ctx)
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to reload token")
+			continue
+		}
+		if changed {
+			log.Info().Msg("🔑 Token changed, resuming delivery")
+			return true
+		}
+	}
+}
+
+// next returns the snapshot at the head of the queue and the sender to
+// use, and marks a delivery in flight until finished is called. Once the
+// memory queue is empty, spilled snapshots are delivered from the spool,
+// unless the queue is shutting down.
+func (q *Queue) next() (entry, sender.Sender, bool) {
+	q.mu.Lock()
+	item, ok := q.items.Peek()
+	s := q.sender
+	spooled := !ok && len(q.spilled) > 0 && !q.closing
+
+	// Set together with the closing check so that Shutdown waits for the
+	// spooled snapshot about to be read
+	q.sending = ok || spooled
+	q.mu.Unlock()
+
+	if spooled {
+		if item, ok = q.readSpool(); !ok {
+			q.finished()
+		}
+	}
+	return item, s, ok
+}
+
+// finished marks the delivery in flight as done.
+func (q *Queue) finished() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.sending = false
+	signal(q.removed)
+}
+
+// remove takes a delivered (or permanently rejected) snapshot off the
+// head of the queue, or out of the spool. It may already have been
+// dropped by the overflow policy while it was being sent.
+func (q *Queue) remove(item entry, err error) {
+	if item.file != "" {
+		q.removeSpooled(item.file)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if head, ok := q.items.Peek(); ok && item.file == "" && head.seq == item.seq {
+		q.items.Pop()
+	}
+	signal(q.removed)
+
+	q.lastErr = err
+
+	if err != nil {
+		q.dropped++
+		log.Error().Err(err).Int64("timestamp_ms", item.metrics.Timestamp).Msg("Metrics rejected, dropping snapshot")
+		return
+	}
+
+	q.sent++
+	q.lastSent = time.Now()
+	log.Debug().Msg("📊 Metrics transmission completed")
+}
+
+// setLastError records the error of a failed delivery attempt.
+func (q *Queue) setLastError(err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.lastErr = err
+}
+
+// retryDelay returns the time to wait before the next delivery attempt
+// after err: the Retry-After delay requested by Core (capped by
+// MaxRetryDelay), or full jitter like the HTTP sender.
+func (q *Queue) retryDelay(backoff time.Duration, err error) time.Duration {
+	var sendErr *sender.SendError
+	if errors.As(err, &sendErr) && sendErr.RetryAfter > 0 {
+		return min(sendErr.RetryAfter, q.config.MaxRetryDelay)
+	}
+	return rand.N(backoff) + 1
+}
+
+// retryable reports whether a failed send should be retried.
+func retryable(err error) bool {
+	var sendErr *sender.SendError
+	if errors.As(err, &sendErr) {
+		return sendErr.Retryable()
+	}
+	return true
+}
+
+// signal notifies a waiter without blocking.
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// spill writes a snapshot to the spool, dropping the oldest spilled
+// snapshot if the spool is full, and reports whether it was written.
+// Must be called with q.spoolMu held.
+func (q *Queue) spill(item entry) bool {
+	data, err := json.Marshal(item.metrics)
+	if err != nil {
+		q.drop()
+		log.Error().Err(err).Msg("Failed to encode snapshot for spilling")
+		return false
+	}
+
+	// Names sort in queue order: millisecond timestamp, then sequence
+	name := fmt.Sprintf("%013d-%010d.json", item.metrics.Timestamp, item.seq)
+	if err := q.config.StateDir.WriteFile(filepath.Join(spoolDir, name), data); err != nil {
+		q.drop()
+		log.Error().Err(err).Msg("Failed to spill snapshot to disk")
+		return false
+	}
+
+	q.mu.Lock()
+	var oldest string
+	if len(q.spilled) >= q.config.SpillMaxFiles {
+		oldest = q.spilled[0]
+		q.spilled = q.spilled[1:]
+		q.dropped++
+	}
+	q.spilled = append(q.spilled, name)
+	q.mu.Unlock()
+
+	if oldest != "" {
+		if err := q.config.StateDir.Remove(filepath.Join(spoolDir, oldest)); err != nil {
+			log.Warn().Err(err).Msg("Failed to remove spilled snapshot")
+		}
+		log.Warn().Msg("Spool full, dropped oldest spilled snapshot")
+	}
+
+	return true
+}
+
+// readSpool reads the oldest spilled snapshot, which stays in the spool
+// until it is delivered (removeSpooled). Unreadable files are dropped.
+func (q *Queue) readSpool() (entry, bool) {
+	q.spoolMu.Lock()
+	defer q.spoolMu.Unlock()
+
+	for {
+		q.mu.Lock()
+		if len(q.spilled) == 0 || q.closing {
+			q.mu.Unlock()
+			return entry{}, false
+		}
+		name := q.spilled[0]
+		q.mu.Unlock()
+
+		path := filepath.Join(spoolDir, name)
+		data, err := q.config.StateDir.ReadFile(path)
+		if err == nil {
+			var metrics collector.Metrics
+			if err = json.Unmarshal(data, &metrics); err == nil {
+				return entry{file: name, metrics: &metrics}, true
+			}
+		}
+
+		log.Warn().Err(err).Str("file", name).Msg("Dropping unreadable spilled snapshot")
+
+		q.mu.Lock()
+		q.spilled = q.spilled[1:]
+		q.dropped++
+		q.mu.Unlock()
+
+		if err := q.config.StateDir.Remove(path); err != nil {
+			log.Warn().Err(err).Msg("Failed to remove spilled snapshot")
+		}
+	}
+}
+
+// removeSpooled removes a delivered snapshot from the spool. The spool
+// may have dropped it already if it filled up while the snapshot was sent.
+func (q *Queue) removeSpooled(name string) {
+	q.spoolMu.Lock()
+	defer q.spoolMu.Unlock()
+
+	q.mu.Lock()
+	if len(q.spilled) > 0 && q.spilled[0] == name {
+		q.spilled = q.spilled[1:]
+	}
+	q.mu.Unlock()
+
+	if err := q.config.StateDir.Remove(filepath.Join(spoolDir, name)); err != nil {
+		log.Warn().Err(err).Msg("Failed to remove spilled snapshot")
+	}
+}
+
+// drop counts a snapshot lost by the spool.
+func (q *Queue) drop() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.dropped++
+}
+
+// loadSpool lists snapshots spilled by a previous run, oldest first.
+func (q *Queue) loadSpool() ([]string, error) {
+	dir := q.config.StateDir.Path(spoolDir)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create spool directory: %w", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spool directory: %w", err)
+	}
+
+	var names []string
+	for _, e := range entries {
+		if e.Type().IsRegular() && strings.HasSuffix(e.Name(), ".json") {
+			names = append(names, e.Name())
+		}
+	}
+	slices.Sort(names)
+
+	return names, nil
+}
@@ -0,0 +1,418 @@
+package queue
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"dideban-agent/internal/collector"
+	"dideban-agent/internal/sender"
+	"dideban-agent/internal/state"
+)
+
+// fakeSender answers every send with the current result of respond and
+// records the timestamps of the snapshots it accepted.
+type fakeSender struct {
+	mu      sync.Mutex
+	respond func() error
+	sent    []int64
+}
+
+func (f *fakeSender) Send(ctx context.Context, metrics *collector.Metrics) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	err := f.respond()
+	if err == nil {
+		f.sent = append(f.sent, metrics.Timestamp)
+	}
+	return err
+}
+
+func (f *fakeSender) Close() error { return nil }
+
+func (f *fakeSender) setRespond(respond func() error) {
+	f.mu.Lock()
+	f.respond = respond
+	f.mu.Unlock()
+}
+
+func (f *fakeSender) delivered() []int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.sent)
+}
+
+// fakeTokens reports a changed token once changed is set.
+type fakeTokens struct {
+	changed atomic.Bool
+}
+
+func (f *fakeTokens) Token() (string, error) { return "token", nil }
+
+func (f *fakeTokens) Reload(ctx context.Context) (bool, error) { return f.changed.Swap(false), nil }
+
+// blockingSender closes sending on the first send and completes it once
+// release is closed, unless its context is cancelled first.
+type blockingSender struct {
+	sending chan struct{}
+	release chan struct{}
+	err     error
+}
+
+func (b *blockingSender) Send(ctx context.Context, metrics *collector.Metrics) error {
+	close(b.sending)
+	select {
+	case <-b.release:
+	case <-ctx.Done():
+		b.err = ctx.Err()
+	}
+	return b.err
+}
+
+func (b *blockingSender) Close() error { return nil }
+
+func statusError(code int, kind sender.ErrorKind) func() error {
+	return func() error { return &sender.SendError{Kind: kind, StatusCode: code} }
+}
+
+func testConfig() Config {
+	return Config{
+		Size:              4,
+		Overflow:          DropOldest,
+		InitialRetryDelay: time.Millisecond,
+		MaxRetryDelay:     5 * time.Millisecond,
+	}
+}
+
+func TestQueueDelivery(t *testing.T) {
+	tests := []struct {
+		name        string
+		respond     func() error
+		wantSent    uint64
+		wantDropped uint64
+	}{
+		{name: "sent", respond: func() error { return nil }, wantSent: 2},
+		{name: "rejected", respond: statusError(http.StatusBadRequest, sender.KindPermanent), wantDropped: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := New(testConfig(), &fakeSender{respond: tt.respond}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			q.Start()
+
+			q.Push(&collector.Metrics{Timestamp: 1})
+			q.Push(&collector.Metrics{Timestamp: 2})
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			if lost := q.Shutdown(ctx); lost != 0 {
+				t.Errorf("Shutdown() lost %d snapshots", lost)
+			}
+
+			stats := q.Stats()
+			if stats.Sent != tt.wantSent || stats.Dropped != tt.wantDropped {
+				t.Errorf("sent %d, dropped %d, want %d and %d", stats.Sent, stats.Dropped, tt.wantSent, tt.wantDropped)
+			}
+		})
+	}
+}
+
+func TestQueueRetryAfter(t *testing.T) {
+	var attempts []time.Time
+	s := &fakeSender{respond: func() error {
+		attempts = append(attempts, time.Now())
+		if len(attempts) == 1 {
+			return &sender.SendError{Kind: sender.KindThrottled, StatusCode: http.StatusTooManyRequests, RetryAfter: 50 * time.Millisecond}
+		}
+		return nil
+	}}
+
+	config := testConfig()
+	config.MaxRetryDelay = time.Second
+
+	q, err := New(config, s, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.Start()
+	q.Push(&collector.Metrics{Timestamp: 1})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if lost := q.Shutdown(ctx); lost != 0 {
+		t.Fatalf("Shutdown() lost %d snapshots", lost)
+	}
+
+	if len(attempts) != 2 {
+		t.Fatalf("%d delivery attempts, want 2", len(attempts))
+	}
+	if delay := attempts[1].Sub(attempts[0]); delay < 50*time.Millisecond {
+		t.Errorf("retried after %v, want the Retry-After delay", delay)
+	}
+}
+
+func TestQueuePausesOnUnauthorized(t *testing.T) {
+	tests := []struct {
+		name   string
+		resume func(q *Queue, s *fakeSender, tokens *fakeTokens)
+	}{
+		{
+			name: "token changed",
+			resume: func(q *Queue, s *fakeSender, tokens *fakeTokens) {
+				s.setRespond(func() error { return nil })
+				tokens.changed.Store(true)
+			},
+		},
+		{
+			name: "sender replaced",
+			resume: func(q *Queue, s *fakeSender, tokens *fakeTokens) {
+				q.SetSender(&fakeSender{respond: func() error { return nil }}, tokens)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &fakeSender{respond: statusError(http.StatusUnauthorized, sender.KindPermanent)}
+			tokens := &fakeTokens{}
+
+			q, err := New(testConfig(), s, tokens)
+			if err != nil {
+				t.Fatal(err)
+			}
+			q.Start()
+			defer q.Shutdown(context.Background())
+
+			q.Push(&collector.Metrics{Timestamp: 1})
+			q.Push(&collector.Metrics{Timestamp: 2})
+
+			waitFor(t, "delivery paused", func() bool { return q.Stats().Paused })
+
+			// Several token checks later, nothing is dropped
+			time.Sleep(20 * time.Millisecond)
+			if stats := q.Stats(); stats.Depth != 2 || stats.Dropped != 0 {
+				t.Fatalf("paused queue has depth %d, dropped %d, want 2 and 0", stats.Depth, stats.Dropped)
+			}
+
+			tt.resume(q, s, tokens)
+
+			waitFor(t, "snapshots sent", func() bool { return q.Stats().Sent == 2 })
+			if q.Stats().Paused {
+				t.Error("delivery still paused")
+			}
+		})
+	}
+}
+
+func TestQueueShutdownWhilePaused(t *testing.T) {
+	s := &fakeSender{respond: statusError(http.StatusUnauthorized, sender.KindPermanent)}
+
+	config := testConfig()
+	config.Overflow = Spill
+	config.SpillMaxFiles = 10
+	config.StateDir = stateDir(t)
+
+	q, err := New(config, s, &fakeTokens{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.Start()
+	q.Push(&collector.Metrics{Timestamp: 1})
+
+	waitFor(t, "delivery paused", func() bool { return q.Stats().Paused })
+
+	// Does not wait for the timeout; the snapshot is spilled for the next start
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	if lost := q.Shutdown(ctx); lost != 0 {
+		t.Errorf("Shutdown() lost %d snapshots", lost)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Shutdown() took %v while paused", elapsed)
+	}
+	if spilled := q.Stats().Spilled; spilled != 1 {
+		t.Errorf("spilled %d snapshots, want 1", spilled)
+	}
+}
+
+func TestQueueSpill(t *testing.T) {
+	tests := []struct {
+		name        string
+		pushed      int
+		maxFiles    int
+		want        []int64
+		wantDropped uint64
+	}{
+		{name: "fits in memory", pushed: 3, maxFiles: 10, want: []int64{1, 2, 3}},
+		{name: "spilled in order", pushed: 8, maxFiles: 10, want: []int64{1, 2, 3, 4, 5, 6, 7, 8}},
+		{name: "spool full", pushed: 8, maxFiles: 2, want: []int64{1, 2, 3, 4, 7, 8}, wantDropped: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &fakeSender{respond: statusError(http.StatusBadGateway, sender.KindTransient)}
+
+			config := testConfig()
+			config.Overflow = Spill
+			config.SpillMaxFiles = tt.maxFiles
+			config.StateDir = stateDir(t)
+
+			q, err := New(config, s, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			q.Start()
+			defer q.Shutdown(context.Background())
+
+			for i := range tt.pushed {
+				q.Push(&collector.Metrics{Timestamp: int64(i + 1)})
+			}
+
+			// Spool files stay on disk while delivery fails
+			wantFiles := min(max(tt.pushed-config.Size, 0), tt.maxFiles)
+			if files := spoolFiles(t, config.StateDir); files != wantFiles {
+				t.Fatalf("%d spool files, want %d", files, wantFiles)
+			}
+
+			s.setRespond(func() error { return nil })
+
+			waitFor(t, "snapshots sent", func() bool { return len(s.delivered()) == len(tt.want) })
+			if got := s.delivered(); !slices.Equal(got, tt.want) {
+				t.Errorf("delivered %v, want %v", got, tt.want)
+			}
+			if files := spoolFiles(t, config.StateDir); files != 0 {
+				t.Errorf("%d spool files left after delivery", files)
+			}
+			if stats := q.Stats(); stats.Spilled != 0 || stats.Dropped != tt.wantDropped {
+				t.Errorf("spilled %d, dropped %d, want 0 and %d", stats.Spilled, stats.Dropped, tt.wantDropped)
+			}
+		})
+	}
+}
+
+func TestQueueSpoolResumes(t *testing.T) {
+	config := testConfig()
+	config.Overflow = Spill
+	config.SpillMaxFiles = 10
+	config.StateDir = stateDir(t)
+
+	// Core is down: snapshots in memory are spilled on shutdown
+	first, err := New(config, &fakeSender{respond: statusError(http.StatusBadGateway, sender.KindTransient)}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.Start()
+	for i := range 6 {
+		first.Push(&collector.Metrics{Timestamp: int64(i + 1)})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if lost := first.Shutdown(ctx); lost != 0 {
+		t.Fatalf("Shutdown() lost %d snapshots", lost)
+	}
+
+	s := &fakeSender{respond: func() error { return nil }}
+	second, err := New(config, s, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second.Start()
+	defer second.Shutdown(context.Background())
+
+	want := []int64{1, 2, 3, 4, 5, 6}
+	waitFor(t, "snapshots sent", func() bool { return len(s.delivered()) == len(want) })
+	if got := s.delivered(); !slices.Equal(got, want) {
+		t.Errorf("delivered %v, want %v", got, want)
+	}
+}
+
+func TestQueueShutdownCompletesSpooledDelivery(t *testing.T) {
+	config := testConfig()
+	config.Overflow = Spill
+	config.SpillMaxFiles = 10
+	config.StateDir = stateDir(t)
+
+	first, err := New(config, &fakeSender{respond: statusError(http.StatusBadGateway, sender.KindTransient)}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.Start()
+	for i := range 3 {
+		first.Push(&collector.Metrics{Timestamp: int64(i + 1)})
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	first.Shutdown(ctx)
+
+	// The first spooled snapshot is in flight when the agent shuts down
+	s := &blockingSender{sending: make(chan struct{}), release: make(chan struct{})}
+	second, err := New(config, s, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second.Start()
+	<-s.sending
+
+	done := make(chan int)
+	go func() { done <- second.Shutdown(context.Background()) }()
+
+	select {
+	case <-done:
+		t.Fatal("Shutdown() returned while a spooled snapshot was being sent")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(s.release)
+
+	if lost := <-done; lost != 0 {
+		t.Errorf("Shutdown() lost %d snapshots", lost)
+	}
+	if s.err != nil {
+		t.Errorf("in-flight send failed: %v", s.err)
+	}
+	if files := spoolFiles(t, config.StateDir); files != 2 {
+		t.Errorf("%d spool files, want the 2 snapshots not delivered", files)
+	}
+}
+
+// waitFor polls cond until it holds or a second passed.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// stateDir returns a private state directory for the test.
+func stateDir(t *testing.T) state.Dir {
+	t.Helper()
+	return state.Dir(filepath.Join(t.TempDir(), "state"))
+}
+
+// spoolFiles returns the number of files in the spool directory.
+func spoolFiles(t *testing.T, dir state.Dir) int {
+	t.Helper()
+
+	entries, err := os.ReadDir(dir.Path(spoolDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(entries)
+}
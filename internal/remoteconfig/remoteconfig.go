@@ -0,0 +1,393 @@
+package remoteconfig
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"dideban-agent/internal/alert"
+	"dideban-agent/internal/config"
+	"dideban-agent/internal/logger"
+	"dideban-agent/internal/payload"
+	"dideban-agent/internal/sender"
+	"dideban-agent/internal/state"
+	"dideban-agent/internal/version"
+)
+
+// log is the logger of the remoteconfig component.
+var log = logger.New("remoteconfig")
+
+// stateFile is the state directory file holding the last good document.
+const stateFile = "remote_config.json"
+
+// maxDocumentSize limits the size of a configuration document.
+const maxDocumentSize = 1 << 20
+
+// Document is a versioned configuration document delivered by Core.
+// Config uses the same nested keys as the local configuration file.
+type Document struct {
+	Version string         `json:"version"`
+	Config  map[string]any `json:"config"`
+}
+
+// Config contains configuration for the remote configuration manager.
+type Config struct {
+	// Endpoint polled for documents (empty disables polling)
+	Endpoint string
+
+	// Interval between polls
+	PollInterval time.Duration
+
+	// Timeout of a single poll request
+	RequestTimeout time.Duration
+
+	// Directory where the last good document is persisted
+	StateDir state.Dir
+}
+
+// ApplyFunc receives every accepted configuration.
+// It must not block; the agent loop applies the configuration
+// asynchronously and reports the outcome with Manager.Result.
+type ApplyFunc func(cfg *config.Config)
+
+// Manager fetches configuration documents from Core, validates them with
+// the regular configuration pipeline, hands accepted configurations to
+// the agent and persists the last good document for offline starts.
+type Manager struct {
+	config Config
+	apply  ApplyFunc
+
+	// Serializes Offer, so overlapping offers of a version are handed
+	// to the agent once
+	offerMu sync.Mutex
+
+	mu      sync.Mutex
+	status  payload.ConfigStatus
+	current *Document
+	pending *pending // valid document waiting to be applied
+	invalid string   // last version that failed validation
+}
+
+// pending is a valid document handed to the agent but not applied yet.
+type pending struct {
+	doc     *Document
+	ignored []string
+	cfg     *config.Config // latest configuration built from doc
+}
+
+// New creates a Manager that hands accepted configurations to apply.
+func New(config Config, apply ApplyFunc) *Manager {
+	return &Manager{
+		config: config,
+		apply:  apply,
+	}
+}
+
+// Endpoint returns the polled endpoint (empty if polling is disabled).
+func (m *Manager) Endpoint() string {
+	return m.config.Endpoint
+}
+
+// LoadPersisted loads the last good document from the state directory
+// and returns the resulting configuration, so the agent starts with it
+// even while Core is unreachable. It returns nil if there is no usable
+// persisted document.
+func (m *Manager) LoadPersisted() *config.Config {
+	data, err := m.config.StateDir.ReadFile(stateFile)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Warn().Err(err).Msg("Failed to read persisted remote configuration")
+		}
+		return nil
+	}
+
+	var doc Document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		log.Warn().Err(err).Msg("Ignoring corrupt persisted remote configuration")
+		return nil
+	}
+
+	cfg, ignored, err := m.validate(&doc)
+	if err != nil {
+		// Local configuration may have changed since the document was stored
+		log.Warn().
+			Err(err).
+			Str("version", doc.Version).
+			Msg("Persisted remote configuration no longer valid")
+		return nil
+	}
+
+	log.Info().
+		Str("version", doc.Version).
+		Msg("⚙️ Starting with persisted remote configuration")
+
+	m.mu.Lock()
+	m.setApplied(&doc, ignored)
+	m.mu.Unlock()
+
+	return cfg
+}
+
+// Run polls the configuration endpoint until ctx is cancelled.
+// It returns immediately if no endpoint is configured.
+//
+// The transport and token source should match the HTTP sender so that
+// TLS, proxy and authentication settings are identical.
+func (m *Manager) Run(ctx context.Context, transport http.RoundTripper, tokens sender.TokenSource) {
+	if m.config.Endpoint == "" {
+		return
+	}
+
+	client := &http.Client{
+		Timeout:   m.config.RequestTimeout,
+		Transport: transport,
+	}
+
+	ticker := time.NewTicker(m.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := m.poll(ctx, client, tokens); err != nil && ctx.Err() == nil {
+			log.Warn().Err(err).Msg("Failed to fetch remote configuration")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// HandleResponse inspects a sender response body for an embedded
+// configuration document ({"remote_config": {...}}) and offers it.
+// Bodies without a document are ignored.
+func (m *Manager) HandleResponse(body []byte) {
+	if len(body) == 0 {
+		return
+	}
+
+	var envelope struct {
+		RemoteConfig *Document `json:"remote_config"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil || envelope.RemoteConfig == nil {
+		return
+	}
+
+	m.Offer(envelope.RemoteConfig)
+}
+
+// Offer validates a document and, if it is new and valid, hands the
+// resulting configuration to the agent. It is recorded as applied (and
+// persisted) once the agent reports success with Result. Rejections are
+// recorded and reported in Status. A version that failed validation is
+// not validated again; one the agent failed to apply is offered again
+// when Core delivers it the next time.
+func (m *Manager) Offer(doc *Document) {
+	if doc.Version == "" {
+		log.Warn().Msg("Ignoring remote configuration without version")
+		return
+	}
+
+	m.offerMu.Lock()
+	defer m.offerMu.Unlock()
+
+	m.mu.Lock()
+	seen := doc.Version == m.status.Version || doc.Version == m.invalid ||
+		(m.pending != nil && doc.Version == m.pending.doc.Version)
+	m.mu.Unlock()
+
+	if seen {
+		return
+	}
+
+	cfg, ignored, err := m.validate(doc)
+	if err != nil {
+		m.mu.Lock()
+		m.invalid = doc.Version
+		m.reject(doc.Version, err)
+		m.mu.Unlock()
+		return
+	}
+
+	log.Info().
+		Str("version", doc.Version).
+		Msg("⚙️ Remote configuration accepted")
+
+	m.mu.Lock()
+	m.pending = &pending{doc: doc, ignored: ignored, cfg: cfg}
+	m.mu.Unlock()
+
+	m.apply(cfg)
+}
+
+// Result records the outcome of applying a configuration handed to the
+// agent. If cfg was built from a pending document, the document is
+// recorded as applied and persisted, or as rejected if err is not nil.
+// Other configurations (e.g. local reloads) are ignored.
+func (m *Manager) Result(cfg *config.Config, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.pending == nil || m.pending.cfg != cfg {
+		return
+	}
+
+	p := m.pending
+	m.pending = nil
+
+	if err != nil {
+		m.reject(p.doc.Version, err)
+		return
+	}
+
+	m.setApplied(p.doc, p.ignored)
+
+	if err := m.persist(p.doc); err != nil {
+		log.Warn().Err(err).Msg("Failed to persist remote configuration")
+	}
+}
+
+// Rebuild reloads the local configuration and re-applies the latest
+// remote document on top of it (e.g. after the local file changed).
+func (m *Manager) Rebuild() (*config.Config, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	doc := m.current
+	if m.pending != nil {
+		doc = m.pending.doc
+	}
+
+	if doc == nil {
+		return config.Load()
+	}
+
+	cfg, _, err := config.LoadWithOverlay(&config.Overlay{
+		Version: doc.Version,
+		Values:  doc.Config,
+	})
+
+	// The pending document is applied with this configuration instead
+	if err == nil && m.pending != nil {
+		m.pending.cfg = cfg
+	}
+
+	return cfg, err
+}
+
+// Status returns a copy of the current remote configuration status.
+func (m *Manager) Status() *payload.ConfigStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	status := m.status
+	status.IgnoredKeys = slices.Clone(m.status.IgnoredKeys)
+	return &status
+}
+
+// validate builds the configuration resulting from the document and
+// returns it with the keys that were ignored.
+func (m *Manager) validate(doc *Document) (*config.Config, []string, error) {
+	cfg, result, err := config.LoadWithOverlay(&config.Overlay{
+		Version: doc.Version,
+		Values:  doc.Config,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := alert.Validate(cfg.Alerts.Rules); err != nil {
+		return nil, nil, fmt.Errorf("config: %w", err)
+	}
+
+	if len(result.Ignored) > 0 {
+		log.Warn().
+			Strs("keys", result.Ignored).
+			Str("version", doc.Version).
+			Msg("Remote configuration keys ignored (not tunable or pinned locally)")
+	}
+
+	return cfg, result.Ignored, nil
+}
+
+// setApplied records a document as applied. The caller holds m.mu.
+func (m *Manager) setApplied(doc *Document, ignored []string) {
+	// The last rejection stays reported so that Core sees why it was not applied
+	m.current = doc
+	m.status.Version = doc.Version
+	m.status.AppliedAt = time.Now().UnixMilli()
+	m.status.IgnoredKeys = ignored
+}
+
+// reject records a document as rejected. The caller holds m.mu.
+func (m *Manager) reject(version string, err error) {
+	log.Warn().
+		Err(err).
+		Str("version", version).
+		Msg("⚙️ Remote configuration rejected")
+
+	m.status.RejectedVersion = version
+	m.status.RejectReason = err.Error()
+}
+
+// poll fetches the document from the endpoint and offers it.
+func (m *Manager) poll(ctx context.Context, client *http.Client, tokens sender.TokenSource) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.config.Endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	token, err := tokens.Token()
+	if err != nil {
+		return fmt.Errorf("failed to get token: %w", err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", version.UserAgent())
+
+	// Let Core answer 304 if the applied version is still current
+	if version := m.Status().Version; version != "" {
+		req.Header.Set("If-None-Match", `"`+version+`"`)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified, http.StatusNoContent:
+		return nil
+	case http.StatusOK:
+	default:
+		return fmt.Errorf("server returned status %d", resp.StatusCode)
+	}
+
+	var doc Document
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxDocumentSize)).Decode(&doc); err != nil {
+		return fmt.Errorf("invalid configuration document: %w", err)
+	}
+
+	m.Offer(&doc)
+	return nil
+}
+
+// persist stores the document as the last good version.
+func (m *Manager) persist(doc *Document) error {
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal document: %w", err)
+	}
+	return m.config.StateDir.WriteFile(stateFile, data)
+}
@@ -0,0 +1,215 @@
+package remoteconfig
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"dideban-agent/internal/config"
+	"dideban-agent/internal/state"
+)
+
+// newTestManager writes a local configuration file to a temporary working
+// directory and returns a Manager recording the configurations it applies.
+func newTestManager(t *testing.T) (*Manager, *[]*config.Config) {
+	t.Helper()
+
+	dir := t.TempDir()
+	stateDir := filepath.Join(dir, "state")
+	local := "mode: development\nagent:\n  name: local\n  state_dir: " + stateDir + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(local), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(dir)
+
+	var mu sync.Mutex
+	applied := &[]*config.Config{}
+	m := New(Config{StateDir: state.Dir(stateDir)}, func(cfg *config.Config) {
+		mu.Lock()
+		defer mu.Unlock()
+		*applied = append(*applied, cfg)
+	})
+	return m, applied
+}
+
+// document returns a document setting agent.interval.
+func document(version, interval string) *Document {
+	return &Document{
+		Version: version,
+		Config:  map[string]any{"agent": map[string]any{"interval": interval}},
+	}
+}
+
+func TestOfferResult(t *testing.T) {
+	errApply := errors.New("listener failed")
+
+	type step struct {
+		doc      *Document
+		applyErr error
+	}
+
+	tests := []struct {
+		name          string
+		steps         []step
+		wantApplies   int
+		wantVersion   string
+		wantRejected  string
+		wantPersisted string
+	}{
+		{
+			name:          "applied",
+			steps:         []step{{doc: document("1", "30s")}},
+			wantApplies:   1,
+			wantVersion:   "1",
+			wantPersisted: "1",
+		},
+		{
+			name:          "applied version is not offered again",
+			steps:         []step{{doc: document("1", "30s")}, {doc: document("1", "30s")}},
+			wantApplies:   1,
+			wantVersion:   "1",
+			wantPersisted: "1",
+		},
+		{
+			name:         "invalid",
+			steps:        []step{{doc: document("1", "-1s")}, {doc: document("1", "-1s")}},
+			wantRejected: "1",
+		},
+		{
+			// Checked against the collector snapshot, not by the config package
+			name: "unknown alert metric",
+			steps: []step{{doc: &Document{Version: "1", Config: map[string]any{"alerts": map[string]any{
+				"rules": []any{map[string]any{"name": "r", "expr": "cpu.no_such_field > 1", "severity": "warning"}},
+			}}}}},
+			wantRejected: "1",
+		},
+		{
+			name:         "apply failure",
+			steps:        []step{{doc: document("1", "30s"), applyErr: errApply}},
+			wantApplies:  1,
+			wantRejected: "1",
+		},
+		{
+			// The rejection stays reported so Core sees why it was not applied
+			name:          "apply failure is retried",
+			steps:         []step{{doc: document("1", "30s"), applyErr: errApply}, {doc: document("1", "30s")}},
+			wantApplies:   2,
+			wantVersion:   "1",
+			wantRejected:  "1",
+			wantPersisted: "1",
+		},
+		{
+			name:          "newer version after invalid",
+			steps:         []step{{doc: document("1", "-1s")}, {doc: document("2", "30s")}},
+			wantApplies:   1,
+			wantVersion:   "2",
+			wantRejected:  "1",
+			wantPersisted: "2",
+		},
+		{
+			name:  "without version",
+			steps: []step{{doc: document("", "30s")}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, applied := newTestManager(t)
+
+			for _, step := range tt.steps {
+				before := len(*applied)
+				m.Offer(step.doc)
+				if len(*applied) > before {
+					m.Result((*applied)[len(*applied)-1], step.applyErr)
+				}
+			}
+
+			if len(*applied) != tt.wantApplies {
+				t.Errorf("applied %d times, want %d", len(*applied), tt.wantApplies)
+			}
+
+			status := m.Status()
+			if status.Version != tt.wantVersion || status.RejectedVersion != tt.wantRejected {
+				t.Errorf("Status() version %q, rejected %q, want %q and %q",
+					status.Version, status.RejectedVersion, tt.wantVersion, tt.wantRejected)
+			}
+			if tt.wantRejected != "" && status.RejectReason == "" {
+				t.Error("Status() has no reject reason")
+			}
+
+			var persisted Document
+			data, err := m.config.StateDir.ReadFile(stateFile)
+			if err == nil {
+				err = json.Unmarshal(data, &persisted)
+			}
+			if tt.wantPersisted == "" {
+				if err == nil {
+					t.Errorf("version %q persisted, want none", persisted.Version)
+				}
+			} else if err != nil || persisted.Version != tt.wantPersisted {
+				t.Errorf("persisted version %q (%v), want %q", persisted.Version, err, tt.wantPersisted)
+			}
+		})
+	}
+}
+
+func TestOfferWhilePending(t *testing.T) {
+	m, applied := newTestManager(t)
+
+	// Documents embedded in responses and polled ones may overlap
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Go(func() { m.Offer(document("1", "30s")) })
+	}
+	wg.Wait()
+
+	if len(*applied) != 1 {
+		t.Fatalf("applied %d times, want 1", len(*applied))
+	}
+
+	// Results for other configurations, e.g. local reloads, are ignored
+	m.Result(&config.Config{}, nil)
+	if m.Status().Version != "" {
+		t.Fatalf("Status() version = %q after an unrelated result", m.Status().Version)
+	}
+
+	m.Result((*applied)[0], nil)
+	if m.Status().Version != "1" {
+		t.Errorf("Status() version = %q, want %q", m.Status().Version, "1")
+	}
+}
+
+func TestLoadPersisted(t *testing.T) {
+	m, applied := newTestManager(t)
+
+	if cfg := m.LoadPersisted(); cfg != nil {
+		t.Fatal("LoadPersisted() without a persisted document returned a configuration")
+	}
+
+	m.Offer(document("1", "30s"))
+	m.Result((*applied)[0], nil)
+
+	restarted := New(m.config, func(*config.Config) {})
+	cfg := restarted.LoadPersisted()
+	if cfg == nil {
+		t.Fatal("LoadPersisted() = nil")
+	}
+	if cfg.Agent.Interval != 30*time.Second {
+		t.Errorf("agent.interval = %v, want 30s", cfg.Agent.Interval)
+	}
+	if restarted.Status().Version != "1" {
+		t.Errorf("Status() version = %q, want %q", restarted.Status().Version, "1")
+	}
+
+	// A document that is no longer valid is not used
+	if err := m.config.StateDir.WriteFile(stateFile, []byte(`{"version":"2","config":{"agent":{"interval":"-1s"}}}`)); err != nil {
+		t.Fatal(err)
+	}
+	if cfg := New(m.config, nil).LoadPersisted(); cfg != nil {
+		t.Error("LoadPersisted() returned a configuration from an invalid document")
+	}
+}
@@ -0,0 +1,90 @@
+package ring
+
+// Buffer is a fixed-capacity ring buffer. When full, pushing a value
+// overwrites the oldest one. It is not safe for concurrent use.
+type Buffer[T any] struct {
+	values []T
+	start  int // index of the oldest value
+	count  int
+}
+
+// New creates a buffer holding up to capacity values (at least one).
+func New[T any](capacity int) *Buffer[T] {
+	return &Buffer[T]{values: make([]T, max(capacity, 1))}
+}
+
+// Push appends a value, overwriting the oldest one if the buffer is full.
+// It reports whether a value was overwritten.
+func (b *Buffer[T]) Push(value T) bool {
+	end := (b.start + b.count) % len(b.values)
+	b.values[end] = value
+
+	if b.count < len(b.values) {
+		b.count++
+		return false
+	}
+
+	b.start = (b.start + 1) % len(b.values)
+	return true
+}
+
+// Peek returns the oldest value without removing it.
+func (b *Buffer[T]) Peek() (T, bool) {
+	if b.count == 0 {
+		var zero T
+		return zero, false
+	}
+	return b.values[b.start], true
+}
+
+// Pop removes and returns the oldest value.
+func (b *Buffer[T]) Pop() (T, bool) {
+	value, ok := b.Peek()
+	if !ok {
+		return value, false
+	}
+
+	var zero T
+	b.values[b.start] = zero
+	b.start = (b.start + 1) % len(b.values)
+	b.count--
+	return value, true
+}
+
+// Full reports whether the buffer is at capacity.
+func (b *Buffer[T]) Full() bool {
+	return b.count == len(b.values)
+}
+
+// Len returns the number of values in the buffer.
+func (b *Buffer[T]) Len() int {
+	return b.count
+}
+
+// Cap returns the capacity of the buffer.
+func (b *Buffer[T]) Cap() int {
+	return len(b.values)
+}
+
+// Values returns a copy of the values, oldest first.
+func (b *Buffer[T]) Values() []T {
+	values := make([]T, b.count)
+	for i := range b.count {
+		values[i] = b.values[(b.start+i)%len(b.values)]
+	}
+	return values
+}
+
+// Drain returns the values, oldest first, and empties the buffer.
+func (b *Buffer[T]) Drain() []T {
+	values := b.Values()
+	b.Reset()
+	return values
+}
+
+// Reset empties the buffer.
+func (b *Buffer[T]) Reset() {
+	clear(b.values)
+	b.start = 0
+	b.count = 0
+}
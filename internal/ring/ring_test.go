@@ -0,0 +1,81 @@
+package ring
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestBuffer(t *testing.T) {
+	tests := []struct {
+		name            string
+		capacity        int
+		pushed          []int
+		pops            int // values popped after pushing
+		want            []int
+		wantOverwritten int
+	}{
+		{name: "empty", capacity: 3},
+		{name: "partially filled", capacity: 3, pushed: []int{1, 2}, want: []int{1, 2}},
+		{name: "full", capacity: 3, pushed: []int{1, 2, 3}, want: []int{1, 2, 3}},
+		{name: "wrapped around", capacity: 3, pushed: []int{1, 2, 3, 4, 5}, want: []int{3, 4, 5}, wantOverwritten: 2},
+		{name: "wrapped twice", capacity: 3, pushed: []int{1, 2, 3, 4, 5, 6, 7}, want: []int{5, 6, 7}, wantOverwritten: 4},
+		{name: "popped after wrapping", capacity: 3, pushed: []int{1, 2, 3, 4}, pops: 2, want: []int{4}, wantOverwritten: 1},
+		{name: "capacity at least one", capacity: 0, pushed: []int{1, 2}, want: []int{2}, wantOverwritten: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := New[int](tt.capacity)
+
+			overwritten := 0
+			for _, v := range tt.pushed {
+				if b.Push(v) {
+					overwritten++
+				}
+			}
+			for range tt.pops {
+				b.Pop()
+			}
+
+			if overwritten != tt.wantOverwritten {
+				t.Errorf("%d values overwritten, want %d", overwritten, tt.wantOverwritten)
+			}
+			if got := b.Values(); !slices.Equal(got, tt.want) {
+				t.Errorf("Values() = %v, want %v", got, tt.want)
+			}
+			if b.Len() != len(tt.want) || b.Full() != (b.Len() == b.Cap()) {
+				t.Errorf("Len() = %d, Full() = %v, want %d values", b.Len(), b.Full(), len(tt.want))
+			}
+
+			head, ok := b.Peek()
+			if ok != (len(tt.want) > 0) || (ok && head != tt.want[0]) {
+				t.Errorf("Peek() = %d, %v, want the oldest value", head, ok)
+			}
+		})
+	}
+}
+
+func TestBufferReuseAfterDrain(t *testing.T) {
+	b := New[int](3)
+	for v := range 5 {
+		b.Push(v)
+	}
+
+	if got := b.Drain(); !slices.Equal(got, []int{2, 3, 4}) {
+		t.Fatalf("Drain() = %v, want [2 3 4]", got)
+	}
+	if _, ok := b.Pop(); ok || b.Len() != 0 {
+		t.Fatalf("buffer not empty after Drain(): %d values", b.Len())
+	}
+
+	for v := range 4 {
+		b.Push(10 + v)
+	}
+	var popped []int
+	for v, ok := b.Pop(); ok; v, ok = b.Pop() {
+		popped = append(popped, v)
+	}
+	if !slices.Equal(popped, []int{11, 12, 13}) {
+		t.Errorf("popped %v, want [11 12 13]", popped)
+	}
+}
@@ -0,0 +1,59 @@
+// Package sandbox reduces the privileges of the agent process after
+// startup: it switches to an unprivileged user while keeping selected
+// capabilities, sets no_new_privs and restricts filesystem access with
+// Landlock (Linux only).
+//
+// Capabilities, no_new_privs and Landlock are per-thread attributes and
+// are applied to every thread of the process, which Go only supports in
+// binaries built without cgo (CGO_ENABLED=0). Restrictions that cannot
+// be applied are reported rather than treated as fatal; the report is
+// read back from the kernel, so it shows what actually took effect.
+package sandbox
+
+import (
+	"fmt"
+
+	"dideban-agent/internal/payload"
+)
+
+// Config contains the restrictions to apply.
+type Config struct {
+	// User (name or ID) to switch to; requires root. Empty keeps the
+	// current user.
+	User string
+
+	// Group (name or ID) to switch to; defaults to the user's primary group
+	Group string
+
+	// Capabilities kept after switching users (e.g. CAP_DAC_READ_SEARCH)
+	Capabilities []string
+
+	// Directories handed to the user, with their contents, before
+	// switching (the agent's own state)
+	OwnedDirs []string
+
+	// Directories the user must be able to write after switching (log
+	// rotation, status socket); switching fails if it could not
+	WritableDirs []string
+
+	// Set no_new_privs (implied by Landlock)
+	NoNewPrivs bool
+
+	// Restrict filesystem access with Landlock to the paths below
+	Landlock bool
+
+	// Paths readable, writable, and readable and executable under Landlock
+	ReadPaths  []string
+	WritePaths []string
+	ExecPaths  []string
+}
+
+// Enabled reports whether any restriction is configured.
+func (c *Config) Enabled() bool {
+	return c.User != "" || c.NoNewPrivs || c.Landlock
+}
+
+// addError records a restriction that did not take effect.
+func addError(report *payload.SandboxStats, format string, args ...any) {
+	report.Errors = append(report.Errors, fmt.Sprintf(format, args...))
+}
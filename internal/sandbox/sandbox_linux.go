@@ -0,0 +1,460 @@
+//go:build linux
+
+package sandbox
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+
+	"dideban-agent/internal/payload"
+)
+
+// capabilityNames lists capability names by number.
+var capabilityNames = []string{
+	unix.CAP_CHOWN:              "CAP_CHOWN",
+	unix.CAP_DAC_OVERRIDE:       "CAP_DAC_OVERRIDE",
+	unix.CAP_DAC_READ_SEARCH:    "CAP_DAC_READ_SEARCH",
+	unix.CAP_FOWNER:             "CAP_FOWNER",
+	unix.CAP_FSETID:             "CAP_FSETID",
+	unix.CAP_KILL:               "CAP_KILL",
+	unix.CAP_SETGID:             "CAP_SETGID",
+	unix.CAP_SETUID:             "CAP_SETUID",
+	unix.CAP_SETPCAP:            "CAP_SETPCAP",
+	unix.CAP_LINUX_IMMUTABLE:    "CAP_LINUX_IMMUTABLE",
+	unix.CAP_NET_BIND_SERVICE:   "CAP_NET_BIND_SERVICE",
+	unix.CAP_NET_BROADCAST:      "CAP_NET_BROADCAST",
+	unix.CAP_NET_ADMIN:          "CAP_NET_ADMIN",
+	unix.CAP_NET_RAW:            "CAP_NET_RAW",
+	unix.CAP_IPC_LOCK:           "CAP_IPC_LOCK",
+	unix.CAP_IPC_OWNER:          "CAP_IPC_OWNER",
+	unix.CAP_SYS_MODULE:         "CAP_SYS_MODULE",
+	unix.CAP_SYS_RAWIO:          "CAP_SYS_RAWIO",
+	unix.CAP_SYS_CHROOT:         "CAP_SYS_CHROOT",
+	unix.CAP_SYS_PTRACE:         "CAP_SYS_PTRACE",
+	unix.CAP_SYS_PACCT:          "CAP_SYS_PACCT",
+	unix.CAP_SYS_ADMIN:          "CAP_SYS_ADMIN",
+	unix.CAP_SYS_BOOT:           "CAP_SYS_BOOT",
+	unix.CAP_SYS_NICE:           "CAP_SYS_NICE",
+	unix.CAP_SYS_RESOURCE:       "CAP_SYS_RESOURCE",
+	unix.CAP_SYS_TIME:           "CAP_SYS_TIME",
+	unix.CAP_SYS_TTY_CONFIG:     "CAP_SYS_TTY_CONFIG",
+	unix.CAP_MKNOD:              "CAP_MKNOD",
+	unix.CAP_LEASE:              "CAP_LEASE",
+	unix.CAP_AUDIT_WRITE:        "CAP_AUDIT_WRITE",
+	unix.CAP_AUDIT_CONTROL:      "CAP_AUDIT_CONTROL",
+	unix.CAP_SETFCAP:            "CAP_SETFCAP",
+	unix.CAP_MAC_OVERRIDE:       "CAP_MAC_OVERRIDE",
+	unix.CAP_MAC_ADMIN:          "CAP_MAC_ADMIN",
+	unix.CAP_SYSLOG:             "CAP_SYSLOG",
+	unix.CAP_WAKE_ALARM:         "CAP_WAKE_ALARM",
+	unix.CAP_BLOCK_SUSPEND:      "CAP_BLOCK_SUSPEND",
+	unix.CAP_AUDIT_READ:         "CAP_AUDIT_READ",
+	unix.CAP_PERFMON:            "CAP_PERFMON",
+	unix.CAP_BPF:                "CAP_BPF",
+	unix.CAP_CHECKPOINT_RESTORE: "CAP_CHECKPOINT_RESTORE",
+}
+
+// Landlock access rights granted to the configured paths.
+const (
+	accessRead = unix.LANDLOCK_ACCESS_FS_READ_FILE | unix.LANDLOCK_ACCESS_FS_READ_DIR
+
+	accessExec = accessRead | unix.LANDLOCK_ACCESS_FS_EXECUTE
+
+	accessWrite = accessRead |
+		unix.LANDLOCK_ACCESS_FS_WRITE_FILE |
+		unix.LANDLOCK_ACCESS_FS_REMOVE_DIR |
+		unix.LANDLOCK_ACCESS_FS_REMOVE_FILE |
+		unix.LANDLOCK_ACCESS_FS_MAKE_DIR |
+		unix.LANDLOCK_ACCESS_FS_MAKE_REG |
+		unix.LANDLOCK_ACCESS_FS_MAKE_SOCK |
+		unix.LANDLOCK_ACCESS_FS_MAKE_FIFO |
+		unix.LANDLOCK_ACCESS_FS_MAKE_SYM |
+		unix.LANDLOCK_ACCESS_FS_REFER |
+		unix.LANDLOCK_ACCESS_FS_TRUNCATE
+
+	// Rights that apply to files; rules on files may only grant these
+	accessFile = unix.LANDLOCK_ACCESS_FS_EXECUTE |
+		unix.LANDLOCK_ACCESS_FS_WRITE_FILE |
+		unix.LANDLOCK_ACCESS_FS_READ_FILE |
+		unix.LANDLOCK_ACCESS_FS_TRUNCATE
+)
+
+// errAllThreads is returned when per-thread attributes cannot be applied
+// to every thread of the process.
+var errAllThreads = errors.New("not supported in binaries built with cgo (build with CGO_ENABLED=0)")
+
+// Apply applies the restrictions in cfg to the whole process and returns
+// what took effect. An error is only returned if switching users fails,
+// since running with more privileges than configured is not safe;
+// capabilities, no_new_privs and Landlock are applied as far as the
+// kernel and the binary allow and reported otherwise.
+func Apply(cfg Config) (*payload.SandboxStats, error) {
+	report := &payload.SandboxStats{}
+
+	if cfg.User != "" {
+		if err := switchUser(cfg, report); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.NoNewPrivs || cfg.Landlock {
+		if err := allThreads(unix.SYS_PRCTL, unix.PR_SET_NO_NEW_PRIVS, 1, 0); err != nil {
+			addError(report, "no_new_privs: %v", err)
+		}
+	}
+
+	if cfg.Landlock {
+		abi, err := restrictFilesystem(cfg)
+		if err != nil {
+			addError(report, "landlock: %v", err)
+		}
+		report.LandlockABI = abi
+	}
+
+	if err := inspect(report); err != nil {
+		addError(report, "failed to read process status: %v", err)
+	}
+
+	return report, nil
+}
+
+// allThreads runs a system call on every thread of the process.
+func allThreads(trap, a1, a2, a3 uintptr) error {
+	_, _, errno := syscall.AllThreadsSyscall(trap, a1, a2, a3)
+	switch errno {
+	case 0:
+		return nil
+	case syscall.ENOTSUP:
+		return errAllThreads
+	default:
+		return errno
+	}
+}
+
+// switchUser switches to the configured user and group, keeping the
+// configured capabilities.
+func switchUser(cfg Config, report *payload.SandboxStats) error {
+	account, err := lookupUser(cfg.User)
+	if err != nil {
+		return fmt.Errorf("sandbox: unknown user %s: %w", cfg.User, err)
+	}
+
+	uid, _ := strconv.Atoi(account.Uid)
+	gid, _ := strconv.Atoi(account.Gid)
+	if cfg.Group != "" {
+		group, err := lookupGroup(cfg.Group)
+		if err != nil {
+			return fmt.Errorf("sandbox: unknown group %s: %w", cfg.Group, err)
+		}
+		gid, _ = strconv.Atoi(group.Gid)
+	}
+
+	report.User = account.Username
+
+	if os.Geteuid() == uid && os.Getegid() == gid {
+		if len(cfg.Capabilities) > 0 {
+			addError(report, "capabilities: already running as %s, capabilities cannot be kept", account.Username)
+		}
+		return nil
+	}
+
+	if os.Geteuid() != 0 {
+		return fmt.Errorf("sandbox: cannot switch to user %s: not running as root", cfg.User)
+	}
+
+	for _, dir := range cfg.WritableDirs {
+		if !writable(dir, uid, gid) {
+			return fmt.Errorf("sandbox: %s is not writable by user %s", dir, account.Username)
+		}
+	}
+
+	// Files are created by the user from now on
+	for _, dir := range cfg.OwnedDirs {
+		if err := chownTree(dir, uid, gid); err != nil {
+			return fmt.Errorf("sandbox: failed to hand %s to user %s: %w", dir, account.Username, err)
+		}
+	}
+
+	var keep uint64
+	for _, name := range cfg.Capabilities {
+		number := capabilityNumber(name)
+		if number < 0 {
+			addError(report, "capabilities: unknown capability %s", name)
+			continue
+		}
+		keep |= 1 << number
+	}
+
+	if keep != 0 {
+		if err := retainCapabilities(keep); err != nil {
+			addError(report, "capabilities: %v", err)
+			keep = 0
+		}
+	}
+
+	if err := syscall.Setgroups([]int{gid}); err != nil {
+		return fmt.Errorf("sandbox: failed to set supplementary groups: %w", err)
+	}
+	if err := syscall.Setgid(gid); err != nil {
+		return fmt.Errorf("sandbox: failed to switch to group %d: %w", gid, err)
+	}
+	if err := syscall.Setuid(uid); err != nil {
+		return fmt.Errorf("sandbox: failed to switch to user %s: %w", account.Username, err)
+	}
+
+	if keep != 0 {
+		if err := setCapabilities(keep); err != nil {
+			addError(report, "capabilities: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// chownTree changes the owner of dir and everything below it without
+// following symbolic links. A missing directory is ignored.
+func chownTree(dir string, uid, gid int) error {
+	err := filepath.WalkDir(dir, func(path string, _ os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Lchown(path, uid, gid)
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// writable reports whether the user and group may create files in dir
+// according to its owner and mode (ACLs are not considered). A missing
+// directory counts as writable, as there is nothing to write to.
+func writable(dir string, uid, gid int) bool {
+	var stat unix.Stat_t
+	if err := unix.Stat(dir, &stat); err != nil {
+		return errors.Is(err, unix.ENOENT)
+	}
+
+	switch {
+	case int(stat.Uid) == uid:
+		return stat.Mode&0o300 == 0o300
+	case int(stat.Gid) == gid:
+		return stat.Mode&0o030 == 0o030
+	default:
+		return stat.Mode&0o003 == 0o003
+	}
+}
+
+// lookupUser finds a user by name or numeric ID.
+func lookupUser(name string) (*user.User, error) {
+	if _, err := strconv.Atoi(name); err == nil {
+		return user.LookupId(name)
+	}
+	return user.Lookup(name)
+}
+
+// lookupGroup finds a group by name or numeric ID.
+func lookupGroup(name string) (*user.Group, error) {
+	if _, err := strconv.Atoi(name); err == nil {
+		return user.LookupGroupId(name)
+	}
+	return user.LookupGroup(name)
+}
+
+// capabilityNumber returns the number of a capability, or -1 if the name
+// is unknown.
+func capabilityNumber(name string) int {
+	for number, known := range capabilityNames {
+		if known == name {
+			return number
+		}
+	}
+	return -1
+}
+
+// retainCapabilities reduces the bounding set to keep and makes the
+// kernel keep permitted capabilities across the user switch.
+func retainCapabilities(keep uint64) error {
+	for number := range unix.CAP_LAST_CAP + 1 {
+		if keep&(1<<number) != 0 {
+			continue
+		}
+
+		err := allThreads(unix.SYS_PRCTL, unix.PR_CAPBSET_DROP, uintptr(number), 0)
+		if errors.Is(err, syscall.EINVAL) {
+			// Not known to the running kernel
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to drop %s from the bounding set: %w", capabilityNames[number], err)
+		}
+	}
+
+	return allThreads(unix.SYS_PRCTL, unix.PR_SET_KEEPCAPS, 1, 0)
+}
+
+// capHeader and capData are the capset arguments. They are not on a
+// goroutine stack, which may move while the call runs on every thread.
+var (
+	capHeader = unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	capData   [2]unix.CapUserData
+)
+
+// setCapabilities makes keep the effective and permitted capabilities
+// after the user switch.
+func setCapabilities(keep uint64) error {
+	capData[0] = unix.CapUserData{Effective: uint32(keep), Permitted: uint32(keep)}
+	capData[1] = unix.CapUserData{Effective: uint32(keep >> 32), Permitted: uint32(keep >> 32)}
+
+	err := allThreads(unix.SYS_CAPSET, uintptr(unsafe.Pointer(&capHeader)), uintptr(unsafe.Pointer(&capData[0])), 0)
+
+	// Later user switches (e.g. by executed programs) drop capabilities again
+	_ = allThreads(unix.SYS_PRCTL, unix.PR_SET_KEEPCAPS, 0, 0)
+	return err
+}
+
+// handledAccess returns the filesystem rights restricted with the given
+// Landlock ABI version.
+func handledAccess(abi int) uint64 {
+	// ABI 1: EXECUTE through MAKE_SYM
+	access := uint64(unix.LANDLOCK_ACCESS_FS_MAKE_SYM<<1 - 1)
+	if abi >= 2 {
+		access |= unix.LANDLOCK_ACCESS_FS_REFER
+	}
+	if abi >= 3 {
+		access |= unix.LANDLOCK_ACCESS_FS_TRUNCATE
+	}
+	return access
+}
+
+// restrictFilesystem enforces a Landlock ruleset allowing only the
+// configured paths and returns the ABI version used.
+func restrictFilesystem(cfg Config) (int, error) {
+	version, _, errno := unix.Syscall(unix.SYS_LANDLOCK_CREATE_RULESET, 0, 0, unix.LANDLOCK_CREATE_RULESET_VERSION)
+	if errno != 0 {
+		return 0, fmt.Errorf("not supported by the kernel: %w", errno)
+	}
+	abi := int(version)
+	handled := handledAccess(abi)
+
+	attr := unix.LandlockRulesetAttr{Access_fs: handled}
+	fd, _, errno := unix.Syscall(unix.SYS_LANDLOCK_CREATE_RULESET, uintptr(unsafe.Pointer(&attr)), unsafe.Sizeof(attr), 0)
+	if errno != 0 {
+		return 0, fmt.Errorf("failed to create ruleset: %w", errno)
+	}
+	ruleset := int(fd)
+	defer unix.Close(ruleset)
+
+	rules := []struct {
+		paths  []string
+		access uint64
+	}{
+		{cfg.ReadPaths, accessRead},
+		{cfg.WritePaths, accessWrite},
+		{cfg.ExecPaths, accessExec},
+	}
+
+	for _, rule := range rules {
+		for _, path := range rule.paths {
+			if err := addRule(ruleset, path, rule.access&handled); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	if err := allThreads(unix.SYS_LANDLOCK_RESTRICT_SELF, uintptr(ruleset), 0, 0); err != nil {
+		return 0, fmt.Errorf("failed to enforce ruleset: %w", err)
+	}
+
+	return abi, nil
+}
+
+// addRule allows access below path. Paths that do not exist are skipped.
+func addRule(ruleset int, path string, access uint64) error {
+	fd, err := unix.Open(path, unix.O_PATH|unix.O_CLOEXEC, 0)
+	if errors.Is(err, unix.ENOENT) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer unix.Close(fd)
+
+	var stat unix.Stat_t
+	if err := unix.Fstat(fd, &stat); err != nil {
+		return fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+	if stat.Mode&unix.S_IFMT != unix.S_IFDIR {
+		access &= accessFile
+	}
+
+	rule := unix.LandlockPathBeneathAttr{Allowed_access: access, Parent_fd: int32(fd)}
+	_, _, errno := unix.Syscall6(unix.SYS_LANDLOCK_ADD_RULE, uintptr(ruleset), unix.LANDLOCK_RULE_PATH_BENEATH,
+		uintptr(unsafe.Pointer(&rule)), 0, 0, 0)
+	if errno != 0 {
+		return fmt.Errorf("failed to allow %s: %w", path, errno)
+	}
+
+	return nil
+}
+
+// inspect fills the report with the credentials and restrictions the
+// kernel reports for the process.
+func inspect(report *payload.SandboxStats) error {
+	data, err := os.ReadFile("/proc/self/status")
+	if err != nil {
+		return err
+	}
+
+	for line := range strings.Lines(string(data)) {
+		key, value, _ := strings.Cut(line, ":")
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch key {
+		case "Uid":
+			// Real, effective, saved and filesystem IDs; report the effective one
+			if len(fields) > 1 {
+				report.UID, _ = strconv.Atoi(fields[1])
+			}
+		case "Gid":
+			if len(fields) > 1 {
+				report.GID, _ = strconv.Atoi(fields[1])
+			}
+		case "CapEff":
+			mask, _ := strconv.ParseUint(fields[0], 16, 64)
+			report.Capabilities = capabilityList(mask)
+		case "NoNewPrivs":
+			report.NoNewPrivs = fields[0] == "1"
+		}
+	}
+
+	return nil
+}
+
+// capabilityList returns the names of the capabilities in mask.
+func capabilityList(mask uint64) []string {
+	names := []string{}
+	for number := range 64 {
+		if mask&(1<<number) == 0 {
+			continue
+		}
+		if number < len(capabilityNames) {
+			names = append(names, capabilityNames[number])
+		} else {
+			names = append(names, "CAP_"+strconv.Itoa(number))
+		}
+	}
+	return names
+}
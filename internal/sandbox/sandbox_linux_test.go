@@ -0,0 +1,81 @@
+//go:build linux
+
+package sandbox
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestWritable(t *testing.T) {
+	uid, gid := os.Getuid(), os.Getgid()
+
+	tests := []struct {
+		name string
+		mode os.FileMode
+		uid  int
+		gid  int
+		want bool
+	}{
+		{name: "owner", mode: 0o700, uid: uid, gid: gid + 1, want: true},
+		{name: "owner read only", mode: 0o500, uid: uid, gid: gid, want: false},
+		{name: "group", mode: 0o770, uid: uid + 1, gid: gid, want: true},
+		{name: "group read only", mode: 0o750, uid: uid + 1, gid: gid, want: false},
+		{name: "other", mode: 0o777, uid: uid + 1, gid: gid + 1, want: true},
+		{name: "other read only", mode: 0o755, uid: uid + 1, gid: gid + 1, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.Chmod(dir, tt.mode); err != nil {
+				t.Fatal(err)
+			}
+			defer os.Chmod(dir, 0o700)
+
+			if got := writable(dir, tt.uid, tt.gid); got != tt.want {
+				t.Errorf("writable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if !writable(filepath.Join(t.TempDir(), "missing"), uid, gid) {
+		t.Error("writable() = false for a missing directory, want true")
+	}
+}
+
+func TestChownTree(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("requires root")
+	}
+
+	dir := t.TempDir()
+	nested := filepath.Join(dir, "spool", "batch.json")
+	if err := os.MkdirAll(filepath.Dir(nested), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(nested, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	const uid, gid = 65534, 65534
+	if err := chownTree(dir, uid, gid); err != nil {
+		t.Fatalf("chownTree() error = %v", err)
+	}
+
+	for _, path := range []string{dir, filepath.Dir(nested), nested} {
+		info, err := os.Lstat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stat := info.Sys().(*syscall.Stat_t); stat.Uid != uid || stat.Gid != gid {
+			t.Errorf("%s owned by %d:%d, want %d:%d", path, stat.Uid, stat.Gid, uid, gid)
+		}
+	}
+
+	if err := chownTree(filepath.Join(dir, "missing"), uid, gid); err != nil {
+		t.Errorf("chownTree() error = %v for a missing directory, want nil", err)
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package sandbox
+
+import (
+	"errors"
+
+	"dideban-agent/internal/payload"
+)
+
+// Apply reports that sandboxing is not available.
+func Apply(cfg Config) (*payload.SandboxStats, error) {
+	return nil, errors.New("sandbox: only available on Linux")
+}
@@ -0,0 +1,141 @@
+package schedule
+
+import (
+	"math/rand/v2"
+	"time"
+
+	"dideban-agent/internal/payload"
+)
+
+// Config contains configuration for the collection schedule.
+type Config struct {
+	// Time between collections
+	Interval time.Duration
+
+	// Align collections to wall-clock multiples of Interval (e.g. :00, :30)
+	Align bool
+
+	// Upper bound of a random offset added to every scheduled time,
+	// chosen once per schedule to spread a fleet's load on Core
+	Splay time.Duration
+}
+
+// Tick is a due collection.
+type Tick struct {
+	// Time the collection was scheduled for
+	Scheduled time.Time
+
+	// Scheduled times skipped because the agent was suspended, paused or
+	// starved for longer than an interval
+	Missed int
+}
+
+// Schedule computes collection times on the wall clock.
+//
+// Times are computed on the wall clock rather than the monotonic clock so
+// that a suspended host (whose monotonic clock stops) notices the
+// collections it missed when it resumes, instead of silently shifting.
+//
+// A Schedule is not safe for concurrent use.
+type Schedule struct {
+	config Config
+	now    func() time.Time // wall clock
+	offset time.Duration    // splay chosen for this schedule
+	next   time.Time
+	timer  *time.Timer
+
+	missed uint64
+	lag    time.Duration // delay of the latest tick past its scheduled time
+}
+
+// New creates a schedule whose first tick is due one interval (or, when
+// aligned, the next boundary) from now.
+func New(config Config) *Schedule {
+	return newSchedule(config, wallNow)
+}
+
+// newSchedule creates a schedule reading the wall clock from now.
+func newSchedule(config Config, now func() time.Time) *Schedule {
+	s := &Schedule{config: config, now: now}
+	if config.Splay > 0 {
+		s.offset = rand.N(config.Splay)
+	}
+
+	start := now()
+	s.next = s.after(start)
+	s.timer = time.NewTimer(s.next.Sub(start))
+	return s
+}
+
+// C returns the channel signalled when a tick may be due; call Tick
+// after receiving from it.
+func (s *Schedule) C() <-chan time.Time {
+	return s.timer.C
+}
+
+// Tick returns the due tick, if any, and arms the timer for the next one.
+//
+// It returns false if the timer fired before the scheduled time, which
+// happens when the wall clock was stepped back.
+func (s *Schedule) Tick() (Tick, bool) {
+	now := s.now()
+
+	if now.Before(s.next) {
+		// A clock stepped back by more than an interval would otherwise
+		// stall collection until it catches up again
+		if s.next.Sub(now) > s.config.Interval+s.config.Splay {
+			s.next = s.after(now)
+		}
+		s.timer.Reset(s.next.Sub(now))
+		return Tick{}, false
+	}
+
+	tick := Tick{Scheduled: s.next}
+
+	// Collect once for the latest scheduled time that passed
+	if late := now.Sub(s.next); late >= s.config.Interval {
+		tick.Missed = int(late / s.config.Interval)
+		tick.Scheduled = s.next.Add(time.Duration(tick.Missed) * s.config.Interval)
+		s.missed += uint64(tick.Missed)
+	}
+	s.lag = now.Sub(tick.Scheduled)
+
+	s.next = tick.Scheduled.Add(s.config.Interval)
+	s.timer.Reset(s.next.Sub(now))
+
+	return tick, true
+}
+
+// Stop stops the timer.
+func (s *Schedule) Stop() {
+	s.timer.Stop()
+}
+
+// Stats returns the current schedule statistics.
+func (s *Schedule) Stats() *payload.ScheduleStats {
+	return &payload.ScheduleStats{
+		Aligned:     s.config.Align,
+		OffsetMs:    s.offset.Milliseconds(),
+		MissedTicks: s.missed,
+		LagMs:       s.lag.Milliseconds(),
+	}
+}
+
+// after returns the first scheduled time after now.
+func (s *Schedule) after(now time.Time) time.Time {
+	if !s.config.Align {
+		return now.Add(s.config.Interval + s.offset)
+	}
+
+	next := now.Truncate(s.config.Interval).Add(s.offset)
+	for !next.After(now) {
+		next = next.Add(s.config.Interval)
+	}
+	return next
+}
+
+// wallNow returns the current time without its monotonic reading, so
+// that comparisons and durations use the wall clock.
+func wallNow() time.Time {
+	return time.Now().Round(0)
+}
@@ -0,0 +1,161 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+// at returns a fixed wall-clock time on the test day.
+func at(hour, min, sec int) time.Time {
+	return time.Date(2026, 10, 18, hour, min, sec, 0, time.UTC)
+}
+
+// fakeClock is a wall clock set by the test.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func TestAfter(t *testing.T) {
+	tests := []struct {
+		name   string
+		align  bool
+		offset time.Duration
+		now    time.Time
+		want   time.Time
+	}{
+		{name: "unaligned", now: at(12, 0, 10), want: at(12, 0, 40)},
+		{name: "unaligned with offset", offset: 5 * time.Second, now: at(12, 0, 10), want: at(12, 0, 45)},
+		{name: "aligned", align: true, now: at(12, 0, 10), want: at(12, 0, 30)},
+		{name: "aligned on a boundary", align: true, now: at(12, 0, 30), want: at(12, 1, 0)},
+		{name: "aligned with offset", align: true, offset: 5 * time.Second, now: at(12, 0, 2), want: at(12, 0, 5)},
+		{name: "aligned past the offset", align: true, offset: 5 * time.Second, now: at(12, 0, 10), want: at(12, 0, 35)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Schedule{config: Config{Interval: 30 * time.Second, Align: tt.align}, offset: tt.offset}
+
+			if got := s.after(tt.now); !got.Equal(tt.want) {
+				t.Errorf("after(%v) = %v, want %v", tt.now, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplay(t *testing.T) {
+	clock := &fakeClock{now: at(12, 0, 10)}
+	config := Config{Interval: 30 * time.Second, Align: true, Splay: 10 * time.Second}
+
+	for range 1000 {
+		s := newSchedule(config, clock.Now)
+		s.Stop()
+
+		if s.offset < 0 || s.offset >= config.Splay {
+			t.Fatalf("offset = %v, want in [0, %v)", s.offset, config.Splay)
+		}
+		if first := s.next.Sub(at(12, 0, 0)); first != 30*time.Second+s.offset && first != s.offset {
+			t.Fatalf("first tick %v after the boundary, want the offset %v", first, s.offset)
+		}
+	}
+
+	s := newSchedule(Config{Interval: 30 * time.Second}, clock.Now)
+	s.Stop()
+	if s.offset != 0 {
+		t.Errorf("offset without splay = %v, want 0", s.offset)
+	}
+}
+
+func TestTick(t *testing.T) {
+	type step struct {
+		now        time.Time
+		wantOK     bool
+		want       time.Time // scheduled time of the tick
+		wantMissed int
+		wantNext   time.Time
+	}
+
+	tests := []struct {
+		name       string
+		steps      []step
+		wantMissed uint64
+		wantLag    time.Duration
+	}{
+		{
+			name: "on time",
+			steps: []step{
+				{now: at(12, 0, 30), wantOK: true, want: at(12, 0, 30), wantNext: at(12, 1, 0)},
+				{now: at(12, 1, 0), wantOK: true, want: at(12, 1, 0), wantNext: at(12, 1, 30)},
+			},
+		},
+		{
+			name: "late within an interval",
+			steps: []step{
+				{now: at(12, 0, 45), wantOK: true, want: at(12, 0, 30), wantNext: at(12, 1, 0)},
+			},
+			wantLag: 15 * time.Second,
+		},
+		{
+			// The monotonic clock stops while suspended; the wall clock does not
+			name: "missed ticks after a suspend",
+			steps: []step{
+				{now: at(12, 2, 10), wantOK: true, want: at(12, 2, 0), wantMissed: 3, wantNext: at(12, 2, 30)},
+				{now: at(12, 2, 30), wantOK: true, want: at(12, 2, 30), wantNext: at(12, 3, 0)},
+			},
+			wantMissed: 3,
+		},
+		{
+			name: "timer fired early",
+			steps: []step{
+				{now: at(12, 0, 29), wantNext: at(12, 0, 30)},
+				{now: at(12, 0, 30), wantOK: true, want: at(12, 0, 30), wantNext: at(12, 1, 0)},
+			},
+		},
+		{
+			name: "clock stepped back less than an interval",
+			steps: []step{
+				{now: at(12, 0, 5), wantNext: at(12, 0, 30)},
+			},
+		},
+		{
+			name: "clock stepped back more than an interval",
+			steps: []step{
+				{now: at(11, 50, 0), wantNext: at(11, 50, 30)},
+				{now: at(11, 50, 30), wantOK: true, want: at(11, 50, 30), wantNext: at(11, 51, 0)},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := &fakeClock{now: at(12, 0, 10)}
+			s := newSchedule(Config{Interval: 30 * time.Second, Align: true}, clock.Now)
+			defer s.Stop()
+
+			for _, step := range tt.steps {
+				clock.now = step.now
+
+				tick, ok := s.Tick()
+				if ok != step.wantOK {
+					t.Fatalf("at %v: Tick() ok = %v, want %v", step.now, ok, step.wantOK)
+				}
+				if ok && (!tick.Scheduled.Equal(step.want) || tick.Missed != step.wantMissed) {
+					t.Errorf("at %v: Tick() = %v (missed %d), want %v (missed %d)",
+						step.now, tick.Scheduled, tick.Missed, step.want, step.wantMissed)
+				}
+				if !s.next.Equal(step.wantNext) {
+					t.Errorf("at %v: next tick %v, want %v", step.now, s.next, step.wantNext)
+				}
+			}
+
+			stats := s.Stats()
+			if stats.MissedTicks != tt.wantMissed {
+				t.Errorf("MissedTicks = %d, want %d", stats.MissedTicks, tt.wantMissed)
+			}
+			if stats.LagMs != tt.wantLag.Milliseconds() {
+				t.Errorf("LagMs = %d, want %d", stats.LagMs, tt.wantLag.Milliseconds())
+			}
+		})
+	}
+}
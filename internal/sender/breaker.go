@@ -0,0 +1,224 @@
+package sender
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"dideban-agent/internal/collector"
+	"dideban-agent/internal/payload"
+)
+
+// ErrCircuitOpen is returned by CircuitBreaker.Send while the circuit is open
+// (or while a half-open probe is already in flight).
+var ErrCircuitOpen = errors.New("sender: circuit breaker open")
+
+// BreakerState represents the state of a CircuitBreaker.
+type BreakerState int
+
+// Supported circuit breaker states.
+const (
+	// BreakerClosed lets every send through (normal operation).
+	BreakerClosed BreakerState = iota
+
+	// BreakerOpen short-circuits every send until the cool-down elapses.
+	BreakerOpen
+
+	// BreakerHalfOpen lets a single probe through to test recovery.
+	BreakerHalfOpen
+)
+
+// String returns a human-readable name of the breaker state.
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// BreakerConfig contains configuration for circuit breaker behavior.
+type BreakerConfig struct {
+	// Consecutive failed sends required to open the circuit
+	FailureThreshold int
+
+	// Time the circuit stays open before a half-open probe is allowed
+	CoolDown time.Duration
+
+	// Counters, shared with the HTTP sender and its successors so that
+	// they survive reconfiguration (nil = private counters)
+	Stats *Stats
+}
+
+// CircuitBreaker decorates a Sender with closed/open/half-open semantics.
+//
+// While closed, sends pass through and consecutive failures are counted.
+// Once FailureThreshold is reached the circuit opens and sends fail fast
+// with ErrCircuitOpen; the caller keeps the snapshot for a later attempt. After
+// CoolDown a single probe is let through; its result closes or re-opens
+// the circuit.
+type CircuitBreaker struct {
+	next   Sender
+	config BreakerConfig
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+	stats    *Stats
+}
+
+// NewCircuitBreaker wraps next with a circuit breaker.
+func NewCircuitBreaker(next Sender, config BreakerConfig) *CircuitBreaker {
+	stats := config.Stats
+	if stats == nil {
+		stats = &Stats{}
+	}
+
+	return &CircuitBreaker{
+		next:   next,
+		config: config,
+		stats:  stats,
+	}
+}
+
+// Send forwards metrics to the wrapped sender unless the circuit is open.
+func (b *CircuitBreaker) Send(ctx context.Context, metrics *collector.Metrics) error {
+	if !b.allow() {
+		return b.shortCircuit()
+	}
+
+	err := b.next.Send(ctx, metrics)
+
+	// Cancellation says nothing about the endpoint health
+	if err != nil && ctx.Err() != nil {
+		b.release()
+		return err
+	}
+
+	b.record(err)
+	return err
+}
+
+// Close closes the wrapped sender.
+func (b *CircuitBreaker) Close() error {
+	return b.next.Close()
+}
+
+// State returns the current breaker state.
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Stats returns a snapshot of the breaker state and counters.
+func (b *CircuitBreaker) Stats() *payload.BreakerStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return &payload.BreakerStats{
+		State:               b.state.String(),
+		ConsecutiveFailures: b.failures,
+		Transitions:         b.stats.transitions.Load(),
+		ShortCircuited:      b.stats.shortCircuited.Load(),
+		LastTransition:      b.stats.lastTransition.Load(),
+	}
+}
+
+// allow decides whether a send may pass through, moving an open circuit
+// to half-open once the cool-down has elapsed.
+func (b *CircuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.config.CoolDown {
+			return false
+		}
+		b.transition(BreakerHalfOpen)
+		b.probing = true
+		return true
+
+	case BreakerHalfOpen:
+		// Only a single probe may be in flight
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+
+	default:
+		return true
+	}
+}
+
+// release frees the half-open probe slot without judging the result.
+func (b *CircuitBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// record updates the breaker state with the result of a send.
+//
+// Permanent errors (e.g. 400, 401) prove that the endpoint is reachable
+// and are therefore treated as healthy responses.
+func (b *CircuitBreaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+
+	var sendErr *SendError
+	if err == nil || (errors.As(err, &sendErr) && !sendErr.Retryable()) {
+		b.failures = 0
+		if b.state != BreakerClosed {
+			b.transition(BreakerClosed)
+		}
+		return
+	}
+
+	b.failures++
+
+	if b.state == BreakerHalfOpen || b.failures >= b.config.FailureThreshold {
+		if b.state != BreakerOpen {
+			b.transition(BreakerOpen)
+		}
+		b.openedAt = time.Now()
+	}
+}
+
+// transition moves the breaker to the given state and logs it once.
+// The caller must hold b.mu.
+func (b *CircuitBreaker) transition(to BreakerState) {
+	from := b.state
+	b.state = to
+	b.stats.transitions.Add(1)
+	b.stats.lastTransition.Store(time.Now().UnixMilli())
+
+	event := log.Info()
+	if to == BreakerOpen {
+		event = log.Warn().Dur("cool_down", b.config.CoolDown)
+	}
+
+	event.
+		Str("from", from.String()).
+		Str("to", to.String()).
+		Int("consecutive_failures", b.failures).
+		Msg("⚡ Circuit breaker state changed")
+}
+
+// shortCircuit handles a send rejected by an open circuit.
+func (b *CircuitBreaker) shortCircuit() error {
+	b.stats.shortCircuited.Add(1)
+	return ErrCircuitOpen
+}
@@ -0,0 +1,133 @@
+package sender
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"dideban-agent/internal/collector"
+	"dideban-agent/internal/payload"
+)
+
+// scriptedSender answers sends with the given errors in order.
+type scriptedSender struct {
+	results []error
+}
+
+func (s *scriptedSender) Send(ctx context.Context, metrics *collector.Metrics) error {
+	if len(s.results) == 0 {
+		return nil
+	}
+	err := s.results[0]
+	s.results = s.results[1:]
+	return err
+}
+
+func (s *scriptedSender) Close() error { return nil }
+
+func TestCircuitBreaker(t *testing.T) {
+	transient := &SendError{Kind: KindTransient, StatusCode: 502}
+	permanent := &SendError{Kind: KindPermanent, StatusCode: 400}
+
+	tests := []struct {
+		name     string
+		coolDown time.Duration
+		results  []error
+		sends    int
+		want     payload.BreakerStats
+	}{
+		{
+			name:    "successes keep the circuit closed",
+			results: []error{nil, nil},
+			sends:   2,
+			want:    payload.BreakerStats{State: "closed"},
+		},
+		{
+			name:    "failures below the threshold",
+			results: []error{transient, transient},
+			sends:   2,
+			want:    payload.BreakerStats{State: "closed", ConsecutiveFailures: 2},
+		},
+		{
+			name:    "permanent errors count as healthy",
+			results: []error{transient, transient, permanent, transient},
+			sends:   4,
+			want:    payload.BreakerStats{State: "closed", ConsecutiveFailures: 1},
+		},
+		{
+			name:     "threshold opens and short-circuits",
+			coolDown: time.Hour,
+			results:  []error{transient, transient, transient},
+			sends:    5,
+			want:     payload.BreakerStats{State: "open", ConsecutiveFailures: 3, Transitions: 1, ShortCircuited: 2},
+		},
+		{
+			name:    "successful probe closes",
+			results: []error{transient, transient, transient, nil},
+			sends:   4,
+			want:    payload.BreakerStats{State: "closed", Transitions: 3},
+		},
+		{
+			name:    "failed probe re-opens",
+			results: []error{transient, transient, transient, transient},
+			sends:   4,
+			want:    payload.BreakerStats{State: "open", ConsecutiveFailures: 4, Transitions: 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewCircuitBreaker(&scriptedSender{results: tt.results}, BreakerConfig{
+				FailureThreshold: 3,
+				CoolDown:         tt.coolDown,
+			})
+
+			for range tt.sends {
+				b.Send(context.Background(), &collector.Metrics{})
+			}
+
+			got := b.Stats()
+			if (got.LastTransition != 0) != (tt.want.Transitions != 0) {
+				t.Errorf("LastTransition = %d with %d transitions", got.LastTransition, got.Transitions)
+			}
+			got.LastTransition = 0
+			if *got != tt.want {
+				t.Errorf("Stats() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerShortCircuit(t *testing.T) {
+	transient := &SendError{Kind: KindTransient, StatusCode: 502}
+	b := NewCircuitBreaker(&scriptedSender{results: []error{transient}}, BreakerConfig{
+		FailureThreshold: 1,
+		CoolDown:         time.Hour,
+	})
+
+	ctx := context.Background()
+	if err := b.Send(ctx, &collector.Metrics{}); !errors.Is(err, transient) {
+		t.Fatalf("first Send() error = %v, want %v", err, transient)
+	}
+	if err := b.Send(ctx, &collector.Metrics{}); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("second Send() error = %v, want %v", err, ErrCircuitOpen)
+	}
+}
+
+func TestCircuitBreakerSharedStats(t *testing.T) {
+	transient := &SendError{Kind: KindTransient, StatusCode: 502}
+	stats := &Stats{}
+	config := BreakerConfig{FailureThreshold: 1, CoolDown: time.Hour, Stats: stats}
+
+	// A rebuilt breaker starts closed but keeps the counters
+	first := NewCircuitBreaker(&scriptedSender{results: []error{transient}}, config)
+	first.Send(context.Background(), &collector.Metrics{})
+	first.Send(context.Background(), &collector.Metrics{})
+
+	second := NewCircuitBreaker(&scriptedSender{}, config)
+	got := second.Stats()
+	if got.State != "closed" || got.Transitions != 1 || got.ShortCircuited != 1 {
+		t.Errorf("Stats() after rebuild = %+v, want closed with 1 transition and 1 short-circuit", *got)
+	}
+}
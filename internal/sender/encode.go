@@ -0,0 +1,50 @@
+package sender
+
+import "net/http"
+
+// Encoder transforms a serialized payload before it is transmitted (e.g.
+// encrypts it) and sets the headers describing the result on h. Encoders
+// only see bytes and headers, so every HTTP-based sender can apply them
+// between serialization and transport.
+type Encoder interface {
+	Encode(h http.Header, payload []byte) ([]byte, error)
+}
+
+// EncoderFunc adapts a function to the Encoder interface.
+type EncoderFunc func(h http.Header, payload []byte) ([]byte, error)
+
+// Encode calls f(h, payload).
+func (f EncoderFunc) Encode(h http.Header, payload []byte) ([]byte, error) {
+	return f(h, payload)
+}
+
+// Encoders applies encoders in order, each to the output of the previous
+// one.
+type Encoders []Encoder
+
+// Encode applies every encoder in order.
+func (e Encoders) Encode(h http.Header, payload []byte) ([]byte, error) {
+	for _, encoder := range e {
+		var err error
+		if payload, err = encoder.Encode(h, payload); err != nil {
+			return nil, err
+		}
+	}
+	return payload, nil
+}
+
+// EncodeJSON prepares a JSON payload for transmission: it returns the
+// request headers (Content-Type) and the payload as transformed by
+// encoder, which may be nil.
+func EncodeJSON(encoder Encoder, payload []byte) (http.Header, []byte, error) {
+	h := http.Header{"Content-Type": {"application/json"}}
+	if encoder == nil {
+		return h, payload, nil
+	}
+
+	payload, err := encoder.Encode(h, payload)
+	if err != nil {
+		return nil, nil, err
+	}
+	return h, payload, nil
+}
@@ -0,0 +1,166 @@
+package sender
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"dideban-agent/internal/redact"
+)
+
+// ErrUnauthorized is matched (via errors.Is) by any SendError caused by
+// a 401 response. Callers can use it to stop sending until the token changes.
+var ErrUnauthorized = errors.New("sender: unauthorized")
+
+// ErrorKind classifies a failed send attempt.
+type ErrorKind int
+
+// Supported error kinds.
+const (
+	// KindNetwork indicates a connection-level failure (DNS, refused, reset).
+	KindNetwork ErrorKind = iota
+
+	// KindTimeout indicates the request did not complete within its timeout.
+	KindTimeout
+
+	// KindPermanent indicates a response that will not succeed on retry
+	// (4xx, or any other unexpected non-2xx status).
+	KindPermanent
+
+	// KindThrottled indicates a 429 or 503 response asking us to slow down.
+	KindThrottled
+
+	// KindTransient indicates a 5xx response that may succeed on retry.
+	KindTransient
+)
+
+// String returns a human-readable name of the error kind.
+func (k ErrorKind) String() string {
+	switch k {
+	case KindNetwork:
+		return "network"
+	case KindTimeout:
+		return "timeout"
+	case KindPermanent:
+		return "permanent"
+	case KindThrottled:
+		return "throttled"
+	case KindTransient:
+		return "transient"
+	default:
+		return "unknown"
+	}
+}
+
+// SendError describes a single failed send attempt.
+type SendError struct {
+	// Kind classifies the failure
+	Kind ErrorKind
+
+	// HTTP status code (0 if no response was received)
+	StatusCode int
+
+	// Delay requested by the server via Retry-After (0 if absent)
+	RetryAfter time.Duration
+
+	// Response body snippet (for debugging), truncated and with
+	// credentials masked (see redact.Body)
+	Body string
+
+	// Underlying error, if any
+	Err error
+}
+
+// Error implements the error interface.
+func (e *SendError) Error() string {
+	if e.StatusCode != 0 {
+		if e.Body != "" {
+			return fmt.Sprintf("server returned status %d: %s", e.StatusCode, e.Body)
+		}
+		return fmt.Sprintf("server returned status %d", e.StatusCode)
+	}
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *SendError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the error matches the given sentinel.
+func (e *SendError) Is(target error) bool {
+	return target == ErrUnauthorized && e.StatusCode == http.StatusUnauthorized
+}
+
+// Retryable reports whether the failed attempt is worth retrying.
+func (e *SendError) Retryable() bool {
+	return e.Kind != KindPermanent
+}
+
+// CheckResponse returns nil for a 2xx response and a *SendError
+// classifying any other status, so that other clients of Core (e.g. the
+// log shipper) handle 401 and Retry-After like the sender. The response
+// body is read for the error message.
+func CheckResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	// Read error response for debugging, without credentials it may echo
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	return classifyStatus(resp, redact.Body(body, 0), time.Now())
+}
+
+// classifyStatus builds a SendError for a non-2xx HTTP response.
+func classifyStatus(resp *http.Response, body string, now time.Time) *SendError {
+	sendErr := &SendError{
+		StatusCode: resp.StatusCode,
+		Body:       body,
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests,
+		resp.StatusCode == http.StatusServiceUnavailable:
+		sendErr.Kind = KindThrottled
+		sendErr.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), now)
+	case resp.StatusCode == http.StatusRequestTimeout:
+		sendErr.Kind = KindTimeout
+	case resp.StatusCode >= 500 && resp.StatusCode < 600:
+		sendErr.Kind = KindTransient
+	default:
+		// 4xx and unexpected statuses (1xx, 3xx the client did not
+		// follow) will not change on retry
+		sendErr.Kind = KindPermanent
+	}
+
+	return sendErr
+}
+
+// parseRetryAfter parses a Retry-After header value given either as
+// delay-seconds or as an HTTP date. It returns 0 if the value is absent,
+// malformed or already in the past.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds <= 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := date.Sub(now); delay > 0 {
+			return delay
+		}
+	}
+
+	return 0
+}
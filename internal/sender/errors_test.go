@@ -0,0 +1,83 @@
+package sender
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestClassifyStatus(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		status         int
+		retryAfter     string
+		wantKind       ErrorKind
+		wantRetryAfter time.Duration
+		wantUnauth     bool
+	}{
+		{status: http.StatusSwitchingProtocols, wantKind: KindPermanent},
+		{status: http.StatusMovedPermanently, wantKind: KindPermanent},
+		{status: http.StatusNotModified, wantKind: KindPermanent},
+		{status: http.StatusBadRequest, wantKind: KindPermanent},
+		{status: http.StatusUnauthorized, wantKind: KindPermanent, wantUnauth: true},
+		{status: http.StatusNotFound, wantKind: KindPermanent},
+		{status: http.StatusRequestTimeout, wantKind: KindTimeout},
+		{status: http.StatusTooManyRequests, retryAfter: "30", wantKind: KindThrottled, wantRetryAfter: 30 * time.Second},
+		{status: http.StatusInternalServerError, wantKind: KindTransient},
+		{status: http.StatusBadGateway, wantKind: KindTransient},
+		{status: http.StatusServiceUnavailable, wantKind: KindThrottled},
+		{status: 599, wantKind: KindTransient},
+		{status: 600, wantKind: KindPermanent},
+	}
+
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.status), func(t *testing.T) {
+			resp := &http.Response{StatusCode: tt.status, Header: http.Header{}}
+			if tt.retryAfter != "" {
+				resp.Header.Set("Retry-After", tt.retryAfter)
+			}
+
+			err := classifyStatus(resp, "", now)
+			if err.Kind != tt.wantKind {
+				t.Errorf("Kind = %v, want %v", err.Kind, tt.wantKind)
+			}
+			if err.RetryAfter != tt.wantRetryAfter {
+				t.Errorf("RetryAfter = %v, want %v", err.RetryAfter, tt.wantRetryAfter)
+			}
+			if got := errors.Is(err, ErrUnauthorized); got != tt.wantUnauth {
+				t.Errorf("errors.Is(ErrUnauthorized) = %v, want %v", got, tt.wantUnauth)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		value string
+		want  time.Duration
+	}{
+		{name: "absent", value: "", want: 0},
+		{name: "seconds", value: "120", want: 2 * time.Minute},
+		{name: "seconds with spaces", value: " 5 ", want: 5 * time.Second},
+		{name: "zero", value: "0", want: 0},
+		{name: "negative", value: "-3", want: 0},
+		{name: "http date", value: now.Add(90 * time.Second).Format(http.TimeFormat), want: 90 * time.Second},
+		{name: "past date", value: now.Add(-time.Minute).Format(http.TimeFormat), want: 0},
+		{name: "malformed", value: "soon", want: 0},
+		{name: "fraction", value: "1.5", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseRetryAfter(tt.value, now); got != tt.want {
+				t.Errorf("parseRetryAfter(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
@@ -5,8 +5,6 @@ import (
 	"time"
 
 	"dideban-agent/internal/collector"
-
-	"github.com/rs/zerolog/log"
 )
 
 // MockSender implements the Sender interface for development and testing.
@@ -0,0 +1,181 @@
+package sender
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+
+	"dideban-agent/internal/redact"
+)
+
+// ProxyConfig contains outbound proxy settings shared by every HTTP-based sender.
+type ProxyConfig struct {
+	// Explicit proxy URL (http://, https:// or socks5://, with optional
+	// user:password for basic/SOCKS5 authentication). Takes precedence
+	// over the environment.
+	URL string
+
+	// Fall back to HTTP_PROXY / HTTPS_PROXY / NO_PROXY when URL is empty
+	FromEnvironment bool
+
+	// Destinations that bypass the proxy (NO_PROXY syntax):
+	// "*", hosts, ".domain" suffixes, IPs and CIDRs, each with optional ":port"
+	NoProxy []string
+}
+
+// Supported proxy URL schemes.
+var proxySchemes = map[string]struct{}{
+	"http":    {},
+	"https":   {},
+	"socks5":  {},
+	"socks5h": {},
+}
+
+// proxyFunc builds the http.Transport.Proxy function for the given settings.
+// A nil function (direct connections) is returned if no proxy applies.
+func proxyFunc(cfg ProxyConfig) (func(*http.Request) (*url.URL, error), error) {
+	bypass, err := parseNoProxy(cfg.NoProxy)
+	if err != nil {
+		return nil, err
+	}
+
+	var next func(*http.Request) (*url.URL, error)
+
+	switch {
+	case cfg.URL != "":
+		proxyURL, err := parseProxyURL(cfg.URL)
+		if err != nil {
+			return nil, err
+		}
+		next = http.ProxyURL(proxyURL)
+
+	case cfg.FromEnvironment:
+		next = http.ProxyFromEnvironment
+
+	default:
+		return nil, nil
+	}
+
+	return func(req *http.Request) (*url.URL, error) {
+		if bypass.matches(req.URL) {
+			return nil, nil
+		}
+		return next(req)
+	}, nil
+}
+
+// parseProxyURL parses and validates a proxy URL.
+func parseProxyURL(raw string) (*url.URL, error) {
+	proxyURL, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %w", redact.Error(err))
+	}
+
+	if _, ok := proxySchemes[proxyURL.Scheme]; !ok {
+		return nil, fmt.Errorf("unsupported proxy scheme %q (valid: http, https, socks5, socks5h)", proxyURL.Scheme)
+	}
+
+	if proxyURL.Host == "" {
+		return nil, fmt.Errorf("proxy URL %q has no host", proxyURL.Redacted())
+	}
+
+	return proxyURL, nil
+}
+
+// noProxyRule is a single parsed NO_PROXY entry.
+type noProxyRule struct {
+	all    bool
+	prefix netip.Prefix
+	domain string // lower-case, without leading dot
+	exact  bool   // true if the entry had no leading dot and must also match the host itself
+	port   string
+}
+
+// noProxyList is a set of destinations that bypass the proxy.
+type noProxyList []noProxyRule
+
+// parseNoProxy parses NO_PROXY-style entries.
+func parseNoProxy(entries []string) (noProxyList, error) {
+	var list noProxyList
+
+	for _, entry := range entries {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+
+		if entry == "*" {
+			list = append(list, noProxyRule{all: true})
+			continue
+		}
+
+		// CIDR ranges never carry a port
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			list = append(list, noProxyRule{prefix: prefix.Masked()})
+			continue
+		}
+
+		rule := noProxyRule{}
+		host := entry
+		if h, port, err := net.SplitHostPort(entry); err == nil {
+			host, rule.port = h, port
+		}
+
+		if addr, err := netip.ParseAddr(strings.Trim(host, "[]")); err == nil {
+			rule.prefix = netip.PrefixFrom(addr, addr.BitLen())
+			list = append(list, rule)
+			continue
+		}
+
+		rule.exact = !strings.HasPrefix(host, ".")
+		rule.domain = strings.TrimPrefix(strings.TrimPrefix(host, "*"), ".")
+		if rule.domain == "" {
+			return nil, fmt.Errorf("invalid no_proxy entry %q", entry)
+		}
+
+		list = append(list, rule)
+	}
+
+	return list, nil
+}
+
+// matches reports whether the destination URL bypasses the proxy.
+func (l noProxyList) matches(target *url.URL) bool {
+	host := strings.ToLower(target.Hostname())
+	port := target.Port()
+	if port == "" {
+		port = map[string]string{"http": "80", "https": "443"}[target.Scheme]
+	}
+
+	addr, addrErr := netip.ParseAddr(host)
+
+	for _, rule := range l {
+		if rule.all {
+			return true
+		}
+
+		if rule.port != "" && rule.port != port {
+			continue
+		}
+
+		if rule.prefix.IsValid() {
+			if addrErr == nil && rule.prefix.Contains(addr.Unmap()) {
+				return true
+			}
+			continue
+		}
+
+		if rule.exact && host == rule.domain {
+			return true
+		}
+
+		if strings.HasSuffix(host, "."+rule.domain) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -3,17 +3,26 @@ package sender
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math/rand/v2"
+	"net"
 	"net/http"
 	"time"
 
 	"dideban-agent/internal/collector"
-
-	"github.com/rs/zerolog/log"
+	"dideban-agent/internal/logger"
+	"dideban-agent/internal/payload"
+	"dideban-agent/internal/version"
+	"dideban-agent/pkg/signature"
 )
 
+// log is the logger of the sender component.
+var log = logger.New("sender")
+
 // Sender defines the interface for sending metrics to remote endpoints.
 // Implementations must handle retries, timeouts, and error recovery gracefully.
 type Sender interface {
@@ -35,13 +44,17 @@ type Sender interface {
 type HTTPSender struct {
 	client   *http.Client
 	endpoint string
-	token    string
+	tokens   TokenSource
 	config   HTTPConfig
+	stats    *Stats
 }
 
 // HTTPConfig contains configuration parameters for HTTP sender behavior.
 type HTTPConfig struct {
-	// Maximum number of retry attempts for failed requests
+	// Maximum number of retry attempts for failed requests within one
+	// Send. Behind the queue, a Send is one delivery attempt: the queue
+	// retries the snapshot with its own backoff once Send gave up, so a
+	// snapshot may take several rounds of MaxRetries+1 requests
 	MaxRetries int
 
 	// Initial retry delay (doubled on each retry)
@@ -55,27 +68,67 @@ type HTTPConfig struct {
 
 	// HTTP client timeout (includes connection establishment)
 	ClientTimeout time.Duration
+
+	// TLS settings (CA bundle, client certificate, pinning)
+	TLS TLSConfig
+
+	// Outbound proxy settings
+	Proxy ProxyConfig
+
+	// Optional handler receiving the body of successful responses
+	// (e.g. to pick up configuration delivered by Core)
+	ResponseHandler func(body []byte)
+
+	// Optional counters shared with previous senders (a new set is
+	// created if nil)
+	Stats *Stats
+
+	// Optional signer; every attempt is signed with a fresh timestamp
+	// and nonce
+	Signer *signature.Signer
+
+	// Optional encoder applied to the serialized payload once per send
+	// (e.g. encryption); signatures cover the encoded payload
+	Encoder Encoder
 }
 
+// maxResponseSize limits how much of a response body is read.
+const maxResponseSize = 1 << 20
+
 // NewHTTPSender creates a new HTTP sender with the specified configuration.
 // The sender is ready for immediate use and includes connection pooling.
-func NewHTTPSender(endpoint, token string, config HTTPConfig) *HTTPSender {
+//
+// An error is returned if the TLS or proxy configuration is invalid or
+// the referenced certificate files cannot be loaded.
+func NewHTTPSender(endpoint string, tokens TokenSource, config HTTPConfig) (*HTTPSender, error) {
+	transport, err := NewTransport(endpoint, config.TLS, config.Proxy)
+	if err != nil {
+		return nil, err
+	}
+
 	// Configure HTTP client with connection pooling and timeouts
 	client := &http.Client{
-		Timeout: config.ClientTimeout,
-		Transport: &http.Transport{
-			MaxIdleConns:        10,
-			MaxIdleConnsPerHost: 2,
-			IdleConnTimeout:     60 * time.Second,
-		},
+		Timeout:   config.ClientTimeout,
+		Transport: transport,
+	}
+
+	stats := config.Stats
+	if stats == nil {
+		stats = &Stats{}
 	}
 
 	return &HTTPSender{
 		client:   client,
 		endpoint: endpoint,
-		token:    token,
+		tokens:   tokens,
 		config:   config,
-	}
+		stats:    stats,
+	}, nil
+}
+
+// Stats returns the sender counters.
+func (s *HTTPSender) Stats() *payload.SenderStats {
+	return s.stats.Snapshot()
 }
 
 // Send transmits metrics to the configured endpoint with retry logic.
@@ -87,14 +140,24 @@ func (s *HTTPSender) Send(ctx context.Context, metrics *collector.Metrics) error
 		return fmt.Errorf("failed to marshal metrics: %w", err)
 	}
 
+	header, payload, err := EncodeJSON(s.config.Encoder, payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode metrics: %w", err)
+	}
+
 	// Execute request with retry logic
-	return s.sendWithRetry(ctx, payload)
+	return s.sendWithRetry(ctx, header, payload)
 }
 
 // sendWithRetry implements the core retry logic with exponential backoff.
-func (s *HTTPSender) sendWithRetry(ctx context.Context, payload []byte) error {
+//
+// Failed attempts are classified (see SendError): permanent failures are
+// returned immediately, throttled responses honor Retry-After, and all
+// other failures are retried with full-jitter exponential backoff.
+func (s *HTTPSender) sendWithRetry(ctx context.Context, header http.Header, payload []byte) error {
 	var lastErr error
-	retryDelay := s.config.InitialRetryDelay
+	backoff := s.config.InitialRetryDelay
+	tokenReloaded := false
 
 	for attempt := 0; attempt <= s.config.MaxRetries; attempt++ {
 		// Check for context cancellation before each attempt
@@ -105,8 +168,15 @@ func (s *HTTPSender) sendWithRetry(ctx context.Context, payload []byte) error {
 		}
 
 		// Execute HTTP request
-		err := s.executeRequest(ctx, payload)
+		s.stats.attempts.Add(1)
+		if attempt > 0 {
+			s.stats.retries.Add(1)
+		}
+
+		err := s.executeRequest(ctx, header, payload)
 		if err == nil {
+			s.stats.bytesSent.Add(uint64(len(payload)))
+
 			// Success - log and return
 			if attempt > 0 {
 				log.Info().
@@ -118,8 +188,29 @@ func (s *HTTPSender) sendWithRetry(ctx context.Context, payload []byte) error {
 
 		lastErr = err
 
+		// Do not retry requests that will never succeed
+		var sendErr *SendError
+		if errors.As(err, &sendErr) && !sendErr.Retryable() {
+			// The token may have been rotated since it was last read;
+			// re-read it once and retry immediately without using up an attempt
+			if errors.Is(err, ErrUnauthorized) && !tokenReloaded && s.reloadToken(ctx) {
+				tokenReloaded = true
+				attempt--
+				continue
+			}
+
+			s.stats.failures.Add(1)
+			log.Error().
+				Err(err).
+				Int("status_code", sendErr.StatusCode).
+				Msg("❌ Request rejected by server, not retrying")
+			return err
+		}
+
 		// Log retry attempt (except for the last failed attempt)
 		if attempt < s.config.MaxRetries {
+			retryDelay := s.retryDelay(backoff, sendErr)
+
 			log.Warn().
 				Err(err).
 				Int("attempt", attempt+1).
@@ -135,14 +226,15 @@ func (s *HTTPSender) sendWithRetry(ctx context.Context, payload []byte) error {
 			}
 
 			// Exponential backoff with maximum cap
-			retryDelay *= 2
-			if retryDelay > s.config.MaxRetryDelay {
-				retryDelay = s.config.MaxRetryDelay
+			backoff *= 2
+			if backoff > s.config.MaxRetryDelay {
+				backoff = s.config.MaxRetryDelay
 			}
 		}
 	}
 
 	// All retries exhausted
+	s.stats.failures.Add(1)
 	log.Error().
 		Err(lastErr).
 		Int("max_retries", s.config.MaxRetries).
@@ -151,8 +243,42 @@ func (s *HTTPSender) sendWithRetry(ctx context.Context, payload []byte) error {
 	return fmt.Errorf("failed to send metrics after %d retries: %w", s.config.MaxRetries, lastErr)
 }
 
-// executeRequest performs a single HTTP request attempt.
-func (s *HTTPSender) executeRequest(ctx context.Context, payload []byte) error {
+// reloadToken re-reads the token after a 401 and reports whether it changed.
+func (s *HTTPSender) reloadToken(ctx context.Context) bool {
+	changed, err := s.tokens.Reload(ctx)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to reload token after 401")
+		return false
+	}
+
+	if changed {
+		// Pooled connections may carry a stale client certificate
+		s.client.CloseIdleConnections()
+		log.Info().Msg("🔑 Token changed after 401, retrying")
+	}
+	return changed
+}
+
+// retryDelay computes how long to wait before the next attempt.
+//
+// A server-provided Retry-After takes precedence (capped by MaxRetryDelay);
+// otherwise a random delay in [0, backoff) is used ("full jitter") so that
+// a fleet of agents does not retry in lockstep.
+func (s *HTTPSender) retryDelay(backoff time.Duration, sendErr *SendError) time.Duration {
+	if sendErr != nil && sendErr.RetryAfter > 0 {
+		return min(sendErr.RetryAfter, s.config.MaxRetryDelay)
+	}
+
+	if backoff <= 0 {
+		return 0
+	}
+	return rand.N(backoff)
+}
+
+// executeRequest performs a single HTTP request attempt with the given
+// payload headers. Any failure is returned as a *SendError describing
+// its kind.
+func (s *HTTPSender) executeRequest(ctx context.Context, header http.Header, payload []byte) error {
 	// Create request with timeout context
 	reqCtx, cancel := context.WithTimeout(ctx, s.config.RequestTimeout)
 	defer cancel()
@@ -161,20 +287,38 @@ func (s *HTTPSender) executeRequest(ctx context.Context, payload []byte) error {
 
 	req, err := http.NewRequestWithContext(reqCtx, "POST", s.endpoint, bytes.NewReader(payload))
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return &SendError{Kind: KindPermanent, Err: fmt.Errorf("failed to create request: %w", err)}
+	}
+
+	// Read the token per request so rotations apply immediately
+	token, err := s.tokens.Token()
+	if err != nil {
+		return &SendError{Kind: KindPermanent, Err: fmt.Errorf("failed to get token: %w", err)}
+	}
+
+	// Set required headers (certificate-only credentials carry no token)
+	req.Header = header.Clone()
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
 	}
+	req.Header.Set("User-Agent", version.UserAgent())
 
-	// Set required headers
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+s.token)
-	req.Header.Set("User-Agent", "dideban-agent/0.1.0")
+	if s.config.Signer != nil {
+		if err := s.config.Signer.Sign(req.Header, payload); err != nil {
+			return &SendError{Kind: KindPermanent, Err: err}
+		}
+	}
 
 	log.Debug().Msg("Executing HTTP request")
 
 	// Execute request
 	resp, err := s.client.Do(req)
 	if err != nil {
-		return fmt.Errorf("request failed: %w", err)
+		// Parent cancellation is not a send failure; surface it as-is
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return classifyTransportError(err)
 	}
 	defer resp.Body.Close()
 
@@ -182,14 +326,38 @@ func (s *HTTPSender) executeRequest(ctx context.Context, payload []byte) error {
 
 	// Check response status
 	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-		// Success - drain response body to enable connection reuse
-		_, _ = io.Copy(io.Discard, resp.Body)
+		if s.config.ResponseHandler == nil {
+			// Success - drain response body to enable connection reuse
+			_, _ = io.Copy(io.Discard, resp.Body)
+			return nil
+		}
+
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+		if err != nil {
+			log.Debug().Err(err).Msg("Failed to read response body")
+			return nil
+		}
+
+		s.config.ResponseHandler(body)
 		return nil
 	}
 
-	// Read error response for debugging
-	body, _ := io.ReadAll(resp.Body)
-	return fmt.Errorf("server returned status %d: %s", resp.StatusCode, string(body))
+	return CheckResponse(resp)
+}
+
+// classifyTransportError wraps an error returned by http.Client.Do.
+// Certificate verification failures are permanent: retrying cannot fix them.
+func classifyTransportError(err error) *SendError {
+	var certErr *tls.CertificateVerificationError
+	if errors.As(err, &certErr) {
+		return &SendError{Kind: KindPermanent, Err: fmt.Errorf("TLS verification failed: %w", err)}
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return &SendError{Kind: KindTimeout, Err: fmt.Errorf("request timed out: %w", err)}
+	}
+	return &SendError{Kind: KindNetwork, Err: fmt.Errorf("request failed: %w", err)}
 }
 
 // Close releases resources held by the HTTP sender.
@@ -0,0 +1,32 @@
+package sender
+
+import (
+	"sync/atomic"
+
+	"dideban-agent/internal/payload"
+)
+
+// Stats accumulates HTTP sender counters. It is safe for concurrent use
+// and may be shared by successive senders (see HTTPConfig.Stats), so the
+// counters survive reconfiguration.
+type Stats struct {
+	attempts  atomic.Uint64
+	failures  atomic.Uint64
+	retries   atomic.Uint64
+	bytesSent atomic.Uint64
+
+	// Circuit breaker counters (see BreakerConfig.Stats)
+	transitions    atomic.Uint64
+	shortCircuited atomic.Uint64
+	lastTransition atomic.Int64 // Unix milliseconds
+}
+
+// Snapshot returns the current counters.
+func (s *Stats) Snapshot() *payload.SenderStats {
+	return &payload.SenderStats{
+		Attempts:  s.attempts.Load(),
+		Failures:  s.failures.Load(),
+		Retries:   s.retries.Load(),
+		BytesSent: s.bytesSent.Load(),
+	}
+}
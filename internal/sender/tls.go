@@ -0,0 +1,279 @@
+package sender
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sync"
+)
+
+// TLSConfig contains TLS settings for connections to the Core endpoint.
+// The zero value uses the system trust store and Go's default TLS settings.
+type TLSConfig struct {
+	// PEM bundle of CA certificates trusted instead of the system store
+	CAFile string
+
+	// PEM client certificate and key for mutual TLS
+	CertFile string
+	KeyFile  string
+
+	// Minimum accepted TLS version ("1.2" or "1.3", default "1.2")
+	MinVersion string
+
+	// Server name used for SNI and certificate verification
+	ServerName string
+
+	// Base64-encoded SHA-256 hashes of accepted SubjectPublicKeyInfo.
+	// If set, at least one certificate in the verified chain must match.
+	PinnedSPKI []string
+}
+
+// tlsVersions maps supported configuration values to TLS versions.
+var tlsVersions = map[string]uint16{
+	"":    tls.VersionTLS12,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// tlsReloader provides a tls.Config whose CA bundle and client certificate
+// are re-read from disk whenever the underlying files change, so rotated
+// certificates are picked up without a restart.
+//
+// Files are checked on every handshake. Because connections are pooled,
+// handshakes (and therefore file checks) are rare.
+type tlsReloader struct {
+	pins       [][]byte
+	serverName string // name the server certificate is verified against
+
+	mu       sync.Mutex
+	caFile   *watchedFile
+	certFile *watchedFile
+	keyFile  *watchedFile
+	roots    *x509.CertPool
+	cert     *tls.Certificate
+}
+
+// newTLSClientConfig builds a client tls.Config for connections to
+// endpoint from the given settings. Certificate files are loaded eagerly
+// so that misconfiguration fails fast.
+//
+// With a CA bundle, the server certificate is verified against the
+// configured server name or, if unset, the endpoint host (an IP literal
+// must then appear in the certificate's IP SANs).
+func newTLSClientConfig(endpoint string, cfg TLSConfig) (*tls.Config, error) {
+	minVersion, ok := tlsVersions[cfg.MinVersion]
+	if !ok {
+		return nil, fmt.Errorf("unsupported TLS version: %s", cfg.MinVersion)
+	}
+
+	if (cfg.CertFile == "") != (cfg.KeyFile == "") {
+		return nil, errors.New("TLS client certificate and key must be set together")
+	}
+
+	r := &tlsReloader{serverName: cfg.ServerName}
+
+	if r.serverName == "" && endpoint != "" {
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("invalid endpoint: %w", err)
+		}
+		r.serverName = u.Hostname()
+	}
+
+	for _, pin := range cfg.PinnedSPKI {
+		hash, err := base64.StdEncoding.DecodeString(pin)
+		if err != nil || len(hash) != sha256.Size {
+			return nil, fmt.Errorf("invalid SPKI pin %q: expected base64 SHA-256 hash", pin)
+		}
+		r.pins = append(r.pins, hash)
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion: minVersion,
+		ServerName: cfg.ServerName,
+	}
+
+	if cfg.CertFile != "" {
+		r.certFile = newWatchedFile(cfg.CertFile)
+		r.keyFile = newWatchedFile(cfg.KeyFile)
+		if _, err := r.clientCertificate(nil); err != nil {
+			return nil, err
+		}
+		tlsConfig.GetClientCertificate = r.clientCertificate
+	}
+
+	if cfg.CAFile != "" {
+		r.caFile = newWatchedFile(cfg.CAFile)
+		if _, err := r.rootPool(); err != nil {
+			return nil, err
+		}
+
+		// The built-in verification cannot use a pool that changes at
+		// runtime, so it is disabled and performed in verifyConnection.
+		tlsConfig.InsecureSkipVerify = true
+	}
+
+	if r.caFile != nil || len(r.pins) > 0 {
+		tlsConfig.VerifyConnection = r.verifyConnection
+	}
+
+	return tlsConfig, nil
+}
+
+// clientCertificate returns the current client certificate, reloading it
+// if the certificate or key file changed. On reload failure the previous
+// certificate is kept.
+func (r *tlsReloader) clientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	certChanged, certErr := r.certFile.changed()
+	keyChanged, keyErr := r.keyFile.changed()
+
+	if err := errors.Join(certErr, keyErr); err != nil {
+		return r.keepCertificate(fmt.Errorf("failed to stat client certificate: %w", err))
+	}
+
+	if !certChanged && !keyChanged {
+		return r.cert, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile.path, r.keyFile.path)
+	if err != nil {
+		r.certFile.reset()
+		r.keyFile.reset()
+		return r.keepCertificate(fmt.Errorf("failed to load client certificate: %w", err))
+	}
+
+	if r.cert != nil {
+		log.Info().Str("cert_file", r.certFile.path).Msg("🔑 Client certificate reloaded")
+	}
+
+	r.cert = &cert
+	return r.cert, nil
+}
+
+// keepCertificate returns the previously loaded certificate (if any)
+// after logging err, or err itself if nothing was loaded yet.
+// The caller must hold r.mu.
+func (r *tlsReloader) keepCertificate(err error) (*tls.Certificate, error) {
+	if r.cert == nil {
+		return nil, err
+	}
+	log.Warn().Err(err).Msg("Keeping previous client certificate")
+	return r.cert, nil
+}
+
+// rootPool returns the current CA pool, reloading it if the CA file changed.
+// On reload failure the previous pool is kept.
+func (r *tlsReloader) rootPool() (*x509.CertPool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	changed, err := r.caFile.changed()
+	if err == nil && !changed {
+		return r.roots, nil
+	}
+
+	var pool *x509.CertPool
+	if err == nil {
+		pool, err = loadCertPool(r.caFile.path)
+	}
+
+	if err != nil {
+		r.caFile.reset()
+		if r.roots == nil {
+			return nil, err
+		}
+		log.Warn().Err(err).Msg("Keeping previous CA bundle")
+		return r.roots, nil
+	}
+
+	if r.roots != nil {
+		log.Info().Str("ca_file", r.caFile.path).Msg("🔑 CA bundle reloaded")
+	}
+
+	r.roots = pool
+	return r.roots, nil
+}
+
+// verifyConnection verifies the server certificate chain against the
+// configured CA bundle (if any) and checks SPKI pins (if any).
+func (r *tlsReloader) verifyConnection(cs tls.ConnectionState) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("tls: server presented no certificates")
+	}
+
+	chains := cs.VerifiedChains
+
+	if r.caFile != nil {
+		roots, err := r.rootPool()
+		if err != nil {
+			return err
+		}
+
+		intermediates := x509.NewCertPool()
+		for _, cert := range cs.PeerCertificates[1:] {
+			intermediates.AddCert(cert)
+		}
+
+		chains, err = cs.PeerCertificates[0].Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+			DNSName:       r.verifyName(cs),
+		})
+		if err != nil {
+			return &tls.CertificateVerificationError{UnverifiedCertificates: cs.PeerCertificates, Err: err}
+		}
+	}
+
+	if len(r.pins) == 0 {
+		return nil
+	}
+
+	for _, chain := range chains {
+		for _, cert := range chain {
+			hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+			for _, pin := range r.pins {
+				if bytes.Equal(hash[:], pin) {
+					return nil
+				}
+			}
+		}
+	}
+
+	return &tls.CertificateVerificationError{
+		UnverifiedCertificates: cs.PeerCertificates,
+		Err:                    errors.New("server certificate does not match any pinned public key"),
+	}
+}
+
+// verifyName returns the name the server certificate must be valid for.
+// Without a known endpoint it falls back to the SNI value sent.
+func (r *tlsReloader) verifyName(cs tls.ConnectionState) string {
+	if r.serverName != "" {
+		return r.serverName
+	}
+	return cs.ServerName
+}
+
+// loadCertPool reads a PEM bundle into a new certificate pool.
+func loadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no valid certificates found in CA bundle %s", path)
+	}
+
+	return pool, nil
+}
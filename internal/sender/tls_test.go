@@ -0,0 +1,131 @@
+package sender
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTransportVerifiesServer(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	// The test certificate is self-signed and valid for 127.0.0.1 and example.com
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(caFile, caPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	spki := sha256.Sum256(srv.Certificate().RawSubjectPublicKeyInfo)
+	pin := base64.StdEncoding.EncodeToString(spki[:])
+	otherPin := base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))
+
+	localhost := strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)
+	otherIP := strings.Replace(srv.URL, "127.0.0.1", "127.0.0.2", 1)
+
+	tests := []struct {
+		name     string
+		endpoint string
+		tls      TLSConfig
+		wantErr  bool
+	}{
+		{
+			name:     "system roots reject unknown CA",
+			endpoint: srv.URL,
+			wantErr:  true,
+		},
+		{
+			name:     "CA bundle with IP endpoint",
+			endpoint: srv.URL,
+			tls:      TLSConfig{CAFile: caFile},
+		},
+		{
+			name:     "CA bundle with IP not in certificate",
+			endpoint: otherIP,
+			tls:      TLSConfig{CAFile: caFile},
+			wantErr:  true,
+		},
+		{
+			name:     "CA bundle with host not in certificate",
+			endpoint: localhost,
+			tls:      TLSConfig{CAFile: caFile},
+			wantErr:  true,
+		},
+		{
+			name:     "CA bundle with configured server name",
+			endpoint: srv.URL,
+			tls:      TLSConfig{CAFile: caFile, ServerName: "example.com"},
+		},
+		{
+			name:     "CA bundle with wrong server name",
+			endpoint: srv.URL,
+			tls:      TLSConfig{CAFile: caFile, ServerName: "wrong.example"},
+			wantErr:  true,
+		},
+		{
+			name:     "matching pin",
+			endpoint: srv.URL,
+			tls:      TLSConfig{CAFile: caFile, PinnedSPKI: []string{otherPin, pin}},
+		},
+		{
+			name:     "no matching pin",
+			endpoint: srv.URL,
+			tls:      TLSConfig{CAFile: caFile, PinnedSPKI: []string{otherPin}},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport, err := NewTransport(tt.endpoint, tt.tls, ProxyConfig{})
+			if err != nil {
+				t.Fatalf("NewTransport() error = %v", err)
+			}
+			defer transport.CloseIdleConnections()
+
+			// Connect to the test server whatever the endpoint host
+			transport.DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, srv.Listener.Addr().String())
+			}
+			client := &http.Client{Transport: transport}
+
+			resp, err := client.Get(tt.endpoint)
+			if err == nil {
+				resp.Body.Close()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Get() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewTLSClientConfigInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		tls  TLSConfig
+	}{
+		{name: "unsupported version", tls: TLSConfig{MinVersion: "1.1"}},
+		{name: "certificate without key", tls: TLSConfig{CertFile: "cert.pem"}},
+		{name: "malformed pin", tls: TLSConfig{PinnedSPKI: []string{"not-a-hash"}}},
+		{name: "missing CA bundle", tls: TLSConfig{CAFile: filepath.Join(t.TempDir(), "missing.pem")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newTLSClientConfig("https://core.example", tt.tls); err == nil {
+				t.Error("newTLSClientConfig() succeeded, want error")
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package sender
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// TokenSource provides the bearer token used to authenticate against Core.
+// Implementations must be safe for concurrent use.
+type TokenSource interface {
+	// Token returns the current token.
+	Token() (string, error)
+
+	// Reload forces the token to be re-read and reports whether it changed.
+	// It is called after Core rejected the token; ctx bounds any request
+	// made to obtain a new one.
+	Reload(ctx context.Context) (bool, error)
+}
+
+// StaticToken is a TokenSource that always returns the same token.
+type StaticToken string
+
+// Token returns the static token.
+func (t StaticToken) Token() (string, error) {
+	return string(t), nil
+}
+
+// Reload is a no-op; a static token never changes.
+func (t StaticToken) Reload(ctx context.Context) (bool, error) {
+	return false, nil
+}
+
+// FileTokenSource reads the token from a file and re-reads it whenever the
+// file changes, so Vault Agent or Kubernetes secret projections can rotate
+// it without a restart. The new token is used atomically by the next request.
+type FileTokenSource struct {
+	mu      sync.Mutex
+	file    *watchedFile
+	token   string
+	failing bool // the file could not be read since the last token was loaded
+}
+
+// NewFileTokenSource creates a token source backed by the given file.
+// The file is read immediately so that a missing or empty file fails fast.
+func NewFileTokenSource(path string) (*FileTokenSource, error) {
+	s := &FileTokenSource{file: newWatchedFile(path)}
+
+	if _, err := s.Reload(context.Background()); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Token returns the current token, re-reading the file if it changed.
+// If the file cannot be read, the previous token is kept; this is logged
+// once until the file can be read again.
+func (s *FileTokenSource) Token() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	changed, err := s.file.changed()
+	if err != nil || changed {
+		if _, err := s.load(); err != nil {
+			if !s.failing {
+				log.Warn().Err(err).Str("path", s.file.path).Msg("Keeping previous token")
+			}
+			s.failing = true
+		}
+	}
+
+	return s.token, nil
+}
+
+// Reload re-reads the token file unconditionally.
+func (s *FileTokenSource) Reload(ctx context.Context) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Record the current file state so Token does not read it again
+	_, _ = s.file.changed()
+
+	return s.load()
+}
+
+// load reads the token file and reports whether the token changed.
+// The caller must hold s.mu.
+func (s *FileTokenSource) load() (bool, error) {
+	data, err := os.ReadFile(s.file.path)
+	if err != nil {
+		s.file.reset()
+		return false, fmt.Errorf("failed to read token file: %w", err)
+	}
+
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		s.file.reset()
+		return false, errors.New("token file is empty")
+	}
+
+	if s.failing {
+		log.Info().Str("path", s.file.path).Msg("Token file readable again")
+		s.failing = false
+	}
+
+	if token == s.token {
+		return false, nil
+	}
+
+	if s.token != "" {
+		log.Info().Str("path", s.file.path).Msg("🔑 Token rotated")
+	}
+
+	s.token = token
+	return true, nil
+}
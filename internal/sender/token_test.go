@@ -0,0 +1,125 @@
+package sender
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeToken writes the token file with a distinct modification time, so
+// that the change is detected regardless of the file system's resolution.
+func writeToken(t *testing.T, path, token string, modTime time.Time) {
+	t.Helper()
+
+	if err := os.WriteFile(path, []byte(token), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewFileTokenSource(t *testing.T) {
+	tests := []struct {
+		name    string
+		content *string
+		want    string
+		wantErr bool
+	}{
+		{name: "token", content: ptr("secret\n"), want: "secret"},
+		{name: "empty", content: ptr(" \n"), wantErr: true},
+		{name: "missing", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "token")
+			if tt.content != nil {
+				writeToken(t, path, *tt.content, time.Now())
+			}
+
+			s, err := NewFileTokenSource(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewFileTokenSource() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if token, _ := s.Token(); token != tt.want {
+				t.Errorf("Token() = %q, want %q", token, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileTokenSourceRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	start := time.Now().Add(-time.Hour)
+	writeToken(t, path, "first", start)
+
+	s, err := NewFileTokenSource(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A changed file is picked up by the next request
+	writeToken(t, path, "second", start.Add(time.Minute))
+	if token, _ := s.Token(); token != "second" {
+		t.Fatalf("Token() after rotation = %q, want %q", token, "second")
+	}
+
+	// While the file is unreadable, the previous token is kept
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	for range 3 {
+		if token, _ := s.Token(); token != "second" {
+			t.Fatalf("Token() without file = %q, want the previous token", token)
+		}
+	}
+	if !s.failing {
+		t.Error("missing token file not recorded as failing")
+	}
+
+	writeToken(t, path, "third", start.Add(2*time.Minute))
+	if token, _ := s.Token(); token != "third" {
+		t.Fatalf("Token() after recovery = %q, want %q", token, "third")
+	}
+	if s.failing {
+		t.Error("token file still recorded as failing after recovery")
+	}
+}
+
+func TestFileTokenSourceReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	writeToken(t, path, "first", time.Now())
+
+	s, err := NewFileTokenSource(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if changed, err := s.Reload(context.Background()); changed || err != nil {
+		t.Errorf("Reload() of an unchanged file = %v, %v, want false", changed, err)
+	}
+
+	// Reload reads the file even if its modification time is unchanged
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeToken(t, path, "other", info.ModTime())
+
+	if changed, err := s.Reload(context.Background()); !changed || err != nil {
+		t.Errorf("Reload() = %v, %v, want true", changed, err)
+	}
+	if token, _ := s.Token(); token != "other" {
+		t.Errorf("Token() after Reload() = %q, want %q", token, "other")
+	}
+}
+
+func ptr(s string) *string {
+	return &s
+}
@@ -0,0 +1,32 @@
+package sender
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// NewTransport creates the http.Transport used by HTTP-based senders for
+// requests to endpoint, applying TLS and proxy settings uniformly with
+// connection pooling. The endpoint host is used to verify the server
+// certificate if tlsCfg has a CA bundle but no server name; it may be
+// empty if no CA bundle is set.
+func NewTransport(endpoint string, tlsCfg TLSConfig, proxyCfg ProxyConfig) (*http.Transport, error) {
+	tlsConfig, err := newTLSClientConfig(endpoint, tlsCfg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TLS configuration: %w", err)
+	}
+
+	proxy, err := proxyFunc(proxyCfg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy configuration: %w", err)
+	}
+
+	return &http.Transport{
+		Proxy:               proxy,
+		TLSClientConfig:     tlsConfig,
+		MaxIdleConns:        10,
+		MaxIdleConnsPerHost: 2,
+		IdleConnTimeout:     60 * time.Second,
+	}, nil
+}
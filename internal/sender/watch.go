@@ -0,0 +1,47 @@
+package sender
+
+import (
+	"os"
+	"time"
+)
+
+// watchedFile tracks a file on disk and reports when its content may have
+// changed (based on modification time and size).
+//
+// os.Stat follows symlinks, so atomic symlink swaps used by Kubernetes
+// secret projections and Vault Agent are detected as well.
+type watchedFile struct {
+	path    string
+	modTime time.Time
+	size    int64
+}
+
+// newWatchedFile creates a watcher for the given path.
+// The first call to changed always reports true.
+func newWatchedFile(path string) *watchedFile {
+	return &watchedFile{path: path, size: -1}
+}
+
+// changed reports whether the file differs from the last observed state
+// and records the new state.
+func (f *watchedFile) changed() (bool, error) {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return false, err
+	}
+
+	if info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return false, nil
+	}
+
+	f.modTime = info.ModTime()
+	f.size = info.Size()
+	return true, nil
+}
+
+// reset forgets the last observed state so the next call to changed
+// reports true again (e.g. after a failed reload).
+func (f *watchedFile) reset() {
+	f.modTime = time.Time{}
+	f.size = -1
+}
@@ -0,0 +1,28 @@
+//go:build unix
+
+package state
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// checkOwner checks the owner and mode of the state directory.
+func checkOwner(path string, info os.FileInfo) error {
+	if perm := info.Mode().Perm(); perm&0o077 != 0 {
+		return fmt.Errorf("state: %s must not be accessible by group or others (mode %04o)", path, perm)
+	}
+
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+
+	euid := os.Geteuid()
+	if euid != 0 && int(stat.Uid) != euid {
+		return fmt.Errorf("state: %s is owned by uid %d, not by the agent's user (uid %d)", path, stat.Uid, euid)
+	}
+
+	return nil
+}
@@ -0,0 +1,112 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Dir is the agent state directory.
+//
+// It holds data that must survive restarts (credentials, keys, last known
+// remote configuration, spooled metrics). The directory is created with
+// 0700 permissions and every file is written atomically with 0600.
+type Dir string
+
+// Ensure creates the state directory if it does not exist and checks that
+// an existing one is safe to keep credentials in: a real directory (not a
+// symbolic link) owned by the current user and not accessible by group or
+// others. Root also accepts a directory owned by another user, which is
+// the case after privileges were dropped to that user.
+func (d Dir) Ensure() error {
+	if d == "" {
+		return errors.New("state: directory is not configured")
+	}
+
+	if err := os.MkdirAll(string(d), 0o700); err != nil {
+		return fmt.Errorf("state: failed to create directory: %w", err)
+	}
+
+	info, err := os.Lstat(string(d))
+	if err != nil {
+		return fmt.Errorf("state: failed to stat directory: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("state: %s is not a directory", d)
+	}
+
+	return checkOwner(string(d), info)
+}
+
+// Path returns the absolute path of a file inside the state directory.
+func (d Dir) Path(name string) string {
+	return filepath.Join(string(d), name)
+}
+
+// ReadFile reads a file from the state directory.
+// The returned error satisfies errors.Is(err, fs.ErrNotExist) if the file is missing.
+func (d Dir) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(d.Path(name))
+}
+
+// WriteFile atomically writes a file into the state directory with 0600
+// permissions. Readers never observe a partially written file.
+// name may include subdirectories, which are created as needed.
+func (d Dir) WriteFile(name string, data []byte) error {
+	if err := d.Ensure(); err != nil {
+		return err
+	}
+
+	path := d.Path(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("state: failed to create directory for %s: %w", name, err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("state: failed to create temporary file: %w", err)
+	}
+	tmpName := tmp.Name()
+
+	// Remove the temporary file on any failure below
+	defer func() {
+		if tmpName != "" {
+			_ = os.Remove(tmpName)
+		}
+	}()
+
+	if err := tmp.Chmod(0o600); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("state: failed to set permissions: %w", err)
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("state: failed to write %s: %w", name, err)
+	}
+
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("state: failed to sync %s: %w", name, err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("state: failed to close %s: %w", name, err)
+	}
+
+	if err := os.Rename(tmpName, path); err != nil {
+		return fmt.Errorf("state: failed to replace %s: %w", name, err)
+	}
+
+	tmpName = ""
+	return nil
+}
+
+// Remove deletes a file from the state directory. Missing files are ignored.
+func (d Dir) Remove(name string) error {
+	if err := os.Remove(d.Path(name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("state: failed to remove %s: %w", name, err)
+	}
+	return nil
+}
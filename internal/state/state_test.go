@@ -0,0 +1,109 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestDirEnsure(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("modes are not checked on Windows")
+	}
+
+	tests := []struct {
+		name    string
+		setup   func(t *testing.T, path string)
+		wantErr bool
+	}{
+		{
+			name: "created",
+		},
+		{
+			name: "existing private",
+			setup: func(t *testing.T, path string) {
+				mkdir(t, path, 0o700)
+			},
+		},
+		{
+			name: "readable by others",
+			setup: func(t *testing.T, path string) {
+				mkdir(t, path, 0o755)
+			},
+			wantErr: true,
+		},
+		{
+			name: "writable by group",
+			setup: func(t *testing.T, path string) {
+				mkdir(t, path, 0o720)
+			},
+			wantErr: true,
+		},
+		{
+			name: "symbolic link",
+			setup: func(t *testing.T, path string) {
+				target := path + "-target"
+				mkdir(t, target, 0o700)
+				if err := os.Symlink(target, path); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr: true,
+		},
+		{
+			name: "file",
+			setup: func(t *testing.T, path string) {
+				if err := os.WriteFile(path, nil, 0o600); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "state")
+			if tt.setup != nil {
+				tt.setup(t, path)
+			}
+
+			if err := Dir(path).Ensure(); (err != nil) != tt.wantErr {
+				t.Errorf("Ensure() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDirWriteFile(t *testing.T) {
+	d := Dir(filepath.Join(t.TempDir(), "state"))
+
+	if err := d.WriteFile("spool/batch.json", []byte("data")); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	data, err := d.ReadFile("spool/batch.json")
+	if err != nil || string(data) != "data" {
+		t.Fatalf("ReadFile() = %q, %v", data, err)
+	}
+
+	info, err := os.Stat(d.Path("spool/batch.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0o600 {
+		t.Errorf("mode = %04o, want 0600", info.Mode().Perm())
+	}
+}
+
+// mkdir creates a directory with exactly the given mode.
+func mkdir(t *testing.T, path string, mode os.FileMode) {
+	t.Helper()
+	if err := os.Mkdir(path, mode); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,331 @@
+package status
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"sync"
+	"time"
+
+	"dideban-agent/internal/collector"
+	"dideban-agent/internal/config"
+	"dideban-agent/internal/logger"
+	"dideban-agent/internal/payload"
+	"dideban-agent/internal/ring"
+	"dideban-agent/internal/version"
+)
+
+// log is the logger of the status component.
+var log = logger.New("status")
+
+// Config contains configuration for the status API.
+type Config struct {
+	// Loopback TCP address (empty = no TCP listener)
+	Listen string
+
+	// Unix socket path (empty = no socket)
+	Socket string
+
+	// Maximum age of the last collection and of the last successful send
+	// for /readyz (0 = three collection intervals)
+	ReadyCollectAge time.Duration
+	ReadySendAge    time.Duration
+}
+
+// readyIntervals is the default readiness threshold, in collection intervals.
+const readyIntervals = 3
+
+// HistorySize is the number of recent snapshots served by /history.
+const HistorySize = 20
+
+// Server is the local health and status HTTP API.
+//
+// It serves:
+//   - /healthz: liveness, always 200 while the process serves requests
+//   - /readyz: 200 if the last collection and the last successful send
+//     are recent enough, 503 otherwise
+//   - /status: version, redacted configuration and agent statistics
+//   - /last: the most recent snapshot
+//   - /history: up to HistorySize recent snapshots, oldest first
+//   - /debug/goroutines: stack traces of all goroutines
+//   - /debug/memstats: Go runtime memory statistics
+//
+// The agent loop publishes every snapshot with Publish; the queue is
+// queried live so /readyz notices sends as soon as they happen.
+type Server struct {
+	config  Config
+	queue   func() *payload.QueueStats
+	started time.Time
+
+	mu          sync.RWMutex
+	last        *collector.Metrics
+	history     *ring.Buffer[*collector.Metrics]
+	cfg         *config.Config
+	collectedAt time.Time
+
+	servers []*http.Server
+}
+
+// New creates a status server. queue returns the live queue statistics.
+func New(config Config, queue func() *payload.QueueStats) *Server {
+	return &Server{
+		config:  config,
+		queue:   queue,
+		started: time.Now(),
+		history: ring.New[*collector.Metrics](HistorySize),
+	}
+}
+
+// Start opens the listeners and serves requests in the background.
+func (s *Server) Start() error {
+	mux := s.handler()
+
+	var listeners []net.Listener
+
+	if s.config.Listen != "" {
+		l, err := net.Listen("tcp", s.config.Listen)
+		if err != nil {
+			return fmt.Errorf("failed to listen on %s: %w", s.config.Listen, err)
+		}
+		listeners = append(listeners, l)
+	}
+
+	if s.config.Socket != "" {
+		l, err := listenSocket(s.config.Socket)
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return err
+		}
+		listeners = append(listeners, l)
+	}
+
+	for _, l := range listeners {
+		server := &http.Server{
+			Handler:           mux,
+			ReadHeaderTimeout: 5 * time.Second,
+		}
+		s.servers = append(s.servers, server)
+
+		go func() {
+			if err := server.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Error().Err(err).Str("address", l.Addr().String()).Msg("Status API stopped")
+			}
+		}()
+
+		log.Info().Str("address", l.Addr().String()).Msg("🩺 Status API listening")
+	}
+
+	return nil
+}
+
+// handler returns the handler serving the API endpoints.
+func (s *Server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", s.handleHealth)
+	mux.HandleFunc("GET /readyz", s.handleReady)
+	mux.HandleFunc("GET /status", s.handleStatus)
+	mux.HandleFunc("GET /last", s.handleLast)
+	mux.HandleFunc("GET /history", s.handleHistory)
+	mux.HandleFunc("GET /debug/goroutines", s.handleGoroutines)
+	mux.HandleFunc("GET /debug/memstats", s.handleMemStats)
+	return mux
+}
+
+// listenSocket listens on a unix socket, replacing a stale socket file
+// left by a previous run. Only the owner may connect.
+func listenSocket(path string) (net.Listener, error) {
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to remove stale socket %s: %w", path, err)
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+
+	if err := os.Chmod(path, 0o600); err != nil {
+		l.Close()
+		return nil, fmt.Errorf("failed to restrict socket permissions: %w", err)
+	}
+
+	return l, nil
+}
+
+// Close stops serving requests, waiting for active ones until ctx is done.
+// Unix socket files are removed by the listener.
+func (s *Server) Close(ctx context.Context) {
+	for _, server := range s.servers {
+		if err := server.Shutdown(ctx); err != nil {
+			log.Warn().Err(err).Msg("Failed to stop status API")
+		}
+	}
+}
+
+// Publish records the latest snapshot and the configuration it was
+// collected with.
+func (s *Server) Publish(metrics *collector.Metrics, cfg *config.Config) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.last = metrics
+	s.history.Push(metrics)
+	s.cfg = cfg
+	s.collectedAt = time.Now()
+}
+
+// handleHealth reports that the process is alive.
+func (s *Server) handleHealth(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleReady reports whether the agent collects and delivers metrics.
+func (s *Server) handleReady(w http.ResponseWriter, _ *http.Request) {
+	s.mu.RLock()
+	cfg, collectedAt := s.cfg, s.collectedAt
+	s.mu.RUnlock()
+
+	if cfg == nil {
+		writeJSON(w, http.StatusServiceUnavailable, readiness{Reasons: []string{"no collection yet"}})
+		return
+	}
+
+	collectAge := s.threshold(s.config.ReadyCollectAge, cfg)
+	sendAge := s.threshold(s.config.ReadySendAge, cfg)
+
+	// Before the first send, the agent gets one threshold from start
+	lastSent := s.started
+	if stats := s.queue(); stats.LastSent > 0 {
+		lastSent = time.UnixMilli(stats.LastSent)
+	}
+
+	result := readiness{
+		Ready:       true,
+		LastCollect: collectedAt.UnixMilli(),
+		LastSend:    lastSent.UnixMilli(),
+	}
+
+	if age := time.Since(collectedAt); age > collectAge {
+		result.Reasons = append(result.Reasons, fmt.Sprintf("last collection %s ago (max %s)", age.Round(time.Second), collectAge))
+	}
+	if age := time.Since(lastSent); age > sendAge {
+		result.Reasons = append(result.Reasons, fmt.Sprintf("last successful send %s ago (max %s)", age.Round(time.Second), sendAge))
+	}
+
+	code := http.StatusOK
+	if len(result.Reasons) > 0 {
+		result.Ready = false
+		code = http.StatusServiceUnavailable
+	}
+
+	writeJSON(w, code, result)
+}
+
+// readiness is the /readyz response.
+type readiness struct {
+	Ready       bool     `json:"ready"`
+	LastCollect int64    `json:"last_collect_ms,omitempty"`
+	LastSend    int64    `json:"last_send_ms,omitempty"`
+	Reasons     []string `json:"reasons,omitempty"`
+}
+
+// threshold returns the configured readiness threshold or its default.
+func (s *Server) threshold(configured time.Duration, cfg *config.Config) time.Duration {
+	if configured > 0 {
+		return configured
+	}
+	return readyIntervals * cfg.Agent.Interval
+}
+
+// handleStatus reports the agent version, configuration and statistics.
+func (s *Server) handleStatus(w http.ResponseWriter, _ *http.Request) {
+	s.mu.RLock()
+	last, cfg, collectedAt := s.last, s.cfg, s.collectedAt
+	s.mu.RUnlock()
+
+	result := map[string]any{
+		"version":  version.Version,
+		"uptime_s": int64(time.Since(s.started).Seconds()),
+		"queue":    s.queue(),
+	}
+
+	if cfg != nil {
+		result["config_hash"] = cfg.Hash()
+		result["config"] = cfg.Redacted()
+		result["last_collect_ms"] = collectedAt.UnixMilli()
+	}
+
+	if last != nil && last.Agent != nil {
+		result["collectors"] = last.Agent.Collectors
+		result["sender"] = last.Agent.Sender
+		result["schedule"] = last.Agent.Schedule
+		result["process"] = last.Agent.Process
+		result["logs"] = last.Agent.Logs
+		result["sandbox"] = last.Agent.Sandbox
+	}
+
+	if last != nil {
+		result["remote_config"] = last.Config
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// handleLast returns the most recent snapshot.
+func (s *Server) handleLast(w http.ResponseWriter, _ *http.Request) {
+	s.mu.RLock()
+	last := s.last
+	s.mu.RUnlock()
+
+	if last == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "no snapshot yet"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, last)
+}
+
+// handleHistory returns the recent snapshots, oldest first.
+func (s *Server) handleHistory(w http.ResponseWriter, _ *http.Request) {
+	s.mu.RLock()
+	history := s.history.Values()
+	s.mu.RUnlock()
+
+	writeJSON(w, http.StatusOK, history)
+}
+
+// handleGoroutines dumps the stack traces of all goroutines.
+func (s *Server) handleGoroutines(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if err := pprof.Lookup("goroutine").WriteTo(w, 2); err != nil {
+		log.Debug().Err(err).Msg("Failed to write goroutine dump")
+	}
+}
+
+// handleMemStats reports the Go runtime memory statistics.
+func (s *Server) handleMemStats(w http.ResponseWriter, _ *http.Request) {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+
+	writeJSON(w, http.StatusOK, &stats)
+}
+
+// writeJSON writes v as an indented JSON response.
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		log.Debug().Err(err).Msg("Failed to write status response")
+	}
+}
@@ -0,0 +1,199 @@
+package status
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"dideban-agent/internal/collector"
+	"dideban-agent/internal/config"
+	"dideban-agent/internal/payload"
+)
+
+// testConfig returns an agent configuration collecting every minute.
+func testConfig() *config.Config {
+	cfg := &config.Config{}
+	cfg.Agent.Name = "web-01"
+	cfg.Agent.Interval = time.Minute
+	cfg.Core.Token = "core-token-value"
+	return cfg
+}
+
+// get requests path from the server and decodes the JSON response into v.
+func get(t *testing.T, server *httptest.Server, path string, v any) int {
+	t.Helper()
+
+	resp, err := server.Client().Get(server.URL + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatalf("GET %s: invalid response: %v", path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestReady(t *testing.T) {
+	tests := []struct {
+		name        string
+		publish     bool
+		collectAge  time.Duration
+		sendAge     time.Duration // 0 = nothing sent yet
+		startAge    time.Duration
+		wantCode    int
+		wantReasons []string
+	}{
+		{name: "no collection yet", wantCode: http.StatusServiceUnavailable, wantReasons: []string{"no collection yet"}},
+		{name: "ready", publish: true, sendAge: time.Minute, wantCode: http.StatusOK},
+		{name: "nothing sent shortly after start", publish: true, startAge: time.Minute, wantCode: http.StatusOK},
+		{
+			name:        "nothing sent since start",
+			publish:     true,
+			startAge:    time.Hour,
+			wantCode:    http.StatusServiceUnavailable,
+			wantReasons: []string{"last successful send"},
+		},
+		{
+			name:        "collection stalled",
+			publish:     true,
+			collectAge:  5 * time.Minute,
+			sendAge:     time.Minute,
+			wantCode:    http.StatusServiceUnavailable,
+			wantReasons: []string{"last collection"},
+		},
+		{
+			name:        "sends failing",
+			publish:     true,
+			sendAge:     5 * time.Minute,
+			wantCode:    http.StatusServiceUnavailable,
+			wantReasons: []string{"last successful send"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queue := &payload.QueueStats{}
+			if tt.sendAge > 0 {
+				queue.LastSent = time.Now().Add(-tt.sendAge).UnixMilli()
+			}
+
+			s := New(Config{}, func() *payload.QueueStats { return queue })
+			s.started = time.Now().Add(-tt.startAge)
+			if tt.publish {
+				s.Publish(&collector.Metrics{}, testConfig())
+				s.collectedAt = time.Now().Add(-tt.collectAge)
+			}
+
+			server := httptest.NewServer(s.handler())
+			defer server.Close()
+
+			var result readiness
+			if code := get(t, server, "/readyz", &result); code != tt.wantCode {
+				t.Errorf("GET /readyz = %d, want %d", code, tt.wantCode)
+			}
+			if result.Ready != (tt.wantCode == http.StatusOK) || len(result.Reasons) != len(tt.wantReasons) {
+				t.Fatalf("GET /readyz = %+v, want reasons %q", result, tt.wantReasons)
+			}
+			for i, reason := range tt.wantReasons {
+				if !strings.HasPrefix(result.Reasons[i], reason) {
+					t.Errorf("reason %q, want %q", result.Reasons[i], reason)
+				}
+			}
+		})
+	}
+}
+
+func TestSnapshots(t *testing.T) {
+	s := New(Config{}, func() *payload.QueueStats { return &payload.QueueStats{} })
+	server := httptest.NewServer(s.handler())
+	defer server.Close()
+
+	if code := get(t, server, "/healthz", nil); code != http.StatusOK {
+		t.Errorf("GET /healthz = %d, want 200", code)
+	}
+	if code := get(t, server, "/last", nil); code != http.StatusNotFound {
+		t.Errorf("GET /last before the first collection = %d, want 404", code)
+	}
+
+	cfg := testConfig()
+	for i := range HistorySize + 5 {
+		s.Publish(&collector.Metrics{Timestamp: int64(i + 1)}, cfg)
+	}
+
+	var last collector.Metrics
+	if code := get(t, server, "/last", &last); code != http.StatusOK || last.Timestamp != HistorySize+5 {
+		t.Errorf("GET /last = %d, timestamp %d, want the latest snapshot", code, last.Timestamp)
+	}
+
+	var history []collector.Metrics
+	get(t, server, "/history", &history)
+	if len(history) != HistorySize || history[0].Timestamp != 6 || history[HistorySize-1].Timestamp != HistorySize+5 {
+		t.Errorf("GET /history returned %d snapshots, want the latest %d, oldest first", len(history), HistorySize)
+	}
+
+	var status map[string]any
+	resp, err := server.Client().Get(server.URL + "/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err := json.Unmarshal(body, &status); err != nil {
+		t.Fatal(err)
+	}
+	if status["config_hash"] != cfg.Hash() {
+		t.Errorf("config_hash = %v, want %q", status["config_hash"], cfg.Hash())
+	}
+	if strings.Contains(string(body), "core-token-value") {
+		t.Error("GET /status exposes the Core token")
+	}
+}
+
+func TestSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "status.sock")
+
+	// A socket file left by a previous run is replaced
+	if err := os.WriteFile(path, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	s := New(Config{Socket: path}, func() *payload.QueueStats { return &payload.QueueStats{} })
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close(context.Background())
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("socket mode = %04o, want 0600", perm)
+	}
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+	resp, err := client.Get("http://agent/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("GET /healthz over the socket = %d, want 200", resp.StatusCode)
+	}
+}
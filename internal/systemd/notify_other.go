@@ -0,0 +1,8 @@
+//go:build !unix
+
+package systemd
+
+// Notify is a no-op on platforms without systemd.
+func Notify(states ...string) (bool, error) {
+	return false, nil
+}
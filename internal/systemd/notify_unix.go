@@ -0,0 +1,37 @@
+//go:build unix
+
+package systemd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// Notify sends state notifications (e.g. Ready, Status("...")) to the
+// service manager through NOTIFY_SOCKET. It reports false without an
+// error if the agent was not started by systemd with Type=notify.
+func Notify(states ...string) (bool, error) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return false, nil
+	}
+
+	// Abstract socket names are written with a leading "@"
+	if strings.HasPrefix(socket, "@") {
+		socket = "\x00" + socket[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return false, fmt.Errorf("failed to connect to notify socket: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte(strings.Join(states, "\n"))); err != nil {
+		return false, fmt.Errorf("failed to send notification: %w", err)
+	}
+
+	return true, nil
+}
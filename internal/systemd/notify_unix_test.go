@@ -0,0 +1,75 @@
+//go:build unix
+
+package systemd
+
+import (
+	"net"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestNotify(t *testing.T) {
+	tests := []struct {
+		name     string
+		abstract bool
+		states   []string
+		want     string
+	}{
+		{name: "ready", states: []string{Ready}, want: "READY=1"},
+		{name: "several states", states: []string{Ready, Status("sending")}, want: "READY=1\nSTATUS=sending"},
+		{name: "abstract socket", abstract: true, states: []string{Stopping}, want: "STOPPING=1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.abstract && runtime.GOOS != "linux" {
+				t.Skip("abstract sockets are only available on Linux")
+			}
+
+			// The service manager side of the socket
+			addr := filepath.Join(t.TempDir(), "notify.sock")
+			env := addr
+			if tt.abstract {
+				env = "@" + strings.ReplaceAll(t.Name(), "/", "-")
+				addr = "\x00" + env[1:]
+			}
+
+			conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: addr, Net: "unixgram"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			t.Setenv("NOTIFY_SOCKET", env)
+
+			sent, err := Notify(tt.states...)
+			if err != nil || !sent {
+				t.Fatalf("Notify() = %v, %v, want true, nil", sent, err)
+			}
+
+			buf := make([]byte, 1024)
+			n, err := conn.Read(buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(buf[:n]); got != tt.want {
+				t.Errorf("received %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNotifyWithoutSocket(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+
+	if sent, err := Notify(Ready); sent || err != nil {
+		t.Errorf("Notify() = %v, %v, want false, nil", sent, err)
+	}
+
+	t.Setenv("NOTIFY_SOCKET", filepath.Join(t.TempDir(), "missing.sock"))
+	if sent, err := Notify(Ready); sent || err == nil {
+		t.Errorf("Notify() to a missing socket = %v, %v, want false and an error", sent, err)
+	}
+}
@@ -0,0 +1,43 @@
+package systemd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Notification states understood by the service manager.
+const (
+	Ready    = "READY=1"
+	Stopping = "STOPPING=1"
+	Watchdog = "WATCHDOG=1"
+)
+
+// Status returns a STATUS= notification carrying a free-form status line
+// (shown by systemctl status).
+func Status(text string) string {
+	return "STATUS=" + text
+}
+
+// WatchdogInterval returns the watchdog timeout requested by the service
+// manager (WatchdogSec=), or zero if the watchdog is not enabled for
+// this process. Pings should be sent at half this interval.
+func WatchdogInterval() (time.Duration, error) {
+	value := os.Getenv("WATCHDOG_USEC")
+	if value == "" {
+		return 0, nil
+	}
+
+	// The watchdog may be meant for another process (e.g. a parent shell)
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0, nil
+	}
+
+	usec, err := strconv.ParseUint(value, 10, 63)
+	if err != nil || usec == 0 {
+		return 0, fmt.Errorf("invalid WATCHDOG_USEC: %q", value)
+	}
+
+	return time.Duration(usec) * time.Microsecond, nil
+}
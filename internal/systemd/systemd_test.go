@@ -0,0 +1,42 @@
+package systemd
+
+import (
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestWatchdogInterval(t *testing.T) {
+	self := strconv.Itoa(os.Getpid())
+
+	tests := []struct {
+		name    string
+		usec    string
+		pid     string
+		want    time.Duration
+		wantErr bool
+	}{
+		{name: "disabled"},
+		{name: "enabled", usec: "30000000", want: 30 * time.Second},
+		{name: "for this process", usec: "1000", pid: self, want: time.Millisecond},
+		{name: "for another process", usec: "1000", pid: "1"},
+		{name: "zero", usec: "0", wantErr: true},
+		{name: "malformed", usec: "30s", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("WATCHDOG_USEC", tt.usec)
+			t.Setenv("WATCHDOG_PID", tt.pid)
+
+			got, err := WatchdogInterval()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("WatchdogInterval() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("WatchdogInterval() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
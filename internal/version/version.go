@@ -0,0 +1,10 @@
+package version
+
+// Version is the agent version. Release builds set it with
+// -ldflags "-X dideban-agent/internal/version.Version=<version>".
+var Version = "0.1.1"
+
+// UserAgent returns the User-Agent header sent with every request.
+func UserAgent() string {
+	return "dideban-agent/" + Version
+}
@@ -0,0 +1,244 @@
+// Package sealedbox encrypts Dideban Agent request bodies to a public key
+// of Core, so relays that terminate TLS can forward payloads without
+// reading them.
+//
+// Every body is sealed with a fresh ephemeral X25519 key: the shared
+// secret with the recipient key is expanded with HKDF-SHA256 into a
+// ChaCha20-Poly1305 key, and the sealed body is the ephemeral public key
+// followed by the ciphertext. The agent sets three headers:
+//
+//	X-Dideban-Encryption:        algorithm (x25519-chacha20poly1305)
+//	X-Dideban-Encryption-Key-Id: ID of the recipient key
+//	X-Dideban-Content-Type:      content type of the plaintext
+//
+// The key ID is authenticated with the ciphertext. Servers keep the
+// private keys of every ID still in use, so keys can be rotated without
+// coordinating all agents at once, and open bodies with an Opener.
+//
+// The package has no dependencies on the agent, so Go servers can import
+// it directly.
+package sealedbox
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// Header names.
+const (
+	HeaderAlgorithm   = "X-Dideban-Encryption"
+	HeaderKeyID       = "X-Dideban-Encryption-Key-Id"
+	HeaderContentType = "X-Dideban-Content-Type"
+)
+
+// Algorithm identifies the sealed box format.
+const Algorithm = "x25519-chacha20poly1305"
+
+// ContentType is the content type of sealed bodies.
+const ContentType = "application/octet-stream"
+
+// info separates Dideban keys from other uses of the shared secret and
+// identifies the format version.
+const info = "dideban-v1 sealed box"
+
+// keySize is the size of X25519 public keys.
+const keySize = 32
+
+// KeyID returns the default identifier of a public key: the hex-encoded
+// first 8 bytes of its SHA-256 hash.
+func KeyID(key *ecdh.PublicKey) string {
+	sum := sha256.Sum256(key.Bytes())
+	return hex.EncodeToString(sum[:8])
+}
+
+// ParsePublicKey parses a base64-encoded (standard or URL alphabet,
+// padded or not) X25519 public key.
+func ParsePublicKey(s string) (*ecdh.PublicKey, error) {
+	for _, encoding := range []*base64.Encoding{
+		base64.StdEncoding, base64.RawStdEncoding,
+		base64.URLEncoding, base64.RawURLEncoding,
+	} {
+		raw, err := encoding.DecodeString(s)
+		if err != nil {
+			continue
+		}
+		if len(raw) != keySize {
+			return nil, fmt.Errorf("sealedbox: public key must be %d bytes, got %d", keySize, len(raw))
+		}
+		return ecdh.X25519().NewPublicKey(raw)
+	}
+	return nil, errors.New("sealedbox: public key is not valid base64")
+}
+
+// newAEAD derives the cipher of one sealed body.
+func newAEAD(secret, ephemeral, recipient []byte) (cipher.AEAD, error) {
+	salt := make([]byte, 0, 2*keySize)
+	salt = append(salt, ephemeral...)
+	salt = append(salt, recipient...)
+
+	key, err := hkdf.Key(sha256.New, secret, salt, info, chacha20poly1305.KeySize)
+	if err != nil {
+		return nil, err
+	}
+	return chacha20poly1305.New(key)
+}
+
+// nonce is the ChaCha20-Poly1305 nonce. It can be constant because every
+// key is derived from a fresh ephemeral key and used once.
+var nonce = make([]byte, chacha20poly1305.NonceSize)
+
+// Sealer encrypts request bodies to a recipient public key.
+type Sealer struct {
+	key   *ecdh.PublicKey
+	keyID string
+}
+
+// NewSealer creates a sealer for the given recipient key. An empty keyID
+// selects KeyID(key).
+func NewSealer(key *ecdh.PublicKey, keyID string) *Sealer {
+	if keyID == "" {
+		keyID = KeyID(key)
+	}
+	return &Sealer{key: key, keyID: keyID}
+}
+
+// KeyID returns the identifier of the recipient key.
+func (s *Sealer) KeyID() string {
+	return s.keyID
+}
+
+// Seal encrypts body and sets the encryption headers on h. The content
+// type in h is moved to HeaderContentType.
+func (s *Sealer) Seal(h http.Header, body []byte) ([]byte, error) {
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("sealedbox: failed to generate key: %w", err)
+	}
+
+	secret, err := ephemeral.ECDH(s.key)
+	if err != nil {
+		return nil, fmt.Errorf("sealedbox: key agreement failed: %w", err)
+	}
+
+	public := ephemeral.PublicKey().Bytes()
+	aead, err := newAEAD(secret, public, s.key.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("sealedbox: failed to derive key: %w", err)
+	}
+
+	sealed := make([]byte, 0, keySize+len(body)+chacha20poly1305.Overhead)
+	sealed = append(sealed, public...)
+	sealed = aead.Seal(sealed, nonce, body, []byte(s.keyID))
+
+	if contentType := h.Get("Content-Type"); contentType != "" {
+		h.Set(HeaderContentType, contentType)
+	}
+	h.Set("Content-Type", ContentType)
+	h.Set(HeaderAlgorithm, Algorithm)
+	h.Set(HeaderKeyID, s.keyID)
+	return sealed, nil
+}
+
+// Decryption errors. Errors returned by Opener wrap one of them.
+var (
+	ErrNotSealed   = errors.New("sealedbox: body is not encrypted")
+	ErrUnsupported = errors.New("sealedbox: unsupported algorithm")
+	ErrUnknownKey  = errors.New("sealedbox: unknown key")
+	ErrMalformed   = errors.New("sealedbox: malformed body")
+	ErrDecrypt     = errors.New("sealedbox: decryption failed")
+)
+
+// Sealed reports whether h describes an encrypted body.
+func Sealed(h http.Header) bool {
+	return h.Get(HeaderAlgorithm) != ""
+}
+
+// Opener decrypts sealed request bodies. It is safe for concurrent use.
+type Opener struct {
+	// Keys returns the private key with the given ID, or nil if the ID
+	// is unknown. Previous keys should be kept until no agent uses them.
+	Keys func(keyID string) *ecdh.PrivateKey
+}
+
+// Open decrypts body according to the encryption headers in h and
+// returns the plaintext and the ID of the recipient key. On success the
+// content type in h is restored from HeaderContentType.
+func (o *Opener) Open(h http.Header, body []byte) ([]byte, string, error) {
+	algorithm := h.Get(HeaderAlgorithm)
+	if algorithm == "" {
+		return nil, "", ErrNotSealed
+	}
+	if algorithm != Algorithm {
+		return nil, "", fmt.Errorf("%w: %s", ErrUnsupported, algorithm)
+	}
+
+	keyID := h.Get(HeaderKeyID)
+	key := o.Keys(keyID)
+	if key == nil {
+		return nil, "", fmt.Errorf("%w: %q", ErrUnknownKey, keyID)
+	}
+
+	if len(body) < keySize+chacha20poly1305.Overhead {
+		return nil, "", fmt.Errorf("%w: %d bytes", ErrMalformed, len(body))
+	}
+
+	ephemeral, err := ecdh.X25519().NewPublicKey(body[:keySize])
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+
+	secret, err := key.ECDH(ephemeral)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+
+	aead, err := newAEAD(secret, body[:keySize], key.PublicKey().Bytes())
+	if err != nil {
+		return nil, "", err
+	}
+
+	plaintext, err := aead.Open(nil, nonce, body[keySize:], []byte(keyID))
+	if err != nil {
+		return nil, "", ErrDecrypt
+	}
+
+	if contentType := h.Get(HeaderContentType); contentType != "" {
+		h.Set("Content-Type", contentType)
+	}
+	return plaintext, keyID, nil
+}
+
+// OpenRequest reads the body of r (up to maxBytes), decrypts it and
+// replaces r.Body with the plaintext so handlers can read it. Signatures
+// (package signature) cover the sealed body, so requests must be
+// verified before they are opened.
+func (o *Opener) OpenRequest(r *http.Request, maxBytes int64) ([]byte, string, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBytes+1))
+	if err != nil {
+		return nil, "", fmt.Errorf("sealedbox: failed to read body: %w", err)
+	}
+	if int64(len(body)) > maxBytes {
+		return nil, "", fmt.Errorf("sealedbox: body larger than %d bytes", maxBytes)
+	}
+
+	plaintext, keyID, err := o.Open(r.Header, body)
+	if err != nil {
+		return nil, "", err
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(plaintext))
+	r.ContentLength = int64(len(plaintext))
+	return plaintext, keyID, nil
+}
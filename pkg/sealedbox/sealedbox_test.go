@@ -0,0 +1,200 @@
+package sealedbox
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newTestKey(t *testing.T) *ecdh.PrivateKey {
+	t.Helper()
+
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestOpen(t *testing.T) {
+	recipient := newTestKey(t)
+	other := newTestKey(t)
+	body := []byte(`{"cpu":{"usage_percent":12.5}}`)
+
+	tests := []struct {
+		name    string
+		sealer  *Sealer
+		modify  func(h http.Header, sealed []byte) []byte
+		wantErr error
+	}{
+		{
+			name:   "default key ID",
+			sealer: NewSealer(recipient.PublicKey(), ""),
+		},
+		{
+			name:   "configured key ID",
+			sealer: NewSealer(recipient.PublicKey(), "2026-10"),
+		},
+		{
+			name:    "not sealed",
+			sealer:  NewSealer(recipient.PublicKey(), ""),
+			modify:  func(h http.Header, sealed []byte) []byte { h.Del(HeaderAlgorithm); return sealed },
+			wantErr: ErrNotSealed,
+		},
+		{
+			name:    "unsupported algorithm",
+			sealer:  NewSealer(recipient.PublicKey(), ""),
+			modify:  func(h http.Header, sealed []byte) []byte { h.Set(HeaderAlgorithm, "rot13"); return sealed },
+			wantErr: ErrUnsupported,
+		},
+		{
+			name:    "unknown key",
+			sealer:  NewSealer(other.PublicKey(), ""),
+			wantErr: ErrUnknownKey,
+		},
+		{
+			name:    "truncated",
+			sealer:  NewSealer(recipient.PublicKey(), ""),
+			modify:  func(h http.Header, sealed []byte) []byte { return sealed[:keySize] },
+			wantErr: ErrMalformed,
+		},
+		{
+			name:   "altered ciphertext",
+			sealer: NewSealer(recipient.PublicKey(), ""),
+			modify: func(h http.Header, sealed []byte) []byte {
+				sealed[len(sealed)-1] ^= 1
+				return sealed
+			},
+			wantErr: ErrDecrypt,
+		},
+		{
+			// The key ID is authenticated: the body cannot be relabelled
+			name:   "altered key ID",
+			sealer: NewSealer(recipient.PublicKey(), "old"),
+			modify: func(h http.Header, sealed []byte) []byte {
+				h.Set(HeaderKeyID, KeyID(recipient.PublicKey()))
+				return sealed
+			},
+			wantErr: ErrDecrypt,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &Opener{Keys: func(keyID string) *ecdh.PrivateKey {
+				if keyID == KeyID(recipient.PublicKey()) || keyID == "2026-10" || keyID == "old" {
+					return recipient
+				}
+				return nil
+			}}
+
+			h := http.Header{"Content-Type": []string{"application/json"}}
+			sealed, err := tt.sealer.Seal(h, body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if h.Get("Content-Type") != ContentType || h.Get(HeaderContentType) != "application/json" {
+				t.Fatalf("Seal() headers = %v", h)
+			}
+			if tt.modify != nil {
+				sealed = tt.modify(h, sealed)
+			}
+
+			plaintext, keyID, err := o.Open(h, sealed)
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("Open() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			if !bytes.Equal(plaintext, body) {
+				t.Errorf("Open() = %q, want %q", plaintext, body)
+			}
+			if keyID != tt.sealer.KeyID() {
+				t.Errorf("Open() key ID = %q, want %q", keyID, tt.sealer.KeyID())
+			}
+			if h.Get("Content-Type") != "application/json" {
+				t.Errorf("Content-Type = %q after Open()", h.Get("Content-Type"))
+			}
+		})
+	}
+}
+
+func TestSealIsRandomized(t *testing.T) {
+	s := NewSealer(newTestKey(t).PublicKey(), "")
+	body := []byte("same body")
+
+	first, err := s.Seal(http.Header{}, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := s.Seal(http.Header{}, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Equal(first, second) {
+		t.Error("sealing the same body twice gave the same output")
+	}
+}
+
+func TestParsePublicKey(t *testing.T) {
+	raw := newTestKey(t).PublicKey().Bytes()
+
+	tests := []struct {
+		name    string
+		in      string
+		wantErr bool
+	}{
+		{name: "standard", in: base64.StdEncoding.EncodeToString(raw)},
+		{name: "standard unpadded", in: base64.RawStdEncoding.EncodeToString(raw)},
+		{name: "url", in: base64.URLEncoding.EncodeToString(raw)},
+		{name: "url unpadded", in: base64.RawURLEncoding.EncodeToString(raw)},
+		{name: "short", in: base64.StdEncoding.EncodeToString(raw[:16]), wantErr: true},
+		{name: "not base64", in: "not a key!", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := ParsePublicKey(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePublicKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !bytes.Equal(key.Bytes(), raw) {
+				t.Error("ParsePublicKey() returned a different key")
+			}
+		})
+	}
+}
+
+func TestOpenRequest(t *testing.T) {
+	recipient := newTestKey(t)
+	o := &Opener{Keys: func(string) *ecdh.PrivateKey { return recipient }}
+	body := []byte(`{"timestamp_ms":1}`)
+
+	r := httptest.NewRequest(http.MethodPost, "/api/metrics", nil)
+	sealed, err := NewSealer(recipient.PublicKey(), "").Seal(r.Header, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Body = io.NopCloser(bytes.NewReader(sealed))
+
+	if _, _, err := o.OpenRequest(r, int64(len(sealed))); err != nil {
+		t.Fatalf("OpenRequest() error = %v", err)
+	}
+	if rest, _ := io.ReadAll(r.Body); !bytes.Equal(rest, body) || r.ContentLength != int64(len(body)) {
+		t.Errorf("request body after OpenRequest() = %q (%d bytes)", rest, r.ContentLength)
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(sealed))
+	if _, _, err := o.OpenRequest(r, int64(len(sealed))-1); err == nil {
+		t.Error("OpenRequest() accepted a body over the limit")
+	}
+}
@@ -0,0 +1,236 @@
+// Package signature signs and verifies Dideban Agent request bodies with
+// Ed25519, so Core can detect payloads altered in transit (e.g. by a
+// TLS-terminating proxy).
+//
+// The agent signs every request with its per-agent key and sets four
+// headers:
+//
+//	X-Dideban-Key-Id:    key ID (KeyID of the public key)
+//	X-Dideban-Timestamp: signing time, Unix seconds
+//	X-Dideban-Nonce:     random value, unique per request
+//	X-Dideban-Signature: base64 Ed25519 signature
+//
+// The signature covers "dideban-v1\n" + timestamp + "\n" + nonce + "\n"
+// followed by the exact request body. Servers verify requests with a
+// Verifier, which also rejects stale timestamps and reused nonces.
+//
+// The package has no dependencies on the agent, so Go servers can import
+// it directly.
+package signature
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Header names.
+const (
+	HeaderKeyID     = "X-Dideban-Key-Id"
+	HeaderTimestamp = "X-Dideban-Timestamp"
+	HeaderNonce     = "X-Dideban-Nonce"
+	HeaderSignature = "X-Dideban-Signature"
+)
+
+// prefix separates Dideban signatures from other uses of the key and
+// identifies the format version.
+const prefix = "dideban-v1\n"
+
+// KeyID returns the identifier of a public key: the hex-encoded first
+// 8 bytes of its SHA-256 hash.
+func KeyID(key ed25519.PublicKey) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// message builds the signed message.
+func message(timestamp, nonce string, body []byte) []byte {
+	m := make([]byte, 0, len(prefix)+len(timestamp)+len(nonce)+2+len(body))
+	m = append(m, prefix...)
+	m = append(m, timestamp...)
+	m = append(m, '\n')
+	m = append(m, nonce...)
+	m = append(m, '\n')
+	return append(m, body...)
+}
+
+// Signer signs request bodies with a private key.
+type Signer struct {
+	key   ed25519.PrivateKey
+	keyID string
+}
+
+// NewSigner creates a signer for the given private key.
+func NewSigner(key ed25519.PrivateKey) *Signer {
+	return &Signer{
+		key:   key,
+		keyID: KeyID(key.Public().(ed25519.PublicKey)),
+	}
+}
+
+// PublicKey returns the public key matching the signing key.
+func (s *Signer) PublicKey() ed25519.PublicKey {
+	return s.key.Public().(ed25519.PublicKey)
+}
+
+// KeyID returns the identifier of the signing key.
+func (s *Signer) KeyID() string {
+	return s.keyID
+}
+
+// Sign signs body and sets the signature headers on h. Every call uses a
+// new timestamp and nonce, so retried requests must be signed again.
+func (s *Signer) Sign(h http.Header, body []byte) error {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return fmt.Errorf("signature: failed to generate nonce: %w", err)
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce := base64.RawURLEncoding.EncodeToString(raw)
+	signature := ed25519.Sign(s.key, message(timestamp, nonce, body))
+
+	h.Set(HeaderKeyID, s.keyID)
+	h.Set(HeaderTimestamp, timestamp)
+	h.Set(HeaderNonce, nonce)
+	h.Set(HeaderSignature, base64.StdEncoding.EncodeToString(signature))
+	return nil
+}
+
+// Verification errors. Errors returned by Verifier wrap one of them.
+var (
+	ErrMissing   = errors.New("signature: missing signature headers")
+	ErrUnknown   = errors.New("signature: unknown key")
+	ErrInvalid   = errors.New("signature: invalid signature")
+	ErrExpired   = errors.New("signature: timestamp outside the allowed window")
+	ErrReplayed  = errors.New("signature: nonce already used")
+	ErrMalformed = errors.New("signature: malformed signature headers")
+)
+
+// DefaultMaxSkew is the default window around the server time in which
+// signature timestamps are accepted.
+const DefaultMaxSkew = 5 * time.Minute
+
+// Verifier verifies signed requests. It remembers the nonces of accepted
+// requests for the timestamp window, so a captured request cannot be
+// replayed. It is safe for concurrent use.
+type Verifier struct {
+	// Keys returns the public key with the given ID (e.g. the key an agent
+	// published during enrollment), or nil if the ID is unknown.
+	Keys func(keyID string) ed25519.PublicKey
+
+	// Accepted difference between signing time and server time
+	// (DefaultMaxSkew if zero)
+	MaxSkew time.Duration
+
+	mu      sync.Mutex
+	nonces  map[string]time.Time
+	checked time.Time
+}
+
+// Verify checks the signature headers in h against body and returns the
+// ID of the signing key.
+func (v *Verifier) Verify(h http.Header, body []byte) (string, error) {
+	keyID := h.Get(HeaderKeyID)
+	timestamp := h.Get(HeaderTimestamp)
+	nonce := h.Get(HeaderNonce)
+	encoded := h.Get(HeaderSignature)
+
+	if keyID == "" || timestamp == "" || nonce == "" || encoded == "" {
+		return "", ErrMissing
+	}
+
+	signed, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("%w: timestamp %q", ErrMalformed, timestamp)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(signature) != ed25519.SignatureSize {
+		return "", fmt.Errorf("%w: signature encoding", ErrMalformed)
+	}
+
+	maxSkew := v.MaxSkew
+	if maxSkew <= 0 {
+		maxSkew = DefaultMaxSkew
+	}
+
+	now := time.Now()
+	if skew := now.Sub(time.Unix(signed, 0)).Abs(); skew > maxSkew {
+		return "", fmt.Errorf("%w: off by %s", ErrExpired, skew.Round(time.Second))
+	}
+
+	key := v.Keys(keyID)
+	if key == nil {
+		return "", fmt.Errorf("%w: %s", ErrUnknown, keyID)
+	}
+
+	if !ed25519.Verify(key, message(timestamp, nonce, body), signature) {
+		return "", ErrInvalid
+	}
+
+	// Only authentic requests consume nonces
+	if !v.remember(keyID+"/"+nonce, now, maxSkew) {
+		return "", ErrReplayed
+	}
+
+	return keyID, nil
+}
+
+// VerifyRequest reads the body of r (up to maxBytes), verifies its
+// signature and replaces r.Body so handlers can still read it. It returns
+// the body and the ID of the signing key.
+func (v *Verifier) VerifyRequest(r *http.Request, maxBytes int64) ([]byte, string, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBytes+1))
+	if err != nil {
+		return nil, "", fmt.Errorf("signature: failed to read body: %w", err)
+	}
+	if int64(len(body)) > maxBytes {
+		return nil, "", fmt.Errorf("signature: body larger than %d bytes", maxBytes)
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	keyID, err := v.Verify(r.Header, body)
+	if err != nil {
+		return nil, "", err
+	}
+	return body, keyID, nil
+}
+
+// remember records a nonce and reports whether it was new. Nonces are
+// kept until their timestamp can no longer be accepted.
+func (v *Verifier) remember(nonce string, now time.Time, maxSkew time.Duration) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.nonces == nil {
+		v.nonces = make(map[string]time.Time)
+	}
+
+	if now.Sub(v.checked) > maxSkew {
+		for n, seen := range v.nonces {
+			if now.Sub(seen) > 2*maxSkew {
+				delete(v.nonces, n)
+			}
+		}
+		v.checked = now
+	}
+
+	if _, ok := v.nonces[nonce]; ok {
+		return false
+	}
+
+	v.nonces[nonce] = now
+	return true
+}
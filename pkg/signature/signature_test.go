@@ -0,0 +1,156 @@
+package signature
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func newTestSigner(t *testing.T) *Signer {
+	t.Helper()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewSigner(key)
+}
+
+func TestVerify(t *testing.T) {
+	signer := newTestSigner(t)
+	other := newTestSigner(t)
+	body := []byte(`{"cpu":{"usage_percent":12.5}}`)
+
+	// resign signs body with the given timestamp, replacing the headers of h
+	resign := func(h http.Header, s *Signer, timestamp time.Time) {
+		ts := strconv.FormatInt(timestamp.Unix(), 10)
+		nonce := h.Get(HeaderNonce)
+		h.Set(HeaderKeyID, s.KeyID())
+		h.Set(HeaderTimestamp, ts)
+		h.Set(HeaderSignature, base64.StdEncoding.EncodeToString(ed25519.Sign(s.key, message(ts, nonce, body))))
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(h http.Header)
+		body    []byte
+		wantErr error
+	}{
+		{name: "valid", modify: func(h http.Header) {}},
+		{name: "missing signature", modify: func(h http.Header) { h.Del(HeaderSignature) }, wantErr: ErrMissing},
+		{name: "missing nonce", modify: func(h http.Header) { h.Del(HeaderNonce) }, wantErr: ErrMissing},
+		{name: "malformed timestamp", modify: func(h http.Header) { h.Set(HeaderTimestamp, "now") }, wantErr: ErrMalformed},
+		{name: "malformed signature", modify: func(h http.Header) { h.Set(HeaderSignature, "!!") }, wantErr: ErrMalformed},
+		{name: "unknown key", modify: func(h http.Header) { resign(h, other, time.Now()) }, wantErr: ErrUnknown},
+		{name: "altered body", body: []byte(`{"cpu":{"usage_percent":99}}`), modify: func(h http.Header) {}, wantErr: ErrInvalid},
+		{name: "altered nonce", modify: func(h http.Header) { h.Set(HeaderNonce, "other") }, wantErr: ErrInvalid},
+		{name: "stale timestamp", modify: func(h http.Header) { resign(h, signer, time.Now().Add(-time.Hour)) }, wantErr: ErrExpired},
+		{name: "future timestamp", modify: func(h http.Header) { resign(h, signer, time.Now().Add(time.Hour)) }, wantErr: ErrExpired},
+		{name: "within skew", modify: func(h http.Header) { resign(h, signer, time.Now().Add(-time.Minute)) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := &Verifier{Keys: func(keyID string) ed25519.PublicKey {
+				if keyID == signer.KeyID() {
+					return signer.PublicKey()
+				}
+				return nil
+			}}
+
+			h := http.Header{}
+			if err := signer.Sign(h, body); err != nil {
+				t.Fatal(err)
+			}
+			tt.modify(h)
+
+			verified := body
+			if tt.body != nil {
+				verified = tt.body
+			}
+
+			keyID, err := v.Verify(h, verified)
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && keyID != signer.KeyID() {
+				t.Errorf("Verify() key ID = %q, want %q", keyID, signer.KeyID())
+			}
+		})
+	}
+}
+
+func TestVerifyReplay(t *testing.T) {
+	signer := newTestSigner(t)
+	v := &Verifier{Keys: func(string) ed25519.PublicKey { return signer.PublicKey() }}
+	body := []byte("payload")
+
+	h := http.Header{}
+	if err := signer.Sign(h, body); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := v.Verify(h, body); err != nil {
+		t.Fatalf("first Verify() error = %v", err)
+	}
+	if _, err := v.Verify(h, body); !errors.Is(err, ErrReplayed) {
+		t.Fatalf("replayed Verify() error = %v, want %v", err, ErrReplayed)
+	}
+
+	// Retries are signed again and accepted
+	if err := signer.Sign(h, body); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.Verify(h, body); err != nil {
+		t.Fatalf("re-signed Verify() error = %v", err)
+	}
+}
+
+func TestVerifyRequest(t *testing.T) {
+	signer := newTestSigner(t)
+	body := []byte(`{"timestamp_ms":1}`)
+
+	tests := []struct {
+		name     string
+		maxBytes int64
+		wantErr  bool
+	}{
+		{name: "within limit", maxBytes: int64(len(body))},
+		{name: "too large", maxBytes: int64(len(body)) - 1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := &Verifier{Keys: func(string) ed25519.PublicKey { return signer.PublicKey() }}
+
+			r := httptest.NewRequest(http.MethodPost, "/api/metrics", bytes.NewReader(body))
+			if err := signer.Sign(r.Header, body); err != nil {
+				t.Fatal(err)
+			}
+
+			got, _, err := v.VerifyRequest(r, tt.maxBytes)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("VerifyRequest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			if !bytes.Equal(got, body) {
+				t.Errorf("VerifyRequest() body = %q, want %q", got, body)
+			}
+			rest, _ := io.ReadAll(r.Body)
+			if !bytes.Equal(rest, body) {
+				t.Errorf("request body after VerifyRequest() = %q, want %q", rest, body)
+			}
+		})
+	}
+}